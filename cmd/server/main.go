@@ -1,84 +1,397 @@
 package main
 
 import (
-    "database/sql"
-    "log"
-    
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    stdlog "log"
+    "net/http"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+    "time"
+
     "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
     _ "github.com/lib/pq"
-    
+    _ "modernc.org/sqlite"
+
+    "subscription-service/db/migrations"
     "subscription-service/internal/api/handlers"
+    "subscription-service/internal/api/middleware"
+    "subscription-service/internal/cache"
+    "subscription-service/internal/calendar"
     "subscription-service/internal/config"
+    "subscription-service/internal/database"
+    "subscription-service/internal/health"
     "subscription-service/internal/logger"
+    "subscription-service/internal/metrics"
+    "subscription-service/internal/model"
     "subscription-service/internal/repository"
     "subscription-service/internal/service"
+    "subscription-service/internal/tracing"
+)
+
+const (
+    // configWatchInterval is how often the configuration file is checked for changes
+    configWatchInterval = 5 * time.Second
+    // dbMonitorInterval is how often the database connection is checked in the background
+    dbMonitorInterval = 10 * time.Second
+    // replicaCheckInterval is how often the read replica's lag is measured
+    replicaCheckInterval = 2 * time.Second
+    // tracingShutdownTimeout bounds how long pending spans are flushed on exit
+    tracingShutdownTimeout = 5 * time.Second
 )
 
 func main() {
+    args := os.Args[1:]
+
+    // "config print" dumps the effective configuration and exits
+    if len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+        cfg, err := config.LoadConfig(args[2:])
+        if err != nil {
+            stdlog.Fatalf("Could not load config: %v", err)
+        }
+        if err := cfg.Print(os.Stdout); err != nil {
+            stdlog.Fatalf("Could not print config: %v", err)
+        }
+        return
+    }
+
+    // "calendar-token USER_ID" prints a user's feed token and URL. The API has no authentication,
+    // so tokens are issued only here, by someone with access to the secret.
+    if len(args) >= 2 && args[0] == "calendar-token" {
+        userID, err := uuid.Parse(args[1])
+        if err != nil {
+            stdlog.Fatalf("Invalid user ID: %v", err)
+        }
+        cfg, err := config.LoadConfig(args[2:])
+        if err != nil {
+            stdlog.Fatalf("Could not load config: %v", err)
+        }
+        if cfg.Calendar.FeedSecret == "" {
+            stdlog.Fatalf("Calendar feeds are disabled: CALENDAR_FEED_SECRET is not set")
+        }
+        token := calendar.NewTokenSigner(cfg.Calendar.FeedSecret).Token(userID)
+        fmt.Printf("token: %s\nurl: /api/v1/users/%s/calendar.ics?token=%s\n", token, userID, token)
+        return
+    }
+
     // Load configuration
-    cfg, err := config.LoadConfig()
+    cfg, err := config.LoadConfig(args)
     if err != nil {
-        log.Fatalf("Could not load config: %v", err)
+        stdlog.Fatalf("Could not load config: %v", err)
     }
 
     // Initialize logger
-    logger := logger.NewLogger(cfg.LogLevel)
-    logger.Info("Starting subscription service...")
+    logOutput, err := logger.OpenOutput(cfg.Logging.Output)
+    if err != nil {
+        stdlog.Fatalf("Could not open log output: %v", err)
+    }
+    log := logger.New(cfg.Logging.Level, cfg.Logging.Format, logOutput)
 
-    // Connect to database
-    db, err := sql.Open("postgres", cfg.DatabaseURL)
+    // The first SIGINT or SIGTERM starts a graceful shutdown, a second one terminates the process
+    // immediately
+    stop, cancelSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    go func() {
+        <-stop.Done()
+        cancelSignals()
+    }()
+
+    err = run(stop, cfg, args, log)
     if err != nil {
-        log.Fatalf("Failed to connect to database: %v", err)
+        log.Error("Service stopped with an error", "error", err)
+    } else {
+        log.Info("Service stopped")
     }
-    defer db.Close()
+    logOutput.Close()
+    if err != nil {
+        os.Exit(1)
+    }
+}
+
+// run starts the service and blocks until stop is canceled. It then stops accepting connections,
+// drains in-flight requests, stops background workers, closes the cache and database pools and
+// flushes traces, in that order. Resources are released through defers, which run in reverse order
+// of setup, so they are also released on startup errors; tracing is set up first to flush last.
+func run(stop context.Context, cfg *config.Config, args []string, log *logger.Logger) error {
+    log.Info("Starting subscription service...", "version", cfg.Version)
 
-    // Test database connection
-    if err := db.Ping(); err != nil {
-        log.Fatalf("Failed to ping database: %v", err)
+    // Initialize tracing
+    shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "subscription-service", cfg.Version)
+    if err != nil {
+        return fmt.Errorf("failed to set up tracing: %w", err)
     }
-    logger.Info("Database connection established")
+    defer func() {
+        ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+        defer cancel()
+        if err := shutdownTracing(ctx); err != nil {
+            log.Error("Failed to flush traces", "error", err)
+        }
+    }()
+    log.Info("Tracing configured", "exporter", cfg.Tracing.Exporter)
+
+    appMetrics := metrics.New()
+    // Readiness requires the database and an up-to-date schema; optional dependencies
+    // are registered as non-critical so their failure only degrades the instance
+    checker := health.NewChecker(cfg.Health.CheckTimeout)
+
+    // Initialize the repository selected by database.url
+    var repo repository.SubscriptionRepository
+    var services repository.ServiceRepository
+    var dbMonitor *database.Monitor
+    var replica *database.Replica
+    switch cfg.Database.Driver() {
+    case config.DriverMemory:
+        log.Warn("Using the in-memory repository, data is lost on restart")
+        repo = repository.NewMemoryRepository()
+        services = repository.NewMemoryServiceRepository(repo)
+    default:
+        // Connect to PostgreSQL or SQLite, waiting for the database to come up
+        db, err := database.Open(stop, cfg.Database, log)
+        if err != nil {
+            if stop.Err() != nil {
+                log.Info("Shutdown signal received while waiting for the database")
+                return nil
+            }
+            return fmt.Errorf("failed to connect to database: %w", err)
+        }
+        defer func() {
+            if err := db.Close(); err != nil {
+                log.Error("Failed to close database pool", "error", err)
+                return
+            }
+            log.Info("Database pool closed")
+        }()
+        log.Info("Database connection established", "driver", cfg.Database.Driver(),
+            "max_open_conns", cfg.Database.MaxOpenConns, "max_idle_conns", cfg.Database.MaxIdleConns)
 
-    // Initialize repository
-    repo := repository.NewPostgresRepository(db)
+        var schema fs.FS = migrations.FS
+        if cfg.Database.Driver() == config.DriverSQLite {
+            // There is no separate migrate step for the single-binary setup
+            schema = migrations.SQLite
+            if err := database.Migrate(stop, db, schema); err != nil {
+                return fmt.Errorf("failed to migrate SQLite database: %w", err)
+            }
+            log.Info("SQLite schema is up to date", "path", cfg.Database.SQLitePath())
+        }
+
+        dbMonitor = database.NewMonitor(db, log)
+        appMetrics.RegisterDB(db, cfg.Database.Name)
+        appMetrics.RegisterConnection(dbMonitor)
+        checker.Register("database", true, dbMonitor.Ping)
+        checker.Register("migrations", true, health.Migrations(db, schema))
+        if cfg.Database.Driver() == config.DriverSQLite {
+            repo = repository.NewSQLiteRepository(db, log, cfg.Database.QueryTimeout)
+            services = repository.NewSQLiteServiceRepository(db, log, cfg.Database.QueryTimeout)
+        } else if cfg.Database.ReplicaURL != "" {
+            // Listings and cost reports go to the replica while it keeps up with the primary
+            replica, err = database.OpenReplica(cfg.Database, log)
+            if err != nil {
+                return err
+            }
+            defer func() {
+                if err := replica.DB().Close(); err != nil {
+                    log.Error("Failed to close replica pool", "error", err)
+                    return
+                }
+                log.Info("Replica pool closed")
+            }()
+            appMetrics.RegisterDB(replica.DB(), cfg.Database.Name+"_replica")
+            appMetrics.RegisterReplica(replica)
+            // Reads fall back to the primary, so the instance stays ready without the replica
+            checker.Register("replica", false, replica.Check)
+            repo = repository.NewPostgresRepositoryWithReplica(db, replica, log, cfg.Database.QueryTimeout)
+            log.Info("Database replica configured", "max_lag", cfg.Database.ReplicaMaxLag)
+        } else {
+            repo = repository.NewPostgresRepository(db, log, cfg.Database.QueryTimeout)
+        }
+        if services == nil {
+            services = repository.NewPostgresServiceRepository(db, log, cfg.Database.QueryTimeout)
+        }
+    }
+    repo = appMetrics.InstrumentRepository(repo)
 
     // Initialize service
-    subscriptionService := service.NewSubscriptionService(repo)
+    subscriptionService := service.NewSubscriptionService(repo, log)
+    // Subscriptions are linked to the service catalog and stored under the catalog's names
+    catalogService := service.NewCatalogService(services, log)
+    subscriptionService.UseCatalog(catalogService)
 
-    // Initialize handlers
-    subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
-
-    // Initialize Gin router
-    r := gin.Default()
-    
-    // Add middleware for CORS and request logging
-    r.Use(func(c *gin.Context) {
-        c.Header("Access-Control-Allow-Origin", "*")
-        c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-        
-        if c.Request.Method == "OPTIONS" {
-            c.AbortWithStatus(204)
-            return
+    // Cache cost reports for dashboards; writes invalidate the reports of the users they touch
+    var costStore cache.Store
+    switch cfg.Cache.Backend {
+    case config.CacheMemory:
+        costStore = cache.NewMemoryStore(cfg.Cache.Size)
+    case config.CacheRedis:
+        redisStore, err := cache.NewRedisStore(cfg.Cache.RedisURL)
+        if err != nil {
+            return fmt.Errorf("failed to set up cost cache: %w", err)
+        }
+        defer redisStore.Close()
+        // Without Redis reports are computed from the database, so the instance stays ready
+        checker.Register("cache", false, redisStore.Ping)
+        costStore = redisStore
+    }
+    if costStore != nil {
+        costCache := cache.NewCostCache(costStore, cfg.Cache.TTL, log)
+        subscriptionService.UseCostCache(costCache)
+        appMetrics.RegisterCostCache(costCache)
+        log.Info("Cost cache enabled", "backend", cfg.Cache.Backend, "ttl", cfg.Cache.TTL)
+    }
+    // The first start after the catalog migration seeds it from the services in use
+    if err := catalogService.Seed(stop); err != nil {
+        log.Warn("Service catalog not seeded, retrying on the next start", "error", err)
+    }
+    appMetrics.Register(metrics.NewBusinessCollector(func(ctx context.Context, month string) ([]model.CostGroup, error) {
+        summary, err := subscriptionService.CostSummary(ctx, model.SubscriptionFilter{Period: &month}, model.GroupByCategory)
+        if err != nil {
+            return nil, err
         }
-        c.Next()
+        return summary.Groups, nil
+    }))
+
+    // Initialize handlers
+    subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService, log)
+    serviceHandler := handlers.NewServiceHandler(catalogService, log)
+
+    var feedSigner *calendar.TokenSigner
+    if cfg.Calendar.FeedSecret != "" {
+        feedSigner = calendar.NewTokenSigner(cfg.Calendar.FeedSecret)
+    }
+    calendarHandler := handlers.NewCalendarHandler(subscriptionService, feedSigner, log)
+
+    healthHandler := handlers.NewHealthHandler(checker, log)
+
+    // Background workers run until the server has drained
+    workers, stopWorkers := context.WithCancel(context.Background())
+    var wg sync.WaitGroup
+    defer func() {
+        stopWorkers()
+        wg.Wait()
+        log.Info("Background workers stopped")
+    }()
+
+    // Detect database outages and recoveries between readiness probes
+    if dbMonitor != nil {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            dbMonitor.Run(workers, dbMonitorInterval)
+        }()
+    }
+    if replica != nil {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            replica.Run(workers, replicaCheckInterval)
+        }()
+    }
+
+    // Reload log level and rate limits on SIGHUP or config file change
+    rateLimiter := middleware.NewRateLimiter(cfg.RateLimit)
+    reloader := config.NewReloader(cfg, args)
+    reloader.Subscribe(func(cfg *config.Config) {
+        log.SetLevel(cfg.Logging.Level)
+        rateLimiter.Update(cfg.RateLimit)
     })
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        reloader.Watch(workers, configWatchInterval, func(ignored []string, err error) {
+            if err != nil {
+                log.Error("Configuration reload rejected, keeping current settings", "error", err)
+                return
+            }
+            log.Info("Configuration reloaded", "log_level", reloader.Current().Logging.Level)
+            if len(ignored) > 0 {
+                log.Warn("Configuration changes require a restart and were not applied", "sections", ignored)
+            }
+        })
+    }()
+
+    // Initialize Gin router with the project's middleware stack. Only the configured proxies may
+    // name the client in forwarding headers, which the access log and rate limit rely on.
+    r := gin.New()
+    if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+        return fmt.Errorf("invalid trusted proxies: %w", err)
+    }
+    r.Use(
+        middleware.RequestID(),
+        middleware.Tracing(),
+        appMetrics.Middleware(),
+        middleware.Logger(log),
+        middleware.Recovery(log),
+        middleware.CORS(),
+        middleware.RateLimit(rateLimiter, "/livez", "/health", "/readyz", "/metrics"),
+    )
 
     // Register routes
+    healthHandler.RegisterRoutes(r)
     subscriptionHandler.RegisterRoutes(r)
+    serviceHandler.RegisterRoutes(r)
+    calendarHandler.RegisterRoutes(r)
+    r.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+
+    server := &http.Server{
+        Addr:              ":" + cfg.Server.Port,
+        Handler:           r,
+        ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+        ReadTimeout:       cfg.Server.ReadTimeout,
+        WriteTimeout:      cfg.Server.WriteTimeout,
+        IdleTimeout:       cfg.Server.IdleTimeout,
+    }
 
     // Start server
-    serverAddr := ":" + cfg.ServerPort
-    logger.Infof("Server starting on port %s", cfg.ServerPort)
-    logger.Info("Available endpoints:")
-    logger.Info("  POST /api/v1/subscriptions - Create subscription")
-    logger.Info("  GET /api/v1/subscriptions - Get all subscriptions")
-    logger.Info("  GET /api/v1/subscriptions/:id - Get subscription by ID")
-    logger.Info("  PUT /api/v1/subscriptions/:id - Update subscription")
-    logger.Info("  DELETE /api/v1/subscriptions/:id - Delete subscription")
-    logger.Info("  GET /api/v1/subscriptions/cost - Calculate total cost with filters")
-    logger.Info("  GET /health - Health check")
-
-    if err := r.Run(serverAddr); err != nil {
-        log.Fatalf("Failed to start server: %v", err)
-    }
-}
\ No newline at end of file
+    log.Infof("Server starting on port %s", cfg.Server.Port)
+    log.Info("Available endpoints:")
+    log.Info("  POST /api/v1/subscriptions - Create subscription")
+    log.Info("  POST /api/v1/subscriptions:batch - Batch create/update/delete")
+    log.Info("  POST /api/v1/subscriptions/import - Import subscriptions from CSV")
+    log.Info("  GET /api/v1/subscriptions - Get all subscriptions")
+    log.Info("  GET /api/v1/subscriptions/:id - Get subscription by ID")
+    log.Info("  PUT /api/v1/subscriptions/:id - Update subscription")
+    log.Info("  DELETE /api/v1/subscriptions/:id - Delete subscription")
+    log.Info("  GET /api/v1/subscriptions/cost - Calculate total cost with filters")
+    log.Info("  POST /api/v1/services - Add a service to the catalog")
+    log.Info("  GET /api/v1/services - Get the service catalog")
+    log.Info("  GET /api/v1/services/:id - Get a catalog entry by ID")
+    log.Info("  PUT /api/v1/services/:id - Update a catalog entry")
+    log.Info("  DELETE /api/v1/services/:id - Delete a catalog entry")
+    log.Info("  POST /api/v1/users/:user_id/statements - Detect subscriptions in a bank statement")
+    log.Info("  GET /api/v1/users/:user_id/calendar.ics - iCalendar feed of renewals")
+    log.Info("  GET /livez - Liveness probe (also /health)")
+    log.Info("  GET /readyz - Readiness probe with dependency checks")
+    log.Info("  GET /metrics - Prometheus metrics")
+
+    serveErr := make(chan error, 1)
+    go func() {
+        serveErr <- server.ListenAndServe()
+    }()
+
+    select {
+    case err := <-serveErr:
+        return fmt.Errorf("failed to start server: %w", err)
+    case <-stop.Done():
+    }
+    log.Info("Shutdown signal received, draining requests",
+        "delay", cfg.Server.ShutdownDelay, "grace_period", cfg.Server.ShutdownTimeout)
+
+    // Fail readiness and keep serving while load balancers take the instance out of rotation
+    checker.SetDraining()
+    time.Sleep(cfg.Server.ShutdownDelay)
+
+    ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+    defer cancel()
+    if err := server.Shutdown(ctx); err != nil {
+        server.Close()
+        return fmt.Errorf("requests still in flight after %v: %w", cfg.Server.ShutdownTimeout, err)
+    }
+    if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+        return fmt.Errorf("server stopped unexpectedly: %w", err)
+    }
+    log.Info("HTTP server drained")
+    return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    "subscription-service/internal/config"
+    "subscription-service/internal/logger"
+)
+
+// freePort returns a port nothing listens on at the moment
+func freePort(t *testing.T) string {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    require.NoError(t, err)
+    defer l.Close()
+    return fmt.Sprint(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestRunDrainsInFlightRequestsOnStop(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    cfg := config.Default()
+    cfg.Database.URL = "memory://"
+    cfg.Server.Port = freePort(t)
+    cfg.Server.ShutdownTimeout = 5 * time.Second
+    addr := "127.0.0.1:" + cfg.Server.Port
+
+    stop, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    done := make(chan error, 1)
+    go func() {
+        done <- run(stop, cfg, nil, logger.Nop())
+    }()
+    require.Eventually(t, func() bool {
+        resp, err := http.Get("http://" + addr + "/livez")
+        if err != nil {
+            return false
+        }
+        resp.Body.Close()
+        return resp.StatusCode == http.StatusOK
+    }, 5*time.Second, 10*time.Millisecond)
+
+    // Send the headers and half of the body, so the handler is waiting for the rest when the
+    // service is stopped
+    body := `{"service_name": "Yandex Plus", "price": 400, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "07-2025"}`
+    conn, err := net.Dial("tcp", addr)
+    require.NoError(t, err)
+    defer conn.Close()
+    _, err = fmt.Fprintf(conn, "POST /api/v1/subscriptions HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\n"+
+        "Content-Length: %d\r\n\r\n%s", addr, len(body), body[:len(body)/2])
+    require.NoError(t, err)
+    time.Sleep(100 * time.Millisecond)
+
+    cancel()
+    select {
+    case err := <-done:
+        t.Fatalf("run returned with a request in flight: %v", err)
+    case <-time.After(200 * time.Millisecond):
+    }
+    // New connections are refused while the request drains
+    _, err = net.Dial("tcp", addr)
+    assert.Error(t, err)
+
+    _, err = io.WriteString(conn, body[len(body)/2:])
+    require.NoError(t, err)
+    resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+    require.NoError(t, err)
+    resp.Body.Close()
+    assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+    select {
+    case err := <-done:
+        assert.NoError(t, err)
+    case <-time.After(5 * time.Second):
+        t.Fatal("run did not return after the request completed")
+    }
+}
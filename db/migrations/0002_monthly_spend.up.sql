@@ -0,0 +1,21 @@
+-- Spend per user (the tenant) and service in every closed month, so cost reports read one row per
+-- month instead of expanding each subscription into the months it was active. The repository keeps
+-- it in step with subscriptions on every write. Months are numbered from year 0: year * 12 + month - 1.
+CREATE TABLE monthly_spend (
+    user_id UUID NOT NULL,
+    service_name VARCHAR(255) NOT NULL,
+    month INTEGER NOT NULL,
+    amount BIGINT NOT NULL,
+    subscription_count INTEGER NOT NULL,
+    PRIMARY KEY (user_id, service_name, month)
+);
+
+CREATE INDEX idx_monthly_spend_month ON monthly_spend(month);
+
+-- Months before closed_before are materialized; later months are summed from subscriptions.
+-- The first write after a month has ended materializes it, starting with all past months.
+CREATE TABLE monthly_spend_state (
+    closed_before INTEGER NOT NULL
+);
+
+INSERT INTO monthly_spend_state (closed_before) VALUES (0);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS services_seed_state;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS service_id;
+DROP TABLE IF EXISTS services;
@@ -0,0 +1,26 @@
+-- Catalog of known services. Subscriptions are linked to the entry their service_name matches and
+-- stored under its name, so spellings such as "yandex plus" and "Яндекс Плюс" add up in cost reports.
+CREATE TABLE services (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    website VARCHAR(255) NOT NULL DEFAULT '',
+    default_price INTEGER CHECK (default_price > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_services_name ON services (lower(name));
+
+ALTER TABLE subscriptions ADD COLUMN service_id INTEGER REFERENCES services(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_subscriptions_service_id ON subscriptions(service_id);
+
+-- The catalog is seeded from the service names in use once, by the service at startup, so that
+-- spellings are grouped by the same rules as new subscriptions are matched with
+CREATE TABLE services_seed_state (
+    seeded BOOLEAN NOT NULL
+);
+
+INSERT INTO services_seed_state (seeded) VALUES (false);
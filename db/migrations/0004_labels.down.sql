@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_subscriptions_tags;
+DROP INDEX IF EXISTS idx_subscriptions_category;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS tags;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS category;
@@ -0,0 +1,7 @@
+-- Category (one of the categories the service accepts) and free-form tags of a subscription. Cost
+-- reports can be filtered and grouped by both.
+ALTER TABLE subscriptions ADD COLUMN category VARCHAR(50);
+ALTER TABLE subscriptions ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_subscriptions_category ON subscriptions(category);
+CREATE INDEX idx_subscriptions_tags ON subscriptions USING GIN (tags);
@@ -0,0 +1 @@
+-- The categories cleared by the up migration cannot be restored; the schema is unchanged.
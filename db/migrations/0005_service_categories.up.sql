@@ -0,0 +1,4 @@
+-- Catalog categories are limited to the categories a subscription accepts. Known ones written in
+-- another case are normalized; the others are cleared.
+UPDATE services SET category = lower(trim(category));
+UPDATE services SET category = '' WHERE category NOT IN ('entertainment', 'dev_tools', 'cloud', 'education');
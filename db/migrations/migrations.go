@@ -0,0 +1,62 @@
+// Package migrations embeds the SQL migrations so the service can tell whether the database
+// schema is up to date. The files follow golang-migrate naming: NNNN_name.up.sql / .down.sql.
+// The top-level files are for PostgreSQL; sqlite/ holds the SQLite schema, which the service
+// applies itself on startup.
+package migrations
+
+import (
+    "embed"
+    "fmt"
+    "io/fs"
+    "regexp"
+    "sort"
+    "strconv"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLite holds the SQLite migrations
+var SQLite = sub(sqliteFS, "sqlite")
+
+func sub(fsys fs.FS, dir string) fs.FS {
+    s, err := fs.Sub(fsys, dir)
+    if err != nil {
+        panic(err)
+    }
+    return s
+}
+
+// Migration is an up migration file
+type Migration struct {
+    Version int64
+    Name    string
+}
+
+// upMigration matches golang-migrate file names such as 0001_init.up.sql
+var upMigration = regexp.MustCompile(`^(\d+)_.+\.up\.sql$`)
+
+// List returns the up migrations in fsys ordered by version
+func List(fsys fs.FS) ([]Migration, error) {
+    entries, err := fs.ReadDir(fsys, ".")
+    if err != nil {
+        return nil, fmt.Errorf("failed to list migrations: %w", err)
+    }
+    var list []Migration
+    for _, entry := range entries {
+        match := upMigration.FindStringSubmatch(entry.Name())
+        if match == nil {
+            continue
+        }
+        version, err := strconv.ParseInt(match[1], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+        }
+        list = append(list, Migration{Version: version, Name: entry.Name()})
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+    return list, nil
+}
@@ -0,0 +1,16 @@
+-- SQLite version of the subscriptions schema. Dates are stored as MM-YYYY text like in PostgreSQL;
+-- AUTOINCREMENT keeps IDs of deleted rows from being reused, as a PostgreSQL sequence does.
+CREATE TABLE subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL,
+    price INTEGER NOT NULL CHECK (price > 0),
+    user_id TEXT NOT NULL,
+    start_date TEXT NOT NULL, -- Format: MM-YYYY
+    end_date TEXT, -- Format: MM-YYYY, optional
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_subscriptions_user_id ON subscriptions(user_id);
+CREATE INDEX idx_subscriptions_service_name ON subscriptions(service_name);
+CREATE INDEX idx_subscriptions_start_date ON subscriptions(start_date);
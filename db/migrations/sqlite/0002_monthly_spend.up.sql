@@ -0,0 +1,19 @@
+-- SQLite version of monthly_spend: spend per user and service in every closed month, with months
+-- numbered from year 0 (year * 12 + month - 1). Maintained by the repository on every write.
+CREATE TABLE monthly_spend (
+    user_id TEXT NOT NULL,
+    service_name TEXT NOT NULL,
+    month INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    subscription_count INTEGER NOT NULL,
+    PRIMARY KEY (user_id, service_name, month)
+);
+
+CREATE INDEX idx_monthly_spend_month ON monthly_spend(month);
+
+-- Months before closed_before are materialized; later months are summed from subscriptions
+CREATE TABLE monthly_spend_state (
+    closed_before INTEGER NOT NULL
+);
+
+INSERT INTO monthly_spend_state (closed_before) VALUES (0);
@@ -0,0 +1,24 @@
+-- SQLite cannot drop a column that references another table, so subscriptions is rebuilt
+CREATE TABLE subscriptions_without_service (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL,
+    price INTEGER NOT NULL CHECK (price > 0),
+    user_id TEXT NOT NULL,
+    start_date TEXT NOT NULL,
+    end_date TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO subscriptions_without_service (id, service_name, price, user_id, start_date, end_date, created_at, updated_at)
+SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at FROM subscriptions;
+
+DROP TABLE subscriptions;
+ALTER TABLE subscriptions_without_service RENAME TO subscriptions;
+
+CREATE INDEX idx_subscriptions_user_id ON subscriptions(user_id);
+CREATE INDEX idx_subscriptions_service_name ON subscriptions(service_name);
+CREATE INDEX idx_subscriptions_start_date ON subscriptions(start_date);
+
+DROP TABLE IF EXISTS services_seed_state;
+DROP TABLE IF EXISTS services;
@@ -0,0 +1,24 @@
+-- SQLite version of the service catalog. Aliases are a JSON array of strings.
+CREATE TABLE services (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    aliases TEXT NOT NULL DEFAULT '[]',
+    category TEXT NOT NULL DEFAULT '',
+    website TEXT NOT NULL DEFAULT '',
+    default_price INTEGER CHECK (default_price > 0),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_services_name ON services (lower(name));
+
+ALTER TABLE subscriptions ADD COLUMN service_id INTEGER REFERENCES services(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_subscriptions_service_id ON subscriptions(service_id);
+
+-- Seeded by the service at startup; seeded is 0 or 1
+CREATE TABLE services_seed_state (
+    seeded INTEGER NOT NULL
+);
+
+INSERT INTO services_seed_state (seeded) VALUES (0);
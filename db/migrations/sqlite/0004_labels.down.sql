@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subscriptions_category;
+ALTER TABLE subscriptions DROP COLUMN tags;
+ALTER TABLE subscriptions DROP COLUMN category;
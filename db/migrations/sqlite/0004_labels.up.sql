@@ -0,0 +1,5 @@
+-- SQLite version of the subscription category and tags. Tags are a JSON array of strings.
+ALTER TABLE subscriptions ADD COLUMN category TEXT;
+ALTER TABLE subscriptions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+
+CREATE INDEX idx_subscriptions_category ON subscriptions(category);
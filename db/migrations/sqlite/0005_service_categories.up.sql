@@ -0,0 +1,4 @@
+-- SQLite version of the catalog category cleanup: known categories written in another case are
+-- normalized, the others are cleared.
+UPDATE services SET category = lower(trim(category));
+UPDATE services SET category = '' WHERE category NOT IN ('entertainment', 'dev_tools', 'cloud', 'education');
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "subscription-service/internal/api/middleware"
+    "subscription-service/internal/calendar"
+    "subscription-service/internal/logger"
+    "subscription-service/internal/service"
+)
+
+type CalendarHandler struct {
+    subscriptionService *service.SubscriptionService
+    signer              *calendar.TokenSigner
+    log                 *logger.Logger
+}
+
+// NewCalendarHandler creates the calendar feed handler. A nil signer disables the feeds.
+func NewCalendarHandler(subscriptionService *service.SubscriptionService, signer *calendar.TokenSigner, log *logger.Logger) *CalendarHandler {
+    return &CalendarHandler{subscriptionService: subscriptionService, signer: signer, log: log}
+}
+
+// RegisterRoutes registers the calendar feed routes
+func (h *CalendarHandler) RegisterRoutes(r *gin.Engine) {
+    api := r.Group("/api/v1")
+    {
+        api.GET("/users/:user_id/calendar.ics", h.GetFeed)
+    }
+}
+
+// GetFeed returns the user's renewals and end dates as an iCalendar feed
+func (h *CalendarHandler) GetFeed(c *gin.Context) {
+    userID, ok := h.parseUser(c)
+    if !ok {
+        return
+    }
+
+    // Calendar clients cannot set headers, so the token is usually passed in the query
+    token := c.Query("token")
+    if token == "" {
+        token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+    }
+    if !h.signer.Verify(userID, token) {
+        h.log.WithContext(c.Request.Context()).Warn("invalid calendar feed token")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid feed token"})
+        return
+    }
+    c.Set(middleware.PrincipalKey, "feed:"+userID.String())
+
+    subscriptions, err := h.subscriptionService.GetByUser(c.Request.Context(), userID)
+    if err != nil {
+        internalError(c, h.log, err)
+        return
+    }
+
+    c.Header("Content-Type", "text/calendar; charset=utf-8")
+    c.Header("Content-Disposition", `inline; filename="subscriptions.ics"`)
+    c.Status(http.StatusOK)
+    if err := calendar.WriteFeed(c.Writer, "Subscriptions", subscriptions); err != nil {
+        h.log.WithContext(c.Request.Context()).Error("calendar feed write failed", "error", err)
+        _ = c.Error(err)
+    }
+}
+
+func (h *CalendarHandler) parseUser(c *gin.Context) (uuid.UUID, bool) {
+    if h.signer == nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feeds are disabled"})
+        return uuid.Nil, false
+    }
+
+    userID, err := uuid.Parse(c.Param("user_id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
+        return uuid.Nil, false
+    }
+    withLogFields(c, "user_id", userID)
+    return userID, true
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "subscription-service/internal/export"
+    "subscription-service/internal/logger"
+)
+
+// negotiateFormat picks the response format from the format query parameter,
+// falling back to the Accept header
+func negotiateFormat(c *gin.Context) (export.Format, error) {
+    if value := c.Query("format"); value != "" {
+        return export.ParseFormat(value)
+    }
+    return export.FormatFromAccept(c.GetHeader("Accept")), nil
+}
+
+// exportStream writes an export to the response. The headers and the writer are created on
+// first use, so errors that happen before any row is produced can still be reported as JSON.
+type exportStream struct {
+    c        *gin.Context
+    format   export.Format
+    filename string
+    columns  []string
+    w        export.Writer
+}
+
+func newExportStream(c *gin.Context, format export.Format, filename string, columns []string) *exportStream {
+    return &exportStream{c: c, format: format, filename: filename, columns: columns}
+}
+
+func (s *exportStream) writer() (export.Writer, error) {
+    if s.w != nil {
+        return s.w, nil
+    }
+    s.c.Header("Content-Type", s.format.ContentType())
+    s.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, s.filename, s.format.Extension()))
+    s.c.Status(http.StatusOK)
+    w, err := export.NewWriter(s.format, s.c.Writer, s.columns)
+    if err != nil {
+        return nil, err
+    }
+    s.w = w
+    return w, nil
+}
+
+func (s *exportStream) WriteRow(values []interface{}) error {
+    w, err := s.writer()
+    if err != nil {
+        return err
+    }
+    return w.WriteRow(values)
+}
+
+func (s *exportStream) Close() error {
+    w, err := s.writer()
+    if err != nil {
+        return err
+    }
+    return w.Close()
+}
+
+// fail reports an error like serviceError if nothing has been written yet,
+// otherwise it logs the error and aborts the partially written response
+func (s *exportStream) fail(log *logger.Logger, status int, err error) {
+    if s.w == nil {
+        serviceError(s.c, log, status, err)
+        return
+    }
+    log.WithContext(s.c.Request.Context()).Error("export failed", "format", s.format, "error", err)
+    _ = s.c.Error(err)
+    s.c.Abort()
+}
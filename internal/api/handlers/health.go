@@ -0,0 +1,42 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "subscription-service/internal/health"
+    "subscription-service/internal/logger"
+)
+
+type HealthHandler struct {
+    checker *health.Checker
+    log     *logger.Logger
+}
+
+func NewHealthHandler(checker *health.Checker, log *logger.Logger) *HealthHandler {
+    return &HealthHandler{checker: checker, log: log}
+}
+
+// RegisterRoutes registers the probe routes. /health is kept as an alias of /livez.
+func (h *HealthHandler) RegisterRoutes(r *gin.Engine) {
+    r.GET("/livez", h.Live)
+    r.GET("/health", h.Live)
+    r.GET("/readyz", h.Ready)
+}
+
+// Live reports that the process is running and serving requests; it checks no dependencies,
+// so an unavailable database never gets the instance restarted
+func (h *HealthHandler) Live(c *gin.Context) {
+    c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Ready reports whether the instance should receive traffic, with the result of every dependency check
+func (h *HealthHandler) Ready(c *gin.Context) {
+    report := h.checker.Evaluate(c.Request.Context())
+    if !report.Ready() {
+        h.log.WithContext(c.Request.Context()).Warn("readiness check failed", "status", report.Status, "checks", report.Checks)
+        c.JSON(http.StatusServiceUnavailable, report)
+        return
+    }
+    c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "subscription-service/internal/logger"
+    "subscription-service/internal/model"
+    "subscription-service/internal/repository"
+    "subscription-service/internal/service"
+)
+
+type ServiceHandler struct {
+    catalogService *service.CatalogService
+    log            *logger.Logger
+}
+
+func NewServiceHandler(catalogService *service.CatalogService, log *logger.Logger) *ServiceHandler {
+    return &ServiceHandler{catalogService: catalogService, log: log}
+}
+
+// RegisterRoutes registers the service catalog routes
+func (h *ServiceHandler) RegisterRoutes(r *gin.Engine) {
+    api := r.Group("/api/v1")
+    {
+        api.POST("/services", h.CreateService)
+        api.GET("/services", h.GetServices)
+        api.GET("/services/:id", h.GetServiceByID)
+        api.PUT("/services/:id", h.UpdateService)
+        api.DELETE("/services/:id", h.DeleteService)
+    }
+}
+
+// catalogError responds to a failed catalog write: 404 for a missing entry, 409 for a name or
+// alias used by another entry and status otherwise
+func (h *ServiceHandler) catalogError(c *gin.Context, status int, err error) {
+    switch {
+    case err.Error() == "service not found":
+        c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+    case errors.Is(err, repository.ErrServiceConflict):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        serviceError(c, h.log, status, err)
+    }
+}
+
+// serviceID parses the :id parameter, responding with 400 if it is not a number
+func (h *ServiceHandler) serviceID(c *gin.Context) (int, bool) {
+    id, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service ID"})
+        return 0, false
+    }
+    withLogFields(c, "service_id", id)
+    return id, true
+}
+
+// CreateService adds a service to the catalog
+func (h *ServiceHandler) CreateService(c *gin.Context) {
+    var req model.ServiceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+        return
+    }
+
+    created, err := h.catalogService.Create(c.Request.Context(), &req)
+    if err != nil {
+        h.catalogError(c, http.StatusBadRequest, err)
+        return
+    }
+
+    c.JSON(http.StatusCreated, created)
+}
+
+// GetServices returns the whole catalog
+func (h *ServiceHandler) GetServices(c *gin.Context) {
+    services, err := h.catalogService.List(c.Request.Context())
+    if err != nil {
+        internalError(c, h.log, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, services)
+}
+
+// GetServiceByID returns a catalog entry by ID
+func (h *ServiceHandler) GetServiceByID(c *gin.Context) {
+    id, ok := h.serviceID(c)
+    if !ok {
+        return
+    }
+
+    found, err := h.catalogService.GetByID(c.Request.Context(), id)
+    if err != nil {
+        h.catalogError(c, http.StatusInternalServerError, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, found)
+}
+
+// UpdateService replaces a catalog entry; renaming it renames its subscriptions
+func (h *ServiceHandler) UpdateService(c *gin.Context) {
+    id, ok := h.serviceID(c)
+    if !ok {
+        return
+    }
+
+    var req model.ServiceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+        return
+    }
+
+    updated, err := h.catalogService.Update(c.Request.Context(), id, &req)
+    if err != nil {
+        h.catalogError(c, http.StatusBadRequest, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, updated)
+}
+
+// DeleteService removes a catalog entry; its subscriptions keep their name and are unlinked
+func (h *ServiceHandler) DeleteService(c *gin.Context) {
+    id, ok := h.serviceID(c)
+    if !ok {
+        return
+    }
+
+    if err := h.catalogService.Delete(c.Request.Context(), id); err != nil {
+        h.catalogError(c, http.StatusInternalServerError, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Service deleted successfully"})
+}
@@ -1,21 +1,65 @@
 package handlers
 
 import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
     "net/http"
     "strconv"
+    "strings"
     
     "github.com/gin-gonic/gin"
     "github.com/google/uuid"
+    "subscription-service/internal/export"
+    "subscription-service/internal/logger"
     "subscription-service/internal/service"
     "subscription-service/internal/model"
 )
 
 type SubscriptionHandler struct {
     subscriptionService *service.SubscriptionService
+    log                 *logger.Logger
 }
 
-func NewSubscriptionHandler(subscriptionService *service.SubscriptionService) *SubscriptionHandler {
-    return &SubscriptionHandler{subscriptionService: subscriptionService}
+func NewSubscriptionHandler(subscriptionService *service.SubscriptionService, log *logger.Logger) *SubscriptionHandler {
+    return &SubscriptionHandler{subscriptionService: subscriptionService, log: log}
+}
+
+// withLogFields adds fields to the request context so every log entry for the request carries them
+func withLogFields(c *gin.Context, keysAndValues ...interface{}) {
+    c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), keysAndValues...))
+}
+
+// statusClientClosedRequest is recorded when the client disconnects before the response is written
+const statusClientClosedRequest = 499
+
+// internalError logs err with the request's log fields and responds with 500
+func internalError(c *gin.Context, log *logger.Logger, err error) {
+    serviceError(c, log, http.StatusInternalServerError, err)
+}
+
+// serviceError responds to a failed service call with status. Failures caused by a query timeout
+// are reported as 504, failures caused by the client disconnecting as 499 and uploads larger than
+// MaxUploadSize as 413 instead.
+func serviceError(c *gin.Context, log *logger.Logger, status int, err error) {
+    if bodyTooLarge(c, err) {
+        return
+    }
+    entry := log.WithContext(c.Request.Context())
+    switch {
+    case errors.Is(err, context.DeadlineExceeded):
+        entry.Warn("request timed out", "method", c.Request.Method, "path", c.FullPath(), "error", err)
+        c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+    case errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil:
+        entry.Info("request cancelled by client", "method", c.Request.Method, "path", c.FullPath())
+        c.AbortWithStatus(statusClientClosedRequest)
+    default:
+        if status >= http.StatusInternalServerError {
+            entry.Error("request failed", "method", c.Request.Method, "path", c.FullPath(), "error", err)
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+    }
 }
 
 // RegisterRoutes registers all subscription routes
@@ -23,17 +67,15 @@ func (h *SubscriptionHandler) RegisterRoutes(r *gin.Engine) {
     api := r.Group("/api/v1")
     {
         api.POST("/subscriptions", h.CreateSubscription)
+        api.POST("/subscriptions:action", h.SubscriptionAction)
+        api.POST("/subscriptions/import", h.ImportSubscriptions)
         api.GET("/subscriptions", h.GetSubscriptions)
         api.GET("/subscriptions/:id", h.GetSubscriptionByID)
         api.PUT("/subscriptions/:id", h.UpdateSubscription)
         api.DELETE("/subscriptions/:id", h.DeleteSubscription)
         api.GET("/subscriptions/cost", h.CalculateTotalCost)
+        api.POST("/users/:user_id/statements", h.AnalyzeStatement)
     }
-    
-    // Health check
-    r.GET("/health", func(c *gin.Context) {
-        c.JSON(http.StatusOK, gin.H{"status": "ok"})
-    })
 }
 
 // CreateSubscription creates a new subscription
@@ -44,26 +86,215 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
         return
     }
 
-    subscription, err := h.subscriptionService.Create(&req)
+    subscription, err := h.subscriptionService.Create(c.Request.Context(), &req)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        serviceError(c, h.log, http.StatusBadRequest, err)
         return
     }
 
     c.JSON(http.StatusCreated, subscription)
 }
 
-// GetSubscriptions returns all subscriptions
+// SubscriptionAction dispatches the custom methods of the collection, POST /subscriptions:{action}.
+// Gin cannot register a literal colon, so the route is a parameter that also matches paths such
+// as /subscriptionsXYZ. Those are answered like any unregistered route.
+func (h *SubscriptionHandler) SubscriptionAction(c *gin.Context) {
+    action, ok := strings.CutPrefix(c.Param("action"), ":")
+    switch {
+    case !ok:
+        c.String(http.StatusNotFound, "404 page not found")
+    case action == "batch":
+        h.BatchSubscriptions(c)
+    default:
+        c.JSON(http.StatusNotFound, gin.H{"error": "Unknown action: " + action})
+    }
+}
+
+// BatchSubscriptions applies a batch of create, update and delete operations
+func (h *SubscriptionHandler) BatchSubscriptions(c *gin.Context) {
+    var req model.BatchRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+        return
+    }
+
+    result, err := h.subscriptionService.Batch(c.Request.Context(), &req)
+    if err != nil {
+        serviceError(c, h.log, http.StatusBadRequest, err)
+        return
+    }
+
+    status := http.StatusOK
+    if result.Mode == model.BatchModeAtomic && result.Failed > 0 {
+        status = http.StatusUnprocessableEntity
+    } else if result.Failed > 0 {
+        status = http.StatusMultiStatus
+    }
+
+    c.JSON(status, result)
+}
+
+// ImportSubscriptions imports subscriptions from a CSV body or a multipart "file" field.
+// With dry_run=true the rows are only validated and a report is returned.
+func (h *SubscriptionHandler) ImportSubscriptions(c *gin.Context) {
+    dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dry_run value"})
+        return
+    }
+
+    body, ok := uploadedFile(c)
+    if !ok {
+        return
+    }
+    defer body.Close()
+
+    report, err := h.subscriptionService.Import(c.Request.Context(), body, dryRun)
+    if err != nil {
+        var csvErr *service.CSVError
+        status := http.StatusInternalServerError
+        if errors.As(err, &csvErr) {
+            status = http.StatusBadRequest
+        }
+        serviceError(c, h.log, status, err)
+        return
+    }
+
+    status := http.StatusOK
+    if !dryRun && report.Imported > 0 {
+        status = http.StatusCreated
+    }
+    c.JSON(status, report)
+}
+
+// AnalyzeStatement detects recurring charges in an uploaded OFX or CAMT.053 bank statement
+// and proposes subscriptions for the ones the user does not track yet
+func (h *SubscriptionHandler) AnalyzeStatement(c *gin.Context) {
+    userID, err := uuid.Parse(c.Param("user_id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
+        return
+    }
+    withLogFields(c, "user_id", userID)
+
+    body, ok := uploadedFile(c)
+    if !ok {
+        return
+    }
+    defer body.Close()
+
+    report, err := h.subscriptionService.AnalyzeStatement(c.Request.Context(), userID, body)
+    if err != nil {
+        serviceError(c, h.log, http.StatusBadRequest, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, report)
+}
+
+// MaxUploadSize is the largest request body accepted by the CSV import and statement endpoints
+const MaxUploadSize = 10 << 20
+
+// uploadedFile returns the multipart "file" field, or the raw request body for other content types,
+// responding with 400 if the field is missing. The body is limited to MaxUploadSize; reading past
+// it fails with an *http.MaxBytesError, which serviceError answers with 413.
+func uploadedFile(c *gin.Context) (io.ReadCloser, bool) {
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxUploadSize)
+    if !strings.HasPrefix(c.ContentType(), "multipart/") {
+        return c.Request.Body, true
+    }
+    file, _, err := c.Request.FormFile("file")
+    if bodyTooLarge(c, err) {
+        return nil, false
+    }
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file field: " + err.Error()})
+        return nil, false
+    }
+    return file, true
+}
+
+// bodyTooLarge responds with 413 if err comes from reading past the MaxUploadSize limit
+func bodyTooLarge(c *gin.Context, err error) bool {
+    var tooLarge *http.MaxBytesError
+    if !errors.As(err, &tooLarge) {
+        return false
+    }
+    c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit)})
+    return true
+}
+
+// GetSubscriptions returns the subscriptions matching the optional filters
 func (h *SubscriptionHandler) GetSubscriptions(c *gin.Context) {
-    subscriptions, err := h.subscriptionService.GetAll()
+    filter, ok := subscriptionFilter(c)
+    if !ok {
+        return
+    }
+
+    format, err := negotiateFormat(c)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if format != export.FormatJSON {
+        h.exportSubscriptions(c, format, filter)
+        return
+    }
+
+    subscriptions, err := h.subscriptionService.List(c.Request.Context(), filter)
+    if err != nil {
+        serviceError(c, h.log, filterStatus(err), err)
         return
     }
 
     c.JSON(http.StatusOK, subscriptions)
 }
 
+// filterStatus is the status of a failed listing or cost report: 400 for an invalid filter and
+// 500 for anything else
+func filterStatus(err error) int {
+    var filterErr *service.FilterError
+    if errors.As(err, &filterErr) {
+        return http.StatusBadRequest
+    }
+    return http.StatusInternalServerError
+}
+
+// subscriptionFilter parses the filters shared by the list and cost endpoints, responding with 400
+// if user_id is not a UUID. Tags may be repeated or comma-separated; a subscription must carry all.
+func subscriptionFilter(c *gin.Context) (model.SubscriptionFilter, bool) {
+    var filter model.SubscriptionFilter
+
+    // Parse user_id filter
+    if userIDStr := c.Query("user_id"); userIDStr != "" {
+        parsedUUID, err := uuid.Parse(userIDStr)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
+            return filter, false
+        }
+        filter.UserID = &parsedUUID
+        withLogFields(c, "user_id", parsedUUID)
+    }
+
+    // Parse service_name filter
+    if serviceNameStr := c.Query("service_name"); serviceNameStr != "" {
+        filter.ServiceName = &serviceNameStr
+    }
+
+    // Parse period filter
+    if periodStr := c.Query("period"); periodStr != "" {
+        filter.Period = &periodStr
+    }
+
+    if category := c.Query("category"); category != "" {
+        filter.Category = &category
+    }
+    for _, tags := range c.QueryArray("tag") {
+        filter.Tags = append(filter.Tags, strings.Split(tags, ",")...)
+    }
+    return filter, true
+}
+
 // GetSubscriptionByID returns a subscription by ID
 func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
     idStr := c.Param("id")
@@ -72,14 +303,15 @@ func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
         return
     }
+    withLogFields(c, "subscription_id", id)
 
-    subscription, err := h.subscriptionService.GetByID(id)
+    subscription, err := h.subscriptionService.GetByID(c.Request.Context(), id)
     if err != nil {
         if err.Error() == "subscription not found" {
             c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
             return
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        internalError(c, h.log, err)
         return
     }
 
@@ -94,6 +326,7 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
         return
     }
+    withLogFields(c, "subscription_id", id)
 
     var req model.CreateSubscriptionRequest
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -108,14 +341,16 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
         UserID:      req.UserID,
         StartDate:   req.StartDate,
         EndDate:     req.EndDate,
+        Category:    req.Category,
+        Tags:        req.Tags,
     }
 
-    if err := h.subscriptionService.Update(subscription); err != nil {
+    if err := h.subscriptionService.Update(c.Request.Context(), subscription); err != nil {
         if err.Error() == "subscription not found" {
             c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
             return
         }
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        serviceError(c, h.log, http.StatusBadRequest, err)
         return
     }
 
@@ -130,50 +365,91 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
         return
     }
+    withLogFields(c, "subscription_id", id)
 
-    if err := h.subscriptionService.Delete(id); err != nil {
+    if err := h.subscriptionService.Delete(c.Request.Context(), id); err != nil {
         if err.Error() == "subscription not found" {
             c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
             return
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        internalError(c, h.log, err)
         return
     }
 
     c.JSON(http.StatusOK, gin.H{"message": "Subscription deleted successfully"})
 }
 
-// CalculateTotalCost calculates total cost with optional filters
+// CalculateTotalCost calculates total cost with optional filters. group_by adds the cost per
+// category, tag or service to JSON responses; exports list the subscriptions as before.
 func (h *SubscriptionHandler) CalculateTotalCost(c *gin.Context) {
-    var userID *uuid.UUID
-    var serviceName *string
-    var period *string
+    filter, ok := subscriptionFilter(c)
+    if !ok {
+        return
+    }
+    groupBy := c.Query("group_by")
 
-    // Parse user_id filter
-    if userIDStr := c.Query("user_id"); userIDStr != "" {
-        parsedUUID, err := uuid.Parse(userIDStr)
+    format, err := negotiateFormat(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if format != export.FormatJSON {
+        h.exportCost(c, format, filter)
+        return
+    }
+
+    // Large tenants only need the totals; include_items=false skips loading their subscriptions
+    includeItems, err := strconv.ParseBool(c.DefaultQuery("include_items", "true"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid include_items value"})
+        return
+    }
+    if !includeItems {
+        summary, err := h.subscriptionService.CostSummary(c.Request.Context(), filter, groupBy)
         if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format"})
+            serviceError(c, h.log, filterStatus(err), err)
             return
         }
-        userID = &parsedUUID
+        c.JSON(http.StatusOK, summary)
+        return
     }
 
-    // Parse service_name filter
-    if serviceNameStr := c.Query("service_name"); serviceNameStr != "" {
-        serviceName = &serviceNameStr
+    result, err := h.subscriptionService.CalculateTotalCost(c.Request.Context(), filter, groupBy)
+    if err != nil {
+        serviceError(c, h.log, filterStatus(err), err)
+        return
     }
 
-    // Parse period filter
-    if periodStr := c.Query("period"); periodStr != "" {
-        period = &periodStr
+    c.JSON(http.StatusOK, result)
+}
+
+func (h *SubscriptionHandler) exportSubscriptions(c *gin.Context, format export.Format, filter model.SubscriptionFilter) {
+    stream := newExportStream(c, format, "subscriptions", export.SubscriptionColumns)
+    err := h.subscriptionService.Iterate(c.Request.Context(), filter, func(sub *model.Subscription) error {
+        return stream.WriteRow(export.SubscriptionRow(sub))
+    })
+    if err == nil {
+        err = stream.Close()
+    }
+    if err != nil {
+        stream.fail(h.log, filterStatus(err), err)
     }
+}
 
-    result, err := h.subscriptionService.CalculateTotalCost(userID, serviceName, period)
+func (h *SubscriptionHandler) exportCost(c *gin.Context, format export.Format, filter model.SubscriptionFilter) {
+    stream := newExportStream(c, format, "subscriptions-cost", export.SubscriptionColumns)
+    summary, err := h.subscriptionService.IterateCost(c.Request.Context(), filter, func(sub *model.Subscription) error {
+        return stream.WriteRow(export.SubscriptionRow(sub))
+    })
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        stream.fail(h.log, filterStatus(err), err)
         return
     }
-
-    c.JSON(http.StatusOK, result)
+    if err := stream.WriteRow(export.CostTotalRow(summary)); err != nil {
+        stream.fail(h.log, http.StatusInternalServerError, err)
+        return
+    }
+    if err := stream.Close(); err != nil {
+        stream.fail(h.log, http.StatusInternalServerError, err)
+    }
 }
\ No newline at end of file
@@ -1,48 +1,82 @@
 package middleware
 
 import (
+    "fmt"
+    "io"
+    "net/http"
     "time"
-    
+
     "github.com/gin-gonic/gin"
     "subscription-service/internal/logger"
 )
 
-// Logger creates a Gin middleware for request logging
-func Logger(logger *logger.Logger) gin.HandlerFunc {
+// PrincipalKey is the Gin context key under which handlers store the authenticated principal
+const PrincipalKey = "principal"
+
+// Logger creates a Gin middleware writing one structured access log entry per request.
+// The entry carries the request's log fields, such as request_id and any fields handlers added.
+func Logger(log *logger.Logger) gin.HandlerFunc {
     return func(c *gin.Context) {
         start := time.Now()
         path := c.Request.URL.Path
-        
+
         // Process request
         c.Next()
-        
+
         // Log request details
-        latency := time.Since(start)
         status := c.Writer.Status()
-        method := c.Request.Method
-        clientIP := c.ClientIP()
-        
-        logger.Infof("%s %s %d %v %s",
-            method,
-            path,
-            status,
-            latency,
-            clientIP,
-        )
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        fields := []interface{}{
+            "method", c.Request.Method,
+            "route", route,
+            "path", path,
+            "status", status,
+            "latency", time.Since(start),
+            "bytes", c.Writer.Size(),
+            "client_ip", c.ClientIP(),
+        }
+        if principal := c.GetString(PrincipalKey); principal != "" {
+            fields = append(fields, "principal", principal)
+        }
+        if len(c.Errors) > 0 {
+            fields = append(fields, "errors", c.Errors.String())
+        }
+
+        entry := log.WithContext(c.Request.Context())
+        switch {
+        case status >= http.StatusInternalServerError:
+            entry.Error("request", fields...)
+        case status >= http.StatusBadRequest:
+            entry.Warn("request", fields...)
+        default:
+            entry.Info("request", fields...)
+        }
     }
 }
 
+// Recovery creates a Gin middleware that turns panics into a logged 500 response
+func Recovery(log *logger.Logger) gin.HandlerFunc {
+    return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+        log.WithContext(c.Request.Context()).Error("panic recovered", "error", fmt.Sprint(recovered), "route", c.FullPath())
+        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+    })
+}
+
 // CORS middleware
 func CORS() gin.HandlerFunc {
     return func(c *gin.Context) {
         c.Header("Access-Control-Allow-Origin", "*")
         c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-        
+        c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, traceparent, tracestate, "+RequestIDHeader)
+        c.Header("Access-Control-Expose-Headers", RequestIDHeader)
+
         if c.Request.Method == "OPTIONS" {
             c.AbortWithStatus(204)
             return
         }
         c.Next()
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+    "math"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "subscription-service/internal/config"
+)
+
+const (
+    // sweepInterval is how often buckets that have refilled are dropped
+    sweepInterval = time.Minute
+    // MaxRateLimitClients bounds the number of buckets kept between sweeps
+    MaxRateLimitClients = 100000
+)
+
+type bucket struct {
+    tokens float64
+    last   time.Time
+}
+
+// RateLimiter limits requests per client IP with a token bucket.
+// Its settings can be changed at runtime with Update. A bucket that has refilled to the burst is
+// the same as a new one, so it is dropped; at most MaxRateLimitClients buckets are kept.
+type RateLimiter struct {
+    mu        sync.Mutex
+    cfg       config.RateLimitConfig
+    clients   map[string]*bucket
+    lastSweep time.Time
+}
+
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+    return &RateLimiter{cfg: cfg, clients: make(map[string]*bucket)}
+}
+
+// Update applies new limits. Existing buckets keep their tokens, capped at the new burst.
+func (l *RateLimiter) Update(cfg config.RateLimitConfig) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.cfg = cfg
+}
+
+// Allow reports whether a request from key may proceed and, if not, how long to wait
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    if !l.cfg.Enabled {
+        return true, 0
+    }
+
+    now := time.Now()
+    burst := float64(l.cfg.Burst)
+    b, ok := l.clients[key]
+    if !ok {
+        if now.Sub(l.lastSweep) >= sweepInterval || len(l.clients) >= MaxRateLimitClients {
+            l.sweep(now)
+        }
+        b = &bucket{tokens: burst, last: now}
+        l.clients[key] = b
+    }
+
+    b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.cfg.RequestsPerSecond)
+    b.last = now
+    if b.tokens < 1 {
+        wait := time.Duration((1 - b.tokens) / l.cfg.RequestsPerSecond * float64(time.Second))
+        return false, wait
+    }
+    b.tokens--
+    return true, 0
+}
+
+// sweep drops the buckets of clients that have been idle long enough to refill. If that leaves
+// MaxRateLimitClients buckets, buckets of clients that are still limited are dropped down to half of it,
+// which lets those clients burst again rather than growing the map without bound.
+func (l *RateLimiter) sweep(now time.Time) {
+    l.lastSweep = now
+    burst := float64(l.cfg.Burst)
+    for key, b := range l.clients {
+        if b.tokens+now.Sub(b.last).Seconds()*l.cfg.RequestsPerSecond >= burst {
+            delete(l.clients, key)
+        }
+    }
+    if len(l.clients) < MaxRateLimitClients {
+        return
+    }
+    for key := range l.clients {
+        if len(l.clients) <= MaxRateLimitClients/2 {
+            break
+        }
+        delete(l.clients, key)
+    }
+}
+
+// Clients returns the number of clients whose bucket is kept
+func (l *RateLimiter) Clients() int {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return len(l.clients)
+}
+
+// RateLimit creates a Gin middleware rejecting requests over the limit with 429. Clients are told
+// apart by gin's ClientIP, which only honors forwarding headers from the engine's trusted proxies.
+// Requests for the exempt paths, such as probes and metric scrapes, are never limited.
+func RateLimit(limiter *RateLimiter, exempt ...string) gin.HandlerFunc {
+    skip := make(map[string]bool, len(exempt))
+    for _, path := range exempt {
+        skip[path] = true
+    }
+    return func(c *gin.Context) {
+        if skip[c.Request.URL.Path] {
+            c.Next()
+            return
+        }
+        if ok, wait := limiter.Allow(c.ClientIP()); !ok {
+            c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+            c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+            return
+        }
+        c.Next()
+    }
+}
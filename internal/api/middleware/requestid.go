@@ -0,0 +1,41 @@
+package middleware
+
+import (
+    "context"
+    "regexp"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "subscription-service/internal/logger"
+)
+
+// RequestIDHeader is the header used to accept and return request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits incoming IDs to a safe length and character set before they reach the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// RequestID creates a Gin middleware that reuses the caller's X-Request-ID or generates one,
+// echoes it in the response and stores it in the request context and its log fields
+func RequestID() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.GetHeader(RequestIDHeader)
+        if !validRequestID.MatchString(id) {
+            id = uuid.NewString()
+        }
+
+        c.Header(RequestIDHeader, id)
+        ctx := context.WithValue(c.Request.Context(), requestIDKey{}, id)
+        ctx = logger.WithFields(ctx, "request_id", id)
+        c.Request = c.Request.WithContext(ctx)
+        c.Next()
+    }
+}
+
+// RequestIDFromContext returns the request ID stored by the RequestID middleware
+func RequestIDFromContext(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+    "go.opentelemetry.io/otel/trace"
+    "subscription-service/internal/logger"
+    "subscription-service/internal/tracing"
+)
+
+// Tracing creates a Gin middleware that starts a server span per request, continuing the trace
+// of an incoming W3C traceparent header, and adds trace_id to the request's log fields
+func Tracing() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+            trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                semconv.HTTPRequestMethodKey.String(c.Request.Method),
+                semconv.HTTPRoute(route),
+                semconv.URLPath(c.Request.URL.Path),
+                semconv.ClientAddress(c.ClientIP()),
+            ),
+        )
+        defer span.End()
+
+        if id := RequestIDFromContext(ctx); id != "" {
+            span.SetAttributes(attribute.String("request_id", id))
+        }
+        if traceID := tracing.TraceID(ctx); traceID != "" {
+            ctx = logger.WithFields(ctx, "trace_id", traceID)
+        }
+        c.Request = c.Request.WithContext(ctx)
+
+        c.Next()
+
+        status := c.Writer.Status()
+        span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+        if status >= http.StatusInternalServerError {
+            span.SetStatus(codes.Error, http.StatusText(status))
+        }
+    }
+}
@@ -0,0 +1,160 @@
+// Package cache caches cost reports in memory or in Redis and invalidates them on writes
+package cache
+
+import (
+    "context"
+    "encoding/json"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "subscription-service/internal/logger"
+    "github.com/google/uuid"
+)
+
+// Store keeps cached values and the generation counters used to invalidate them
+type Store interface {
+    // Get returns the value stored under key; ok is false if there is none or it expired
+    Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+    Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+    // Generation returns the value of a counter, zero if it was never bumped
+    Generation(ctx context.Context, name string) (int64, error)
+    // Bump increments the counters
+    Bump(ctx context.Context, names ...string) error
+}
+
+// CostKey identifies a cost report. The user is the tenant and Period the window.
+type CostKey struct {
+    UserID       *uuid.UUID
+    ServiceName  *string
+    Period       *string
+    Category     *string
+    Tags         []string
+    GroupBy      string
+    IncludeItems bool
+}
+
+// CostCache caches cost reports. Writes bump the generation of the users they touch and of all
+// users together; a report filtered by user is stored under that user's generation and any other
+// report under the generation of all users. Reports computed before a write are therefore never
+// read after it, even if they are stored after it, and expire with the TTL.
+type CostCache struct {
+    store Store
+    ttl   time.Duration
+    log   *logger.Logger
+
+    hits          atomic.Uint64
+    misses        atomic.Uint64
+    errors        atomic.Uint64
+    invalidations atomic.Uint64
+}
+
+// NewCostCache creates a cache keeping reports in store for ttl
+func NewCostCache(store Store, ttl time.Duration, log *logger.Logger) *CostCache {
+    return &CostCache{store: store, ttl: ttl, log: log}
+}
+
+const allUsers = "all"
+
+func generationName(scope string) string {
+    return "cost-generation:" + scope
+}
+
+// Get decodes the report cached for key into dst and reports whether it was found. Store
+// failures count as misses. The returned store key is to be passed to Set with the computed
+// report; it is empty if the report must not be cached.
+func (c *CostCache) Get(ctx context.Context, key CostKey, dst interface{}) (storeKey string, ok bool) {
+    scope := allUsers
+    if key.UserID != nil {
+        scope = key.UserID.String()
+    }
+    generation, err := c.store.Generation(ctx, generationName(scope))
+    if err != nil {
+        c.fail(ctx, "read the cache generation", err)
+        return "", false
+    }
+
+    // Open-ended subscriptions count up to the current month, so reports change when it does
+    month := time.Now().Format("01-2006")
+    parts := []string{"cost", scope, strconv.FormatInt(generation, 10), month, "", "", strconv.FormatBool(key.IncludeItems)}
+    if key.ServiceName != nil {
+        parts[4] = url.QueryEscape(*key.ServiceName)
+    }
+    if key.Period != nil {
+        parts[5] = *key.Period
+    }
+    // Reports with the newer filters get longer keys, so the keys of other reports are unchanged
+    if key.Category != nil || len(key.Tags) > 0 || key.GroupBy != "" {
+        category := ""
+        if key.Category != nil {
+            category = *key.Category
+        }
+        tags := make([]string, len(key.Tags))
+        for i, tag := range key.Tags {
+            tags[i] = url.QueryEscape(tag)
+        }
+        sort.Strings(tags)
+        parts = append(parts, category, strings.Join(tags, ","), key.GroupBy)
+    }
+    storeKey = strings.Join(parts, ":")
+
+    value, found, err := c.store.Get(ctx, storeKey)
+    if err != nil {
+        c.fail(ctx, "read a cost report", err)
+        return storeKey, false
+    }
+    if found && json.Unmarshal(value, dst) == nil {
+        c.hits.Add(1)
+        return storeKey, true
+    }
+    c.misses.Add(1)
+    return storeKey, false
+}
+
+// Set stores a report under a key returned by Get
+func (c *CostCache) Set(ctx context.Context, storeKey string, report interface{}) {
+    if storeKey == "" {
+        return
+    }
+    value, err := json.Marshal(report)
+    if err == nil {
+        err = c.store.Set(ctx, storeKey, value, c.ttl)
+    }
+    if err != nil {
+        c.fail(ctx, "store a cost report", err)
+    }
+}
+
+// Invalidate drops the reports that include subscriptions of users. A failure is logged and
+// leaves stale reports in place until they expire.
+func (c *CostCache) Invalidate(ctx context.Context, users ...uuid.UUID) {
+    names := []string{generationName(allUsers)}
+    for _, user := range users {
+        names = append(names, generationName(user.String()))
+    }
+    if err := c.store.Bump(ctx, names...); err != nil {
+        c.fail(ctx, "invalidate cost reports", err)
+        return
+    }
+    c.invalidations.Add(1)
+}
+
+func (c *CostCache) fail(ctx context.Context, action string, err error) {
+    c.errors.Add(1)
+    c.log.WithContext(ctx).Warn("Cost cache failed to "+action, "error", err)
+}
+
+// Hits returns how many reports were served from the cache
+func (c *CostCache) Hits() uint64 { return c.hits.Load() }
+
+// Misses returns how many reports were not cached and had to be computed
+func (c *CostCache) Misses() uint64 { return c.misses.Load() }
+
+// Errors returns how many cache operations failed
+func (c *CostCache) Errors() uint64 { return c.errors.Load() }
+
+// Invalidations returns how many writes invalidated reports
+func (c *CostCache) Invalidations() uint64 { return c.invalidations.Load() }
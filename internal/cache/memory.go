@@ -0,0 +1,94 @@
+package cache
+
+import (
+    "container/list"
+    "context"
+    "sync"
+    "time"
+)
+
+// MemoryStore is a least recently used cache local to the process
+type MemoryStore struct {
+    mu      sync.Mutex
+    size    int
+    order   *list.List
+    entries map[string]*list.Element
+    // generations are kept apart from the entries, so that eviction never resets a counter
+    // and revives reports stored under an earlier generation
+    generations map[string]int64
+}
+
+type memoryEntry struct {
+    key     string
+    value   []byte
+    expires time.Time
+}
+
+// NewMemoryStore creates a store keeping at most size values
+func NewMemoryStore(size int) *MemoryStore {
+    return &MemoryStore{
+        size:        size,
+        order:       list.New(),
+        entries:     make(map[string]*list.Element),
+        generations: make(map[string]int64),
+    }
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    element, ok := s.entries[key]
+    if !ok {
+        return nil, false, nil
+    }
+    entry := element.Value.(*memoryEntry)
+    if !time.Now().Before(entry.expires) {
+        s.remove(element)
+        return nil, false, nil
+    }
+    s.order.MoveToFront(element)
+    return entry.value, true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    entry := &memoryEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+    if element, ok := s.entries[key]; ok {
+        element.Value = entry
+        s.order.MoveToFront(element)
+        return nil
+    }
+    s.entries[key] = s.order.PushFront(entry)
+    for s.order.Len() > s.size {
+        s.remove(s.order.Back())
+    }
+    return nil
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+    s.order.Remove(element)
+    delete(s.entries, element.Value.(*memoryEntry).key)
+}
+
+// Len returns the number of values stored, including expired ones not yet evicted
+func (s *MemoryStore) Len() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.order.Len()
+}
+
+func (s *MemoryStore) Generation(ctx context.Context, name string) (int64, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.generations[name], nil
+}
+
+func (s *MemoryStore) Bump(ctx context.Context, names ...string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, name := range names {
+        s.generations[name]++
+    }
+    return nil
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+)
+
+// redisPrefix namespaces the service's keys in a shared Redis
+const redisPrefix = "subscription-service:"
+
+// RedisStore keeps values in Redis, so that all instances share them. Values expire in Redis;
+// the generation counters do not expire and must not be evicted, so the instance should not use
+// an allkeys eviction policy.
+type RedisStore struct {
+    client *redis.Client
+}
+
+// NewRedisStore connects to the server at rawURL, such as redis://:password@localhost:6379/0
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+    opts, err := redis.ParseURL(rawURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid Redis URL: %w", err)
+    }
+    return &RedisStore{client: redis.NewClient(opts)}, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+    value, err := s.client.Get(ctx, redisPrefix+key).Bytes()
+    if errors.Is(err, redis.Nil) {
+        return nil, false, nil
+    }
+    if err != nil {
+        return nil, false, err
+    }
+    return value, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+    return s.client.Set(ctx, redisPrefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Generation(ctx context.Context, name string) (int64, error) {
+    generation, err := s.client.Get(ctx, redisPrefix+name).Int64()
+    if errors.Is(err, redis.Nil) {
+        return 0, nil
+    }
+    return generation, err
+}
+
+func (s *RedisStore) Bump(ctx context.Context, names ...string) error {
+    _, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+        for _, name := range names {
+            pipe.Incr(ctx, redisPrefix+name)
+        }
+        return nil
+    })
+    return err
+}
+
+// Ping checks that Redis answers, for the readiness probe
+func (s *RedisStore) Ping(ctx context.Context) error {
+    return s.client.Ping(ctx).Err()
+}
+
+// Close closes the connection pool
+func (s *RedisStore) Close() error {
+    return s.client.Close()
+}
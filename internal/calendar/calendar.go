@@ -0,0 +1,118 @@
+package calendar
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+
+    "subscription-service/internal/model"
+)
+
+const (
+    prodID    = "-//Subscription Service//Renewals//EN"
+    uidDomain = "subscription-service"
+    dateFmt   = "20060102"
+)
+
+// WriteFeed writes an RFC 5545 calendar with a monthly recurring renewal event
+// for each subscription and an all-day event on the last day of its end month
+func WriteFeed(w io.Writer, name string, subscriptions []model.Subscription) error {
+    bw := bufio.NewWriter(w)
+    lw := &lineWriter{w: bw}
+
+    lw.line("BEGIN:VCALENDAR")
+    lw.line("VERSION:2.0")
+    lw.line("PRODID:" + prodID)
+    lw.line("CALSCALE:GREGORIAN")
+    lw.line("METHOD:PUBLISH")
+    lw.line("X-WR-CALNAME:" + escapeText(name))
+
+    for i := range subscriptions {
+        writeEvents(lw, &subscriptions[i])
+    }
+
+    lw.line("END:VCALENDAR")
+    if lw.err != nil {
+        return lw.err
+    }
+    return bw.Flush()
+}
+
+func writeEvents(lw *lineWriter, sub *model.Subscription) {
+    start, err := parseMonth(sub.StartDate)
+    if err != nil {
+        return
+    }
+    stamp := sub.UpdatedAt.UTC().Format("20060102T150405Z")
+
+    rule := "FREQ=MONTHLY"
+    var end time.Time
+    if sub.EndDate != nil {
+        if end, err = parseMonth(*sub.EndDate); err == nil {
+            rule += ";UNTIL=" + end.Format(dateFmt)
+        }
+    }
+
+    lw.line("BEGIN:VEVENT")
+    lw.line(fmt.Sprintf("UID:subscription-%d-renewal@%s", sub.ID, uidDomain))
+    lw.line("DTSTAMP:" + stamp)
+    lw.line("DTSTART;VALUE=DATE:" + start.Format(dateFmt))
+    lw.line("DTEND;VALUE=DATE:" + start.AddDate(0, 0, 1).Format(dateFmt))
+    lw.line("RRULE:" + rule)
+    lw.line("SUMMARY:" + escapeText(fmt.Sprintf("%s renewal (%d ₽)", sub.ServiceName, sub.Price)))
+    lw.line("TRANSP:TRANSPARENT")
+    lw.line("END:VEVENT")
+
+    if end.IsZero() {
+        return
+    }
+    // The end date is the last paid month, so the subscription ends on that month's last day
+    last := end.AddDate(0, 1, -1)
+    lw.line("BEGIN:VEVENT")
+    lw.line(fmt.Sprintf("UID:subscription-%d-end@%s", sub.ID, uidDomain))
+    lw.line("DTSTAMP:" + stamp)
+    lw.line("DTSTART;VALUE=DATE:" + last.Format(dateFmt))
+    lw.line("DTEND;VALUE=DATE:" + last.AddDate(0, 0, 1).Format(dateFmt))
+    lw.line("SUMMARY:" + escapeText(sub.ServiceName+" subscription ends"))
+    lw.line("TRANSP:TRANSPARENT")
+    lw.line("END:VEVENT")
+}
+
+// parseMonth parses the MM-YYYY format used by subscriptions
+func parseMonth(value string) (time.Time, error) {
+    return time.Parse("01-2006", value)
+}
+
+// escapeText escapes a TEXT property value (RFC 5545 section 3.3.11)
+func escapeText(s string) string {
+    return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// lineWriter writes content lines terminated by CRLF and folded at 75 octets
+type lineWriter struct {
+    w   *bufio.Writer
+    err error
+}
+
+func (lw *lineWriter) line(s string) {
+    if lw.err != nil {
+        return
+    }
+    // Continuation lines start with a space, which counts towards the limit
+    limit := 75
+    for len(s) > limit {
+        cut := limit
+        // Never split a multi-byte UTF-8 sequence
+        for s[cut]&0xC0 == 0x80 {
+            cut--
+        }
+        if _, lw.err = lw.w.WriteString(s[:cut] + "\r\n "); lw.err != nil {
+            return
+        }
+        s = s[cut:]
+        limit = 74
+    }
+    _, lw.err = lw.w.WriteString(s + "\r\n")
+}
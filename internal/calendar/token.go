@@ -0,0 +1,31 @@
+package calendar
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+
+    "github.com/google/uuid"
+)
+
+// TokenSigner issues and verifies per-user feed tokens. Tokens are an HMAC of the user ID,
+// so they need no storage and are rotated for everyone by changing the secret.
+type TokenSigner struct {
+    secret []byte
+}
+
+func NewTokenSigner(secret string) *TokenSigner {
+    return &TokenSigner{secret: []byte(secret)}
+}
+
+// Token returns the feed token for a user
+func (s *TokenSigner) Token(userID uuid.UUID) string {
+    mac := hmac.New(sha256.New, s.secret)
+    mac.Write(userID[:])
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether token is valid for the user
+func (s *TokenSigner) Verify(userID uuid.UUID, token string) bool {
+    return hmac.Equal([]byte(s.Token(userID)), []byte(token))
+}
@@ -0,0 +1,170 @@
+// Package catalog matches the free-text service names of subscriptions against the entries of
+// the service catalog, so that "Yandex Plus", "yandex plus" and "Яндекс Плюс" are one service.
+package catalog
+
+import (
+    "strings"
+    "unicode"
+
+    "subscription-service/internal/model"
+)
+
+// Normalize folds case and whitespace: "  Yandex   PLUS " becomes "yandex plus". Names that
+// normalize the same are the same service.
+func Normalize(name string) string {
+    return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// cyrillic transliterates lowercase Russian letters the way service names are usually
+// spelled in Latin
+var cyrillic = map[rune]string{
+    'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+    'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+    'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+    'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+    'я': "ya",
+}
+
+// fold reduces a name to lowercase letters and digits for fuzzy comparison. Cyrillic is
+// transliterated, and "ks" is written as "x" on both sides, so "Яндекс" folds like "Yandex".
+func fold(name string) string {
+    var b strings.Builder
+    for _, r := range strings.ToLower(name) {
+        if latin, ok := cyrillic[r]; ok {
+            b.WriteString(latin)
+        } else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            b.WriteRune(r)
+        }
+    }
+    return strings.ReplaceAll(b.String(), "ks", "x")
+}
+
+// minFuzzyLength is the shortest folded name matched with typos; shorter names are too
+// close to each other, like "hulu" and "lulu"
+const minFuzzyLength = 5
+
+// Match returns the entry of services that name refers to. A name or alias that normalizes the
+// same wins. Otherwise the entry whose folded name or alias is closest to the folded name is
+// chosen, if it is at most one edit per four characters away and no other entry is as close.
+func Match(name string, services []model.Service) (model.Service, bool) {
+    normalized := Normalize(name)
+    if normalized == "" {
+        return model.Service{}, false
+    }
+    for _, service := range services {
+        for _, candidate := range names(service) {
+            if Normalize(candidate) == normalized {
+                return service, true
+            }
+        }
+    }
+
+    folded := []rune(fold(name))
+    best, bestDistance, ambiguous := -1, 0, false
+    for i, service := range services {
+        distance := -1
+        for _, candidate := range names(service) {
+            other := []rune(fold(candidate))
+            d := levenshtein(folded, other)
+            longest := len(folded)
+            if len(other) > longest {
+                longest = len(other)
+            }
+            if d > 0 && (len(folded) < minFuzzyLength || len(other) < minFuzzyLength || d > longest/4) {
+                continue
+            }
+            if distance < 0 || d < distance {
+                distance = d
+            }
+        }
+        switch {
+        case distance < 0:
+        case best < 0 || distance < bestDistance:
+            best, bestDistance, ambiguous = i, distance, false
+        case distance == bestDistance:
+            ambiguous = true
+        }
+    }
+    if best < 0 || ambiguous {
+        return model.Service{}, false
+    }
+    return services[best], true
+}
+
+// Seed returns the entries to add to services so that every name of names, most used first,
+// matches one. A name that matches no entry and no earlier name becomes an entry, trimmed, so
+// each service is named after its most used spelling. The entries never Conflict.
+func Seed(services []model.Service, names []string) []model.Service {
+    known := append([]model.Service{}, services...)
+    var added []model.Service
+    for _, name := range names {
+        name = strings.TrimSpace(name)
+        if name == "" {
+            continue
+        }
+        if _, ok := Match(name, known); ok {
+            continue
+        }
+        entry := model.Service{Name: name, Aliases: []string{}}
+        known = append(known, entry)
+        added = append(added, entry)
+    }
+    return added
+}
+
+// Conflict returns the name or alias of service that another entry of services already uses,
+// compared after folding, or "" if there is none. Entries with the same ID as service are skipped,
+// so an entry can be checked against the catalog it is already part of.
+func Conflict(service model.Service, services []model.Service) string {
+    used := make(map[string]bool)
+    for _, other := range services {
+        if other.ID == service.ID {
+            continue
+        }
+        for _, name := range names(other) {
+            used[fold(name)] = true
+        }
+    }
+    for _, name := range names(service) {
+        if key := fold(name); key != "" && used[key] {
+            return name
+        }
+    }
+    return ""
+}
+
+// names returns the name of service followed by its aliases
+func names(service model.Service) []string {
+    return append([]string{service.Name}, service.Aliases...)
+}
+
+// levenshtein counts the single-character insertions, deletions and substitutions that turn a into b
+func levenshtein(a, b []rune) int {
+    previous := make([]int, len(b)+1)
+    current := make([]int, len(b)+1)
+    for j := range previous {
+        previous[j] = j
+    }
+    for i := 1; i <= len(a); i++ {
+        current[0] = i
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+            current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+        }
+        previous, current = current, previous
+    }
+    return previous[len(b)]
+}
+
+func min(values ...int) int {
+    result := values[0]
+    for _, v := range values[1:] {
+        if v < result {
+            result = v
+        }
+    }
+    return result
+}
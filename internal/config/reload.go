@@ -0,0 +1,128 @@
+package config
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "reflect"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// Reloader keeps the current configuration and re-reads it on demand, on SIGHUP or when the
+// configuration file changes. Only the reloadable settings (log level and rate limit) are applied;
+// everything else needs a restart and is reported as ignored.
+type Reloader struct {
+    args []string
+
+    mu          sync.RWMutex
+    current     *Config
+    subscribers []func(*Config)
+}
+
+// NewReloader creates a reloader starting from cfg. args are the command-line arguments
+// that cfg was loaded with, so reloads honor the same flags.
+func NewReloader(cfg *Config, args []string) *Reloader {
+    return &Reloader{args: args, current: cfg}
+}
+
+// Current returns the configuration in effect. The returned value must not be modified.
+func (r *Reloader) Current() *Config {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    return r.current
+}
+
+// Subscribe registers fn to be called with the new configuration after every successful reload
+func (r *Reloader) Subscribe(fn func(*Config)) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.subscribers = append(r.subscribers, fn)
+}
+
+// Reload loads and validates the configuration again. If it is invalid the current configuration
+// stays in effect and the error is returned. Otherwise the reloadable settings are applied and
+// published to subscribers, and the names of changed settings that need a restart are returned.
+func (r *Reloader) Reload() (ignored []string, err error) {
+    next, err := LoadConfig(r.args)
+    if err != nil {
+        return nil, err
+    }
+
+    r.mu.Lock()
+    updated := *r.current
+    updated.Logging.Level = next.Logging.Level
+    updated.RateLimit = next.RateLimit
+
+    // Whatever still differs could not be applied
+    ignored = diffSections(&updated, next)
+
+    r.current = &updated
+    subscribers := append([]func(*Config){}, r.subscribers...)
+    r.mu.Unlock()
+
+    for _, fn := range subscribers {
+        fn(&updated)
+    }
+    return ignored, nil
+}
+
+// Watch reloads the configuration on SIGHUP and whenever the configuration file's modification
+// time changes, checking every interval. onReload is called with the outcome of each reload.
+// Watch blocks until ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onReload func(ignored []string, err error)) {
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    defer signal.Stop(hup)
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    lastMod := r.fileModTime()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-hup:
+            lastMod = r.fileModTime()
+            onReload(r.Reload())
+        case <-ticker.C:
+            mod := r.fileModTime()
+            if mod.Equal(lastMod) {
+                continue
+            }
+            lastMod = mod
+            onReload(r.Reload())
+        }
+    }
+}
+
+func (r *Reloader) fileModTime() time.Time {
+    file := r.Current().File()
+    if file == "" {
+        file = DefaultConfigFile
+    }
+    info, err := os.Stat(file)
+    if err != nil {
+        return time.Time{}
+    }
+    return info.ModTime()
+}
+
+// diffSections returns the YAML names of the top-level sections that differ between a and b
+func diffSections(a, b *Config) []string {
+    var changed []string
+    va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+    t := va.Type()
+    for i := 0; i < t.NumField(); i++ {
+        name := t.Field(i).Tag.Get("yaml")
+        if name == "" {
+            continue
+        }
+        if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+            changed = append(changed, name)
+        }
+    }
+    return changed
+}
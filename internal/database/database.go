@@ -0,0 +1,102 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+
+    "subscription-service/internal/config"
+    "subscription-service/internal/logger"
+)
+
+// Startup retry backoff; the delay doubles after every failed attempt up to maxBackoff
+var (
+    initialBackoff = 250 * time.Millisecond
+    maxBackoff     = 5 * time.Second
+)
+
+// sqlitePragmas are applied to every SQLite connection: wait for locks instead of failing with
+// SQLITE_BUSY, let readers run alongside the writer, and take the write lock when a transaction
+// begins so concurrent batches queue up rather than deadlock
+var sqlitePragmas = url.Values{
+    "_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"},
+    "_txlock": {"immediate"},
+}
+
+// Open creates the pool for the PostgreSQL or SQLite database described by cfg and waits until it
+// answers, retrying with exponential backoff for up to cfg.ConnectTimeout or until ctx is done
+func Open(ctx context.Context, cfg config.DatabaseConfig, log *logger.Logger) (*sql.DB, error) {
+    driver, dsn := "postgres", cfg.DSN()
+    if cfg.Driver() == config.DriverSQLite {
+        driver, dsn = "sqlite", sqliteDSN(cfg)
+    }
+    db, err := sql.Open(driver, dsn)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open database: %w", err)
+    }
+    Configure(db, cfg)
+
+    if err := Connect(ctx, db, cfg.ConnectTimeout, log); err != nil {
+        db.Close()
+        return nil, err
+    }
+    return db, nil
+}
+
+// sqliteDSN converts a sqlite:// URL into a data source name for modernc.org/sqlite,
+// keeping any query parameters of the URL
+func sqliteDSN(cfg config.DatabaseConfig) string {
+    query := url.Values{}
+    if i := strings.IndexByte(cfg.URL, '?'); i >= 0 {
+        query, _ = url.ParseQuery(cfg.URL[i+1:])
+    }
+    for key, values := range sqlitePragmas {
+        if _, ok := query[key]; !ok || key == "_pragma" {
+            query[key] = append(query[key], values...)
+        }
+    }
+    return "file:" + cfg.SQLitePath() + "?" + query.Encode()
+}
+
+// Configure applies the pool limits of cfg to db
+func Configure(db *sql.DB, cfg config.DatabaseConfig) {
+    db.SetMaxOpenConns(cfg.MaxOpenConns)
+    db.SetMaxIdleConns(cfg.MaxIdleConns)
+    db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+    db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// Connect pings db until it answers, waiting between attempts with exponential backoff.
+// It gives up once timeout has elapsed or ctx is done and returns the last ping error.
+func Connect(ctx context.Context, db *sql.DB, timeout time.Duration, log *logger.Logger) error {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    backoff := initialBackoff
+    for attempt := 1; ; attempt++ {
+        err := db.PingContext(ctx)
+        if err == nil {
+            if attempt > 1 {
+                log.Info("Database connection established after retrying", "attempts", attempt)
+            }
+            return nil
+        }
+        if ctx.Err() != nil {
+            return fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+        }
+
+        log.Warn("Database not reachable, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+        select {
+        case <-time.After(backoff):
+        case <-ctx.Done():
+            return fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+        }
+        backoff *= 2
+        if backoff > maxBackoff {
+            backoff = maxBackoff
+        }
+    }
+}
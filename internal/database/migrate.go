@@ -0,0 +1,74 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io/fs"
+
+    "subscription-service/db/migrations"
+)
+
+// Migrate applies the up migrations in fsys that are newer than the schema version and records
+// the version in schema_migrations the way golang-migrate does, so the readiness check works the
+// same for every backend. Each migration runs in its own transaction. It is used for SQLite, which
+// is meant to run as a single binary without the migrate tool.
+func Migrate(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+    list, err := migrations.List(fsys)
+    if err != nil {
+        return err
+    }
+
+    if _, err := db.ExecContext(ctx,
+        "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)"); err != nil {
+        return fmt.Errorf("failed to create schema_migrations: %w", err)
+    }
+    var current int64
+    var dirty bool
+    err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&current, &dirty)
+    switch {
+    case errors.Is(err, sql.ErrNoRows):
+    case err != nil:
+        return fmt.Errorf("failed to read schema version: %w", err)
+    case dirty:
+        return fmt.Errorf("migration %d failed and left the schema dirty", current)
+    }
+
+    for _, m := range list {
+        if m.Version <= current {
+            continue
+        }
+        if err := applyMigration(ctx, db, fsys, m); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, fsys fs.FS, m migrations.Migration) error {
+    script, err := fs.ReadFile(fsys, m.Name)
+    if err != nil {
+        return fmt.Errorf("failed to read migration %s: %w", m.Name, err)
+    }
+
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+        return fmt.Errorf("migration %s failed: %w", m.Name, err)
+    }
+    if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+        return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+    }
+    if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)", m.Version); err != nil {
+        return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+    }
+    return nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "subscription-service/internal/logger"
+)
+
+// Monitor tracks whether the database is reachable. database/sql reconnects on its own;
+// the monitor makes outages and recoveries visible in the logs, readiness and metrics.
+type Monitor struct {
+    db  *sql.DB
+    log *logger.Logger
+
+    mu         sync.Mutex
+    up         bool
+    downSince  time.Time
+    reconnects uint64
+}
+
+// NewMonitor creates a monitor for db, which is assumed to be reachable
+func NewMonitor(db *sql.DB, log *logger.Logger) *Monitor {
+    return &Monitor{db: db, log: log, up: true}
+}
+
+// Ping checks the database and records state changes. It is used as the readiness check,
+// so a failure reports for how long the database has been unreachable.
+func (m *Monitor) Ping(ctx context.Context) error {
+    err := m.db.PingContext(ctx)
+    if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+        // The caller went away; that says nothing about the database
+        return err
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    switch {
+    case err != nil && m.up:
+        m.up = false
+        m.downSince = time.Now()
+        m.log.Error("Database connection lost", "error", err)
+    case err == nil && !m.up:
+        m.up = true
+        m.reconnects++
+        m.log.Info("Database connection restored", "downtime", time.Since(m.downSince).Round(time.Millisecond))
+    }
+
+    if err != nil {
+        return fmt.Errorf("unreachable for %v: %w", time.Since(m.downSince).Round(time.Second), err)
+    }
+    return nil
+}
+
+// Run pings the database every interval until ctx is done
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            pingCtx, cancel := context.WithTimeout(ctx, interval)
+            _ = m.Ping(pingCtx)
+            cancel()
+        }
+    }
+}
+
+// Up reports whether the last ping succeeded
+func (m *Monitor) Up() bool {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.up
+}
+
+// Reconnects returns how many times the connection was restored after an outage
+func (m *Monitor) Reconnects() uint64 {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.reconnects
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "subscription-service/internal/config"
+    "subscription-service/internal/logger"
+)
+
+// replicaLagQuery measures how far a standby is behind the primary. A standby that has replayed
+// everything it received is up to date even if the primary has been idle for a while, and a
+// server that is not in recovery has no lag at all.
+const replicaLagQuery = `SELECT CASE
+    WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// Replica tracks whether a read-only PostgreSQL replica can serve reads: it must answer and be
+// no more than maxLag behind the primary. It is unusable until the first successful check.
+type Replica struct {
+    db     *sql.DB
+    maxLag time.Duration
+    log    *logger.Logger
+
+    mu     sync.Mutex
+    usable bool
+    lag    time.Duration
+}
+
+// OpenReplica creates the pool for the replica at cfg.ReplicaURL with the pool limits of cfg.
+// It does not wait for the replica to answer; reads go to the primary until it does.
+func OpenReplica(cfg config.DatabaseConfig, log *logger.Logger) (*Replica, error) {
+    db, err := sql.Open("postgres", cfg.ReplicaURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open replica: %w", err)
+    }
+    Configure(db, cfg)
+    return NewReplica(db, cfg.ReplicaMaxLag, log), nil
+}
+
+// NewReplica creates a replica for db that is usable while it lags at most maxLag behind
+func NewReplica(db *sql.DB, maxLag time.Duration, log *logger.Logger) *Replica {
+    return &Replica{db: db, maxLag: maxLag, log: log}
+}
+
+// DB returns the replica's pool
+func (r *Replica) DB() *sql.DB {
+    return r.db
+}
+
+// Usable reports whether the last check found the replica reachable and close enough
+// to the primary, and no query has failed on it since
+func (r *Replica) Usable() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.usable
+}
+
+// Lag returns the replication lag measured by the last successful check
+func (r *Replica) Lag() time.Duration {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.lag
+}
+
+// Failed marks the replica unusable after a query failed on it; the next successful check
+// puts it back into use
+func (r *Replica) Failed(err error) {
+    r.setUsable(false, "query failed", err)
+}
+
+// Check measures the replication lag and records whether the replica is usable. It is used as the
+// readiness check of the replica, so a failure says why reads currently go to the primary.
+func (r *Replica) Check(ctx context.Context) error {
+    var seconds float64
+    err := r.db.QueryRowContext(ctx, replicaLagQuery).Scan(&seconds)
+    if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+        // The caller went away; that says nothing about the replica
+        return err
+    }
+    if err != nil {
+        r.setUsable(false, "unreachable", err)
+        return fmt.Errorf("unreachable, reading from the primary: %w", err)
+    }
+
+    lag := time.Duration(seconds * float64(time.Second))
+    r.mu.Lock()
+    r.lag = lag
+    r.mu.Unlock()
+    if lag > r.maxLag {
+        err := fmt.Errorf("%v behind the primary, more than %v", lag.Round(time.Millisecond), r.maxLag)
+        r.setUsable(false, "lagging", err)
+        return fmt.Errorf("reading from the primary: %w", err)
+    }
+    r.setUsable(true, "", nil)
+    return nil
+}
+
+// setUsable records the replica's state and logs when it changes
+func (r *Replica) setUsable(usable bool, reason string, err error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if usable == r.usable {
+        return
+    }
+    r.usable = usable
+    if usable {
+        r.log.Info("Database replica in use", "lag", r.lag.Round(time.Millisecond))
+        return
+    }
+    r.log.Warn("Database replica not in use, reading from the primary", "reason", reason, "error", err)
+}
+
+// Run checks the replica right away and then every interval until ctx is done
+func (r *Replica) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        checkCtx, cancel := context.WithTimeout(ctx, interval)
+        _ = r.Check(checkCtx)
+        cancel()
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
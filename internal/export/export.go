@@ -0,0 +1,163 @@
+package export
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Format identifies an export file format
+type Format string
+
+const (
+    FormatJSON   Format = "json"
+    FormatCSV    Format = "csv"
+    FormatXLSX   Format = "xlsx"
+    FormatNDJSON Format = "ndjson"
+)
+
+// ContentType returns the MIME type used when serving the format
+func (f Format) ContentType() string {
+    switch f {
+    case FormatCSV:
+        return "text/csv; charset=utf-8"
+    case FormatXLSX:
+        return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+    case FormatNDJSON:
+        return "application/x-ndjson"
+    default:
+        return "application/json; charset=utf-8"
+    }
+}
+
+// Extension returns the file extension used in download file names
+func (f Format) Extension() string {
+    if f == FormatNDJSON {
+        return "jsonl"
+    }
+    return string(f)
+}
+
+// ParseFormat resolves a format= query value
+func ParseFormat(value string) (Format, error) {
+    switch strings.ToLower(value) {
+    case "json":
+        return FormatJSON, nil
+    case "csv":
+        return FormatCSV, nil
+    case "xlsx", "excel":
+        return FormatXLSX, nil
+    case "ndjson", "jsonl":
+        return FormatNDJSON, nil
+    default:
+        return "", fmt.Errorf("unsupported format %q", value)
+    }
+}
+
+// FormatFromAccept picks the first supported format listed in an Accept header.
+// It returns FormatJSON when nothing more specific is requested.
+func FormatFromAccept(accept string) Format {
+    for _, part := range strings.Split(accept, ",") {
+        mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+        switch strings.ToLower(mediaType) {
+        case "text/csv":
+            return FormatCSV
+        case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+            return FormatXLSX
+        case "application/x-ndjson", "application/jsonl", "application/json-lines":
+            return FormatNDJSON
+        case "application/json":
+            return FormatJSON
+        }
+    }
+    return FormatJSON
+}
+
+// Writer writes rows of a table one at a time
+type Writer interface {
+    WriteRow(values []interface{}) error
+    Close() error
+}
+
+// NewWriter creates a streaming writer for the given tabular format and writes the header.
+// Values may be strings, ints or nil.
+func NewWriter(format Format, w io.Writer, columns []string) (Writer, error) {
+    switch format {
+    case FormatCSV:
+        return newCSVWriter(w, columns)
+    case FormatXLSX:
+        return newXLSXWriter(w, columns)
+    case FormatNDJSON:
+        return &ndjsonWriter{enc: json.NewEncoder(w), columns: columns}, nil
+    default:
+        return nil, fmt.Errorf("format %q is not a streaming format", format)
+    }
+}
+
+type csvWriter struct {
+    w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+    cw := &csvWriter{w: csv.NewWriter(w)}
+    if err := cw.w.Write(columns); err != nil {
+        return nil, err
+    }
+    return cw, nil
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+    record := make([]string, len(values))
+    for i, v := range values {
+        if v != nil {
+            record[i] = fmt.Sprint(v)
+        }
+    }
+    if err := c.w.Write(record); err != nil {
+        return err
+    }
+    // Flush every row so the client receives data as it is read from the database
+    c.w.Flush()
+    return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+    c.w.Flush()
+    return c.w.Error()
+}
+
+type ndjsonWriter struct {
+    enc     *json.Encoder
+    columns []string
+}
+
+func (n *ndjsonWriter) WriteRow(values []interface{}) error {
+    // Build the object by hand to keep the column order stable
+    var b strings.Builder
+    b.WriteByte('{')
+    for i, column := range n.columns {
+        if i > 0 {
+            b.WriteByte(',')
+        }
+        key, _ := json.Marshal(column)
+        var value interface{}
+        if i < len(values) {
+            value = values[i]
+        }
+        val, err := json.Marshal(value)
+        if err != nil {
+            return err
+        }
+        b.Write(key)
+        b.WriteByte(':')
+        b.Write(val)
+    }
+    b.WriteByte('}')
+    return n.enc.Encode(json.RawMessage(b.String()))
+}
+
+func (n *ndjsonWriter) Close() error {
+    return nil
+}
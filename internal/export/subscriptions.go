@@ -0,0 +1,42 @@
+package export
+
+import (
+    "strings"
+    "time"
+
+    "subscription-service/internal/model"
+)
+
+// SubscriptionColumns is the header used for subscription exports
+var SubscriptionColumns = []string{"id", "service_name", "price", "user_id", "start_date", "end_date", "created_at", "updated_at", "category", "tags"}
+
+// TagSeparator joins the tags of a subscription in a single cell, as the CSV import splits them
+const TagSeparator = ";"
+
+// SubscriptionRow converts a subscription to a row matching SubscriptionColumns
+func SubscriptionRow(sub *model.Subscription) []interface{} {
+    var endDate, category interface{}
+    if sub.EndDate != nil {
+        endDate = *sub.EndDate
+    }
+    if sub.Category != nil {
+        category = *sub.Category
+    }
+    return []interface{}{
+        sub.ID,
+        sub.ServiceName,
+        sub.Price,
+        sub.UserID.String(),
+        sub.StartDate,
+        endDate,
+        sub.CreatedAt.Format(time.RFC3339),
+        sub.UpdatedAt.Format(time.RFC3339),
+        category,
+        strings.Join(sub.Tags, TagSeparator),
+    }
+}
+
+// CostTotalRow returns the summary row appended to cost exports
+func CostTotalRow(summary *model.SummaryCostResponse) []interface{} {
+    return []interface{}{nil, "TOTAL", summary.TotalCost, nil, summary.Period, nil, nil, nil, nil, nil}
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+    "archive/zip"
+    "bufio"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Static parts of a minimal single-sheet workbook. Cells use inline strings,
+// so no shared string table is needed and rows can be streamed straight into the archive.
+const (
+    xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+        `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+        `<Default Extension="xml" ContentType="application/xml"/>` +
+        `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+        `<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+        `</Types>`
+    xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+        `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+        `</Relationships>`
+    xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+        `<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+        `</workbook>`
+    xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+        `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+        `</Relationships>`
+    xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+    xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+    zw    *zip.Writer
+    sheet *bufio.Writer
+    row   int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) (*xlsxWriter, error) {
+    zw := zip.NewWriter(w)
+
+    parts := []struct{ name, body string }{
+        {"[Content_Types].xml", xlsxContentTypes},
+        {"_rels/.rels", xlsxRootRels},
+        {"xl/workbook.xml", xlsxWorkbook},
+        {"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+    }
+    for _, part := range parts {
+        f, err := zw.Create(part.name)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := io.WriteString(f, part.body); err != nil {
+            return nil, err
+        }
+    }
+
+    // The sheet must be the last entry since it stays open while rows are written
+    f, err := zw.Create("xl/worksheets/sheet1.xml")
+    if err != nil {
+        return nil, err
+    }
+    xw := &xlsxWriter{zw: zw, sheet: bufio.NewWriter(f)}
+    if _, err := xw.sheet.WriteString(xlsxSheetHeader); err != nil {
+        return nil, err
+    }
+
+    header := make([]interface{}, len(columns))
+    for i, column := range columns {
+        header[i] = column
+    }
+    if err := xw.WriteRow(header); err != nil {
+        return nil, err
+    }
+    return xw, nil
+}
+
+func (x *xlsxWriter) WriteRow(values []interface{}) error {
+    x.row++
+    fmt.Fprintf(x.sheet, `<row r="%d">`, x.row)
+    for i, v := range values {
+        ref := columnName(i) + fmt.Sprint(x.row)
+        switch val := v.(type) {
+        case nil:
+            continue
+        case int:
+            fmt.Fprintf(x.sheet, `<c r="%s"><v>%d</v></c>`, ref, val)
+        default:
+            fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t>`, ref)
+            if err := xml.EscapeText(x.sheet, []byte(fmt.Sprint(val))); err != nil {
+                return err
+            }
+            x.sheet.WriteString(`</t></is></c>`)
+        }
+    }
+    _, err := x.sheet.WriteString(`</row>`)
+    return err
+}
+
+func (x *xlsxWriter) Close() error {
+    if _, err := x.sheet.WriteString(xlsxSheetFooter); err != nil {
+        return err
+    }
+    if err := x.sheet.Flush(); err != nil {
+        return err
+    }
+    return x.zw.Close()
+}
+
+// columnName converts a zero-based column index to a spreadsheet column name (A, B, ..., AA)
+func columnName(i int) string {
+    var b strings.Builder
+    for i++; i > 0; i = (i - 1) / 26 {
+        b.WriteByte(byte('A' + (i-1)%26))
+    }
+    name := []byte(b.String())
+    for l, r := 0, len(name)-1; l < r; l, r = l+1, r-1 {
+        name[l], name[r] = name[r], name[l]
+    }
+    return string(name)
+}
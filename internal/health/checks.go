@@ -0,0 +1,60 @@
+package health
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io/fs"
+    "strings"
+
+    "subscription-service/db/migrations"
+    "github.com/lib/pq"
+)
+
+// Ping checks that the database accepts connections
+func Ping(db *sql.DB) Check {
+    return func(ctx context.Context) error {
+        return db.PingContext(ctx)
+    }
+}
+
+// LatestMigration returns the highest version among the up migrations in fsys
+func LatestMigration(fsys fs.FS) (int64, error) {
+    list, err := migrations.List(fsys)
+    if err != nil || len(list) == 0 {
+        return 0, err
+    }
+    return list[len(list)-1].Version, nil
+}
+
+// Migrations fails while the schema version recorded by golang-migrate (or database.Migrate for SQLite)
+// in schema_migrations
+// is behind the newest migration shipped with the service, or when a migration failed halfway
+func Migrations(db *sql.DB, fsys fs.FS) Check {
+    latest, latestErr := LatestMigration(fsys)
+    return func(ctx context.Context) error {
+        if latestErr != nil {
+            return latestErr
+        }
+
+        var version int64
+        var dirty bool
+        err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+        var pqErr *pq.Error
+        switch {
+        case errors.As(err, &pqErr) && pqErr.Code == "42P01",
+            err != nil && strings.Contains(err.Error(), "no such table: schema_migrations"):
+            return fmt.Errorf("schema_migrations table not found, migrations up to %d are pending", latest)
+        case errors.Is(err, sql.ErrNoRows):
+            return fmt.Errorf("no migrations applied, latest is %d", latest)
+        case err != nil:
+            return fmt.Errorf("failed to read schema version: %w", err)
+        case dirty:
+            return fmt.Errorf("migration %d failed and left the schema dirty", version)
+        case version < latest:
+            return fmt.Errorf("schema is at version %d, latest is %d", version, latest)
+        }
+        return nil
+    }
+}
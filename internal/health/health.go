@@ -0,0 +1,134 @@
+package health
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Check reports whether a dependency is usable; it must return promptly once ctx is done
+type Check func(ctx context.Context) error
+
+// Status values reported by the checker
+const (
+    StatusOK       = "ok"
+    StatusFail     = "fail"
+    StatusReady    = "ready"
+    StatusNotReady = "not_ready"
+    StatusDegraded = "degraded"
+    StatusDraining = "draining"
+)
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+    Status     string `json:"status"`
+    Critical   bool   `json:"critical"`
+    DurationMS int64  `json:"duration_ms"`
+    Error      string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a readiness evaluation
+type Report struct {
+    Status string                 `json:"status"`
+    Checks map[string]CheckResult `json:"checks"`
+}
+
+// Ready reports whether the instance should receive traffic
+func (r *Report) Ready() bool {
+    return r.Status == StatusReady || r.Status == StatusDegraded
+}
+
+type registeredCheck struct {
+    name     string
+    critical bool
+    check    Check
+}
+
+// Checker evaluates the registered dependency checks for the readiness probe.
+// Failing critical checks make the instance not ready; failing optional ones only degrade it.
+type Checker struct {
+    timeout  time.Duration
+    mu       sync.RWMutex
+    checks   []registeredCheck
+    draining atomic.Bool
+}
+
+// NewChecker creates a checker that gives each check at most timeout to complete
+func NewChecker(timeout time.Duration) *Checker {
+    return &Checker{timeout: timeout}
+}
+
+// Register adds a check. Critical checks are required for readiness.
+func (c *Checker) Register(name string, critical bool, check Check) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.checks = append(c.checks, registeredCheck{name: name, critical: critical, check: check})
+}
+
+// SetDraining marks the instance as shutting down; readiness fails from then on
+// so load balancers stop routing new requests to it
+func (c *Checker) SetDraining() {
+    c.draining.Store(true)
+}
+
+// Draining reports whether SetDraining has been called
+func (c *Checker) Draining() bool {
+    return c.draining.Load()
+}
+
+// Evaluate runs all checks concurrently and summarizes them
+func (c *Checker) Evaluate(ctx context.Context) *Report {
+    c.mu.RLock()
+    checks := append([]registeredCheck(nil), c.checks...)
+    c.mu.RUnlock()
+
+    results := make([]CheckResult, len(checks))
+    var wg sync.WaitGroup
+    for i, rc := range checks {
+        wg.Add(1)
+        go func(i int, rc registeredCheck) {
+            defer wg.Done()
+            results[i] = c.run(ctx, rc)
+        }(i, rc)
+    }
+    wg.Wait()
+
+    report := &Report{Status: StatusReady, Checks: make(map[string]CheckResult, len(checks))}
+    for i, rc := range checks {
+        report.Checks[rc.name] = results[i]
+        if results[i].Status == StatusOK {
+            continue
+        }
+        if rc.critical {
+            report.Status = StatusNotReady
+        } else if report.Status == StatusReady {
+            report.Status = StatusDegraded
+        }
+    }
+    if c.Draining() {
+        report.Status = StatusDraining
+    }
+    return report
+}
+
+func (c *Checker) run(ctx context.Context, rc registeredCheck) CheckResult {
+    if c.timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, c.timeout)
+        defer cancel()
+    }
+
+    start := time.Now()
+    err := rc.check(ctx)
+    result := CheckResult{
+        Status:     StatusOK,
+        Critical:   rc.critical,
+        DurationMS: time.Since(start).Milliseconds(),
+    }
+    if err != nil {
+        result.Status = StatusFail
+        result.Error = err.Error()
+    }
+    return result
+}
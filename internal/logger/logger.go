@@ -1,36 +1,277 @@
 package logger
 
 import (
-    "log"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
     "os"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
 )
 
+// Level is a logging severity
+type Level int32
+
+const (
+    LevelDebug Level = iota
+    LevelInfo
+    LevelWarn
+    LevelError
+)
+
+func (l Level) String() string {
+    switch l {
+    case LevelDebug:
+        return "debug"
+    case LevelWarn:
+        return "warn"
+    case LevelError:
+        return "error"
+    default:
+        return "info"
+    }
+}
+
+// ParseLevel converts a level name to a Level
+func ParseLevel(level string) (Level, error) {
+    switch strings.ToLower(level) {
+    case "debug":
+        return LevelDebug, nil
+    case "info", "":
+        return LevelInfo, nil
+    case "warn", "warning":
+        return LevelWarn, nil
+    case "error":
+        return LevelError, nil
+    default:
+        return LevelInfo, fmt.Errorf("unknown log level %q", level)
+    }
+}
+
+// Logger writes leveled, structured log entries as text or JSON lines.
+// Loggers derived with With or WithContext share the output and the level of their parent.
 type Logger struct {
-    infoLog  *log.Logger
-    errorLog *log.Logger
+    out    *output
+    level  *atomic.Int32
+    json   bool
+    fields []interface{}
 }
 
-// NewLogger creates a new logger instance
+// output serializes writes from all loggers sharing a writer
+type output struct {
+    mu sync.Mutex
+    w  io.Writer
+}
+
+// NewLogger creates a text logger writing to stdout
 func NewLogger(level string) *Logger {
-    // level parameter accepted for future use, currently not filtering
-    return &Logger{
-        infoLog:  log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-        errorLog: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
+    return New(level, "text", os.Stdout)
+}
+
+// New creates a logger with the given level and format ("text" or "json") writing to w
+func New(level, format string, w io.Writer) *Logger {
+    l := &Logger{
+        out:   &output{w: w},
+        level: new(atomic.Int32),
+        json:  format == "json",
+    }
+    l.SetLevel(level)
+    return l
+}
+
+// Nop returns a logger that discards everything
+func Nop() *Logger {
+    return New("error", "text", io.Discard)
+}
+
+// OpenOutput resolves a logging.output setting: stdout, stderr or a file path opened for appending
+func OpenOutput(output string) (io.WriteCloser, error) {
+    switch output {
+    case "", "stdout":
+        return nopCloser{os.Stdout}, nil
+    case "stderr":
+        return nopCloser{os.Stderr}, nil
+    default:
+        return os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    }
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// SetLevel changes the level at runtime; it is safe to call concurrently with logging.
+// Unknown levels fall back to info.
+func (l *Logger) SetLevel(level string) {
+    parsed, _ := ParseLevel(level)
+    l.level.Store(int32(parsed))
+}
+
+// Enabled reports whether entries at level are written
+func (l *Logger) Enabled(level Level) bool {
+    return l != nil && Level(l.level.Load()) <= level
+}
+
+// With returns a logger that adds the key/value pairs to every entry
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+    if l == nil || len(keysAndValues) == 0 {
+        return l
+    }
+    child := *l
+    child.fields = append(append([]interface{}{}, l.fields...), keysAndValues...)
+    return &child
+}
+
+// WithContext returns a logger that adds the fields stored in ctx with WithFields
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+    return l.With(FieldsFromContext(ctx)...)
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying additional log fields, such as request_id,
+// user_id or subscription_id, for loggers obtained with WithContext
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+    fields := append(append([]interface{}{}, FieldsFromContext(ctx)...), keysAndValues...)
+    return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// FieldsFromContext returns the log fields stored in ctx
+func FieldsFromContext(ctx context.Context) []interface{} {
+    if ctx == nil {
+        return nil
     }
+    fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+    return fields
 }
 
-func (l *Logger) Info(v ...interface{}) {
-    l.infoLog.Println(v...)
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+    l.log(LevelDebug, msg, keysAndValues)
 }
 
-func (l *Logger) Error(v ...interface{}) {
-    l.errorLog.Println(v...)
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+    l.log(LevelInfo, msg, keysAndValues)
+}
+
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+    l.log(LevelWarn, msg, keysAndValues)
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+    l.log(LevelError, msg, keysAndValues)
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+    if l.Enabled(LevelDebug) {
+        l.log(LevelDebug, fmt.Sprintf(format, v...), nil)
+    }
 }
 
 func (l *Logger) Infof(format string, v ...interface{}) {
-    l.infoLog.Printf(format, v...)
+    if l.Enabled(LevelInfo) {
+        l.log(LevelInfo, fmt.Sprintf(format, v...), nil)
+    }
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+    if l.Enabled(LevelWarn) {
+        l.log(LevelWarn, fmt.Sprintf(format, v...), nil)
+    }
 }
 
 func (l *Logger) Errorf(format string, v ...interface{}) {
-    l.errorLog.Printf(format, v...)
-}
\ No newline at end of file
+    if l.Enabled(LevelError) {
+        l.log(LevelError, fmt.Sprintf(format, v...), nil)
+    }
+}
+
+func (l *Logger) log(level Level, msg string, keysAndValues []interface{}) {
+    if !l.Enabled(level) {
+        return
+    }
+
+    fields := l.fields
+    if len(keysAndValues) > 0 {
+        fields = append(append([]interface{}{}, l.fields...), keysAndValues...)
+    }
+
+    var buf bytes.Buffer
+    now := time.Now().UTC().Format(time.RFC3339Nano)
+    if l.json {
+        writeJSON(&buf, now, level, msg, fields)
+    } else {
+        writeText(&buf, now, level, msg, fields)
+    }
+
+    l.out.mu.Lock()
+    defer l.out.mu.Unlock()
+    l.out.w.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, now string, level Level, msg string, fields []interface{}) {
+    buf.WriteString(`{"time":`)
+    writeJSONValue(buf, now)
+    buf.WriteString(`,"level":`)
+    writeJSONValue(buf, level.String())
+    buf.WriteString(`,"msg":`)
+    writeJSONValue(buf, msg)
+    forEachField(fields, func(key string, value interface{}) {
+        buf.WriteByte(',')
+        writeJSONValue(buf, key)
+        buf.WriteByte(':')
+        writeJSONValue(buf, value)
+    })
+    buf.WriteString("}\n")
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+    data, err := json.Marshal(value)
+    if err != nil {
+        data, _ = json.Marshal(fmt.Sprint(value))
+    }
+    buf.Write(data)
+}
+
+func writeText(buf *bytes.Buffer, now string, level Level, msg string, fields []interface{}) {
+    buf.WriteString(now)
+    buf.WriteByte(' ')
+    buf.WriteString(strings.ToUpper(level.String()))
+    buf.WriteByte(' ')
+    buf.WriteString(msg)
+    forEachField(fields, func(key string, value interface{}) {
+        buf.WriteByte(' ')
+        buf.WriteString(key)
+        buf.WriteByte('=')
+        s := fmt.Sprint(value)
+        if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+            s = strconv.Quote(s)
+        }
+        buf.WriteString(s)
+    })
+    buf.WriteByte('\n')
+}
+
+// forEachField walks key/value pairs, rendering errors and durations as strings.
+// A trailing key without a value is reported under "!BADKEY".
+func forEachField(fields []interface{}, fn func(key string, value interface{})) {
+    for i := 0; i < len(fields); i += 2 {
+        if i+1 >= len(fields) {
+            fn("!BADKEY", fields[i])
+            return
+        }
+        key := fmt.Sprint(fields[i])
+        switch value := fields[i+1].(type) {
+        case error:
+            fn(key, value.Error())
+        case time.Duration:
+            fn(key, value.String())
+        default:
+            fn(key, value)
+        }
+    }
+}
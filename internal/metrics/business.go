@@ -0,0 +1,94 @@
+package metrics
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "subscription-service/internal/model"
+)
+
+// businessRefreshInterval bounds how often a scrape recomputes the business gauges
+const businessRefreshInterval = time.Minute
+
+// businessRefreshTimeout bounds a recomputation, so a slow database cannot hold up scrapes
+const businessRefreshTimeout = 10 * time.Second
+
+// uncategorized labels the subscriptions without a category
+const uncategorized = "none"
+
+// CostSource returns the cost of the subscriptions active in month (MM-YYYY) grouped by category,
+// as SubscriptionService.CostSummary does
+type CostSource func(ctx context.Context, month string) ([]model.CostGroup, error)
+
+var (
+    activeSubscriptionsDesc = prometheus.NewDesc(
+        namespace+"_active_subscriptions",
+        "Subscriptions active in the current month, per category.",
+        []string{"category"}, nil,
+    )
+    monthlyRecurringCostDesc = prometheus.NewDesc(
+        namespace+"_monthly_recurring_cost_rubles",
+        "Sum of prices of subscriptions active in the current month, per category.",
+        []string{"category"}, nil,
+    )
+    businessRefreshErrorsDesc = prometheus.NewDesc(
+        namespace+"_business_metrics_refresh_errors_total",
+        "Failed recomputations of the business gauges.",
+        nil, nil,
+    )
+)
+
+// BusinessCollector exports active subscriptions and monthly recurring cost per category.
+// Categories are a closed set, so the number of series stays bounded. The totals are
+// aggregated by the repository on scrape and cached for businessRefreshInterval.
+type BusinessCollector struct {
+    source CostSource
+    now    func() time.Time
+
+    mu        sync.Mutex
+    groups    []model.CostGroup
+    refreshed time.Time
+    errors    int
+}
+
+func NewBusinessCollector(source CostSource) *BusinessCollector {
+    return &BusinessCollector{source: source, now: time.Now}
+}
+
+func (c *BusinessCollector) Describe(ch chan<- *prometheus.Desc) {
+    ch <- activeSubscriptionsDesc
+    ch <- monthlyRecurringCostDesc
+    ch <- businessRefreshErrorsDesc
+}
+
+// Collect emits the cached totals, refreshing them first if they are stale.
+// On a failed refresh the previous totals are kept.
+func (c *BusinessCollector) Collect(ch chan<- prometheus.Metric) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    now := c.now()
+    if c.groups == nil || now.Sub(c.refreshed) >= businessRefreshInterval {
+        ctx, cancel := context.WithTimeout(context.Background(), businessRefreshTimeout)
+        groups, err := c.source(ctx, now.Format("01-2006"))
+        cancel()
+        if err != nil {
+            c.errors++
+        } else {
+            c.groups = groups
+            c.refreshed = now
+        }
+    }
+
+    for _, group := range c.groups {
+        category := group.Key
+        if category == "" {
+            category = uncategorized
+        }
+        ch <- prometheus.MustNewConstMetric(activeSubscriptionsDesc, prometheus.GaugeValue, float64(group.SubscriptionCount), category)
+        ch <- prometheus.MustNewConstMetric(monthlyRecurringCostDesc, prometheus.GaugeValue, float64(group.TotalCost), category)
+    }
+    ch <- prometheus.MustNewConstMetric(businessRefreshErrorsDesc, prometheus.CounterValue, float64(c.errors))
+}
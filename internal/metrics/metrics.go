@@ -0,0 +1,189 @@
+package metrics
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "subscription_service"
+
+// Metrics holds the service's Prometheus collectors
+type Metrics struct {
+    registry        *prometheus.Registry
+    requests        *prometheus.CounterVec
+    requestDuration *prometheus.HistogramVec
+    queryDuration   *prometheus.HistogramVec
+}
+
+// New creates the metrics and registers them, together with the Go runtime and process collectors,
+// on a dedicated registry
+func New() *Metrics {
+    m := &Metrics{
+        registry: prometheus.NewRegistry(),
+        requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "http_requests_total",
+            Help:      "HTTP requests by method, route template and status code.",
+        }, []string{"method", "route", "status"}),
+        requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "http_request_duration_seconds",
+            Help:      "HTTP request latency by method and route template.",
+            Buckets:   prometheus.DefBuckets,
+        }, []string{"method", "route"}),
+        queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "repository_query_duration_seconds",
+            Help:      "Repository call latency by method and outcome (success, error, timeout, canceled).",
+            Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+        }, []string{"method", "outcome"}),
+    }
+
+    m.registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        m.requests,
+        m.requestDuration,
+        m.queryDuration,
+    )
+    return m
+}
+
+// Register adds further collectors, such as the business collector, to the registry
+func (m *Metrics) Register(cs ...prometheus.Collector) {
+    m.registry.MustRegister(cs...)
+}
+
+// RegisterDB exports the connection pool statistics of db
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+    m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ConnectionState reports database reachability, as tracked by database.Monitor
+type ConnectionState interface {
+    Up() bool
+    Reconnects() uint64
+}
+
+// RegisterConnection exports whether the database is reachable and how often it reconnected
+func (m *Metrics) RegisterConnection(state ConnectionState) {
+    m.registry.MustRegister(
+        prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+            Namespace: namespace,
+            Name:      "db_up",
+            Help:      "Whether the last database ping succeeded (1) or failed (0).",
+        }, func() float64 {
+            if state.Up() {
+                return 1
+            }
+            return 0
+        }),
+        prometheus.NewCounterFunc(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "db_reconnects_total",
+            Help:      "Times the database connection was restored after an outage.",
+        }, func() float64 {
+            return float64(state.Reconnects())
+        }),
+    )
+}
+
+// ReplicaState reports whether reads are served by the replica, as tracked by database.Replica
+type ReplicaState interface {
+    Usable() bool
+    Lag() time.Duration
+}
+
+// RegisterReplica exports whether the read replica is in use and how far it lags behind
+func (m *Metrics) RegisterReplica(state ReplicaState) {
+    m.registry.MustRegister(
+        prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+            Namespace: namespace,
+            Name:      "db_replica_usable",
+            Help:      "Whether listings and cost reports are read from the replica (1) or the primary (0).",
+        }, func() float64 {
+            if state.Usable() {
+                return 1
+            }
+            return 0
+        }),
+        prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+            Namespace: namespace,
+            Name:      "db_replica_lag_seconds",
+            Help:      "Replication lag of the read replica at the last successful check.",
+        }, func() float64 {
+            return state.Lag().Seconds()
+        }),
+    )
+}
+
+// CacheStats reports the outcomes of cache lookups, as counted by cache.CostCache
+type CacheStats interface {
+    Hits() uint64
+    Misses() uint64
+    Errors() uint64
+    Invalidations() uint64
+}
+
+// RegisterCostCache exports the hit, miss, error and invalidation counts of the cost report cache
+func (m *Metrics) RegisterCostCache(stats CacheStats) {
+    counter := func(name, help string, value func() uint64) prometheus.Collector {
+        return prometheus.NewCounterFunc(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      name,
+            Help:      help,
+        }, func() float64 {
+            return float64(value())
+        })
+    }
+    m.registry.MustRegister(
+        counter("cost_cache_hits_total", "Cost reports served from the cache.", stats.Hits),
+        counter("cost_cache_misses_total", "Cost reports computed because they were not cached.", stats.Misses),
+        counter("cost_cache_errors_total", "Cache operations that failed; failed lookups are computed instead.", stats.Errors),
+        counter("cost_cache_invalidations_total", "Writes that invalidated cached cost reports.", stats.Invalidations),
+    )
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+    return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware creates a Gin middleware recording request counts and latency.
+// Routes are labelled by template, so path parameters do not create new series.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        m.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+        m.requestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+    }
+}
+
+// observeQuery records the latency of a repository call
+func (m *Metrics) observeQuery(method string, start time.Time, err error) {
+    outcome := "success"
+    switch {
+    case errors.Is(err, context.DeadlineExceeded):
+        outcome = "timeout"
+    case errors.Is(err, context.Canceled):
+        outcome = "canceled"
+    case err != nil:
+        outcome = "error"
+    }
+    m.queryDuration.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+}
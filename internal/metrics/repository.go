@@ -0,0 +1,81 @@
+package metrics
+
+import (
+    "context"
+    "time"
+
+    "subscription-service/internal/model"
+    "subscription-service/internal/repository"
+)
+
+// instrumentedRepository records the latency of every SubscriptionRepository call
+type instrumentedRepository struct {
+    next    repository.SubscriptionRepository
+    metrics *Metrics
+}
+
+// InstrumentRepository wraps repo so that each method's latency is exported
+func (m *Metrics) InstrumentRepository(repo repository.SubscriptionRepository) repository.SubscriptionRepository {
+    return &instrumentedRepository{next: repo, metrics: m}
+}
+
+func (r *instrumentedRepository) Create(ctx context.Context, subscription *model.Subscription) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("Create", start, err) }(time.Now())
+    return r.next.Create(ctx, subscription)
+}
+
+func (r *instrumentedRepository) GetByID(ctx context.Context, id int) (_ *model.Subscription, err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("GetByID", start, err) }(time.Now())
+    return r.next.GetByID(ctx, id)
+}
+
+func (r *instrumentedRepository) GetAll(ctx context.Context) (_ []model.Subscription, err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("GetAll", start, err) }(time.Now())
+    return r.next.GetAll(ctx)
+}
+
+func (r *instrumentedRepository) Update(ctx context.Context, subscription *model.Subscription) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("Update", start, err) }(time.Now())
+    return r.next.Update(ctx, subscription)
+}
+
+func (r *instrumentedRepository) Delete(ctx context.Context, id int) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("Delete", start, err) }(time.Now())
+    return r.next.Delete(ctx, id)
+}
+
+func (r *instrumentedRepository) GetByFilters(ctx context.Context, filter model.SubscriptionFilter) (_ []model.Subscription, err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("GetByFilters", start, err) }(time.Now())
+    return r.next.GetByFilters(ctx, filter)
+}
+
+func (r *instrumentedRepository) IterateByFilters(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("IterateByFilters", start, err) }(time.Now())
+    return r.next.IterateByFilters(ctx, filter, fn)
+}
+
+func (r *instrumentedRepository) ApplyBatch(ctx context.Context, ops []repository.BatchOp) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("ApplyBatch", start, err) }(time.Now())
+    return r.next.ApplyBatch(ctx, ops)
+}
+
+// WithTx records the duration of the whole transaction; calls made through the transaction's
+// repository are recorded individually as well
+func (r *instrumentedRepository) WithTx(ctx context.Context, fn func(repository.SubscriptionRepository) error) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("WithTx", start, err) }(time.Now())
+    return r.next.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+        return fn(&instrumentedRepository{next: tx, metrics: r.metrics})
+    })
+}
+
+func (r *instrumentedRepository) WithSnapshot(ctx context.Context, fn func(repository.SubscriptionRepository) error) (err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("WithSnapshot", start, err) }(time.Now())
+    return r.next.WithSnapshot(ctx, func(tx repository.SubscriptionRepository) error {
+        return fn(&instrumentedRepository{next: tx, metrics: r.metrics})
+    })
+}
+
+func (r *instrumentedRepository) SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (_ *model.CostSummary, err error) {
+    defer func(start time.Time) { r.metrics.observeQuery("SummarizeCost", start, err) }(time.Now())
+    return r.next.SummarizeCost(ctx, filter, groupBy)
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Service is an entry of the service catalog. Subscriptions whose service_name matches its name
+// or one of its aliases are linked to it and stored under its name, so cost reports group them.
+type Service struct {
+    ID           int       `json:"id" db:"id"`
+    Name         string    `json:"name" db:"name"`
+    Aliases      []string  `json:"aliases" db:"aliases"`
+    Category     string    `json:"category,omitempty" db:"category"`
+    Website      string    `json:"website,omitempty" db:"website"`
+    DefaultPrice *int      `json:"default_price,omitempty" db:"default_price"`
+    CreatedAt    time.Time `json:"created_at,omitempty" db:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// ServiceRequest represents the request body for creating or updating a catalog entry
+type ServiceRequest struct {
+    Name         string   `json:"name"`
+    Aliases      []string `json:"aliases"`
+    Category     string   `json:"category"`
+    Website      string   `json:"website"`
+    DefaultPrice *int     `json:"default_price"`
+}
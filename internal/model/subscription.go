@@ -8,10 +8,13 @@ import (
 type Subscription struct {
     ID          int       `json:"id" db:"id"`
     ServiceName string    `json:"service_name" db:"service_name" validate:"required"`
+    ServiceID   *int      `json:"service_id,omitempty" db:"service_id"`
     Price       int       `json:"price" db:"price" validate:"required,gt=0"`
     UserID      uuid.UUID `json:"user_id" db:"user_id" validate:"required"`
     StartDate   string    `json:"start_date" db:"start_date" validate:"required"`
     EndDate     *string   `json:"end_date,omitempty" db:"end_date"`
+    Category    *string   `json:"category,omitempty" db:"category"`
+    Tags        []string  `json:"tags,omitempty" db:"tags"`
     CreatedAt   time.Time `json:"created_at,omitempty" db:"created_at"`
     UpdatedAt   time.Time `json:"updated_at,omitempty" db:"updated_at"`
 }
@@ -23,13 +26,157 @@ type CreateSubscriptionRequest struct {
     UserID      uuid.UUID `json:"user_id" validate:"required"`
     StartDate   string    `json:"start_date" validate:"required"`
     EndDate     *string   `json:"end_date,omitempty"`
+    Category    *string   `json:"category,omitempty"`
+    Tags        []string  `json:"tags,omitempty"`
+}
+
+// Subscription categories
+const (
+    CategoryEntertainment = "entertainment"
+    CategoryDevTools      = "dev_tools"
+    CategoryCloud         = "cloud"
+    CategoryEducation     = "education"
+)
+
+// Categories lists the categories a subscription may have
+var Categories = []string{CategoryEntertainment, CategoryDevTools, CategoryCloud, CategoryEducation}
+
+// SubscriptionFilter selects the subscriptions a listing or cost report covers. Nil and empty
+// fields do not filter; a subscription must carry every tag in Tags.
+type SubscriptionFilter struct {
+    UserID      *uuid.UUID
+    ServiceName *string
+    Period      *string
+    Category    *string
+    Tags        []string
+}
+
+// Cost report group_by dimensions
+const (
+    GroupByCategory    = "category"
+    GroupByTag         = "tag"
+    GroupByServiceName = "service_name"
+)
+
+// CostSummary is the result of a cost calculation without the subscriptions it covers.
+// TotalCost is the monthly price of all matching subscriptions; Months breaks it down by the
+// months in which they are active.
+type CostSummary struct {
+    TotalCost         int           `json:"total_cost"`
+    Period            string        `json:"period"`
+    UserID            *uuid.UUID    `json:"user_id,omitempty"`
+    Service           *string       `json:"service_name,omitempty"`
+    Category          *string       `json:"category,omitempty"`
+    Tags              []string      `json:"tags,omitempty"`
+    SubscriptionCount int           `json:"subscription_count"`
+    Months            []MonthlyCost `json:"months"`
+    GroupBy           string        `json:"group_by,omitempty"`
+    Groups            []CostGroup   `json:"groups,omitempty"`
+}
+
+// CostGroup is the cost of the subscriptions sharing a value of the group_by dimension. Key is
+// empty for subscriptions without a category or tags. A subscription with several tags counts
+// in the group of each, so tag groups may add up to more than the total.
+type CostGroup struct {
+    Key               string `json:"key"`
+    TotalCost         int    `json:"total_cost"`
+    SubscriptionCount int    `json:"subscription_count"`
+}
+
+// MonthlyCost is the cost of the subscriptions active in a month
+type MonthlyCost struct {
+    Month             string `json:"month"`
+    Cost              int    `json:"cost"`
+    SubscriptionCount int    `json:"subscription_count"`
 }
 
 // SummaryCostResponse represents the response for cost calculation
 type SummaryCostResponse struct {
-    TotalCost int                `json:"total_cost"`
-    Period    string             `json:"period"`
-    UserID    *uuid.UUID         `json:"user_id,omitempty"`
-    Service   *string            `json:"service_name,omitempty"`
-    Items     []Subscription     `json:"subscriptions"`
-}
\ No newline at end of file
+    CostSummary
+    Items []Subscription `json:"subscriptions"`
+}
+
+// Batch operation types accepted by the batch endpoint
+const (
+    BatchOpCreate = "create"
+    BatchOpUpdate = "update"
+    BatchOpDelete = "delete"
+)
+
+// Batch execution modes
+const (
+    BatchModeAtomic     = "atomic"
+    BatchModeBestEffort = "best_effort"
+)
+
+// BatchOperation represents a single create, update or delete inside a batch request
+type BatchOperation struct {
+    Op           string                     `json:"op"`
+    ID           int                        `json:"id,omitempty"`
+    Subscription *CreateSubscriptionRequest `json:"subscription,omitempty"`
+}
+
+// BatchRequest represents the request body for the batch endpoint
+type BatchRequest struct {
+    Mode       string           `json:"mode"`
+    Operations []BatchOperation `json:"operations"`
+}
+
+// BatchItemResult represents the outcome of a single batch operation
+type BatchItemResult struct {
+    Index        int           `json:"index"`
+    Op           string        `json:"op"`
+    Success      bool          `json:"success"`
+    Error        string        `json:"error,omitempty"`
+    Subscription *Subscription `json:"subscription,omitempty"`
+}
+
+// BatchResponse represents the response for the batch endpoint
+type BatchResponse struct {
+    Mode      string            `json:"mode"`
+    Succeeded int               `json:"succeeded"`
+    Failed    int               `json:"failed"`
+    Results   []BatchItemResult `json:"results"`
+}
+
+// ImportRowError describes why a CSV row was rejected
+type ImportRowError struct {
+    Row   int    `json:"row"`
+    Error string `json:"error"`
+}
+
+// ImportReport represents the response for a CSV import
+type ImportReport struct {
+    DryRun     bool `json:"dry_run"`
+    TotalRows  int  `json:"total_rows"`
+    ValidRows  int  `json:"valid_rows"`
+    Imported   int  `json:"imported"`
+    ErrorCount int  `json:"error_count"`
+    // Errors lists the first failed rows; ErrorCount counts all of them
+    Errors []ImportRowError `json:"errors"`
+}
+
+// RecurringCharge represents a monthly debit found in a bank statement
+type RecurringCharge struct {
+    Merchant string `json:"merchant"`
+    // Amount is in whole units of Currency
+    Amount         int                        `json:"amount"`
+    Currency       string                     `json:"currency,omitempty"`
+    Occurrences    int                        `json:"occurrences"`
+    FirstCharge    string                     `json:"first_charge"`
+    LastCharge     string                     `json:"last_charge"`
+    SubscriptionID *int                       `json:"subscription_id,omitempty"`
+    PriceChanged   bool                       `json:"price_changed,omitempty"`
+    Proposal       *CreateSubscriptionRequest `json:"proposal,omitempty"`
+}
+
+// StatementReport represents the response for a bank statement import
+type StatementReport struct {
+    Format       string            `json:"format"`
+    Transactions int               `json:"transactions"`
+    Matched      []RecurringCharge `json:"matched"`
+    Proposed     []RecurringCharge `json:"proposed"`
+    // Foreign lists the recurring charges in currencies other than rubles, which are neither
+    // matched nor proposed
+    Foreign []RecurringCharge `json:"foreign_currency"`
+}
@@ -0,0 +1,687 @@
+package repository
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+
+    "subscription-service/internal/catalog"
+    "subscription-service/internal/model"
+    "subscription-service/internal/tracing"
+    "github.com/google/uuid"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// ServiceRepository stores the service catalog
+type ServiceRepository interface {
+    // Create stores service. The unlinked subscriptions whose name now matches it are linked to it
+    // and take its name in the same transaction; their users are returned.
+    Create(ctx context.Context, service *model.Service) (linked []uuid.UUID, err error)
+    GetByID(ctx context.Context, id int) (*model.Service, error)
+    // List returns every entry of the catalog, oldest first
+    List(ctx context.Context) ([]model.Service, error)
+    // Update stores service. When it is renamed, the subscriptions linked to it take the new name,
+    // and the unlinked subscriptions whose name now matches it are linked to it, in the same
+    // transaction; the users of both are returned.
+    Update(ctx context.Context, service *model.Service) (relinked []uuid.UUID, err error)
+    // Delete removes the entry; the subscriptions linked to it keep their name and are unlinked
+    Delete(ctx context.Context, id int) error
+    // Seed adds an entry for each service name in use that matches none, as catalog.Seed does, and
+    // links the unlinked subscriptions in the same transaction; their users are returned. It runs
+    // once per database, later calls do nothing.
+    Seed(ctx context.Context) (linked []uuid.UUID, err error)
+}
+
+// ErrServiceConflict is reported when a name or alias of a service is already used by another
+// entry of the catalog, compared the way subscriptions are matched
+var ErrServiceConflict = errors.New("service already exists")
+
+// checkConflict reports the first name or alias of service that another entry of services uses
+func checkConflict(service *model.Service, services []model.Service) error {
+    if name := catalog.Conflict(*service, services); name != "" {
+        return fmt.Errorf("%w: %q is used by another service", ErrServiceConflict, name)
+    }
+    return nil
+}
+
+// catalogStatements are the SQL of a catalog backend. Entries are read as serviceColumns.
+type catalogStatements struct {
+    // list selects every entry, get entry $1
+    list string
+    get  string
+    // insert stores name, aliases, category, website, default_price, created_at and updated_at
+    // as $1 to $7 and returns the ID
+    insert string
+    // update stores name, aliases, category, website, default_price and updated_at as $1 to $6
+    // in entry $7
+    update string
+    delete string
+    // rename gives the subscriptions linked to entry $3 the name $1 and updated_at $2 and returns
+    // their user_id
+    rename string
+    // unlinked selects the distinct names of the subscriptions without an entry, most used first
+    unlinked string
+    // link links the unlinked subscriptions named $4 to entry $1 with the name $2 and updated_at $3
+    // and returns their user_id
+    link string
+    // seeded selects whether Seed ran, setSeeded records that it did
+    seeded    string
+    setSeeded string
+}
+
+const serviceColumns = "id, name, aliases, category, website, default_price, created_at, updated_at"
+
+// sqlCatalog is the ServiceRepository of the database/sql backends
+type sqlCatalog struct {
+    sqlDB
+    statements *catalogStatements
+}
+
+// startCall starts the span of a repository method
+func (r *sqlCatalog) startCall(ctx context.Context, method string) (context.Context, trace.Span) {
+    return tracing.Start(ctx, "ServiceRepository."+method)
+}
+
+func (r *sqlCatalog) scanService(row rowScanner, service *model.Service) error {
+    service.Aliases = []string{}
+    return row.Scan(
+        &service.ID,
+        &service.Name,
+        r.sqlDB.list(&service.Aliases),
+        &service.Category,
+        &service.Website,
+        &service.DefaultPrice,
+        &service.CreatedAt,
+        &service.UpdatedAt,
+    )
+}
+
+// Create stores service and links the subscriptions it matches in one transaction. Linked
+// subscriptions may take another name, so the closed months of their users are materialized again.
+func (r *sqlCatalog) Create(ctx context.Context, service *model.Service) (linked []uuid.UUID, err error) {
+    ctx, span := r.startCall(ctx, "Create")
+    defer r.finishCall(ctx, span, "Create", time.Now(), &err)
+    if service.Aliases == nil {
+        service.Aliases = []string{}
+    }
+    err = r.withTx(ctx, func(tx *sqlDB) error {
+        repo := &sqlCatalog{*tx, r.statements}
+        services, err := repo.list(ctx)
+        if err != nil {
+            return err
+        }
+        if err := checkConflict(service, services); err != nil {
+            return err
+        }
+        if err := repo.insert(ctx, service); err != nil {
+            return err
+        }
+        linked, err = repo.link(ctx, append(services, *service), service)
+        if err != nil || len(linked) == 0 {
+            return err
+        }
+        return repo.rewriteSpend(ctx, linked)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return linked, nil
+}
+
+func (r *sqlCatalog) insert(ctx context.Context, service *model.Service) (err error) {
+    query := r.statements.insert
+
+    now := r.now()
+    service.CreatedAt = now
+    service.UpdatedAt = now
+
+    ctx, st := r.startStatementOn(ctx, "services", "INSERT", query)
+    defer st.end(&err)
+
+    err = r.conn().QueryRowContext(ctx, query,
+        service.Name,
+        r.sqlDB.list(&service.Aliases),
+        service.Category,
+        service.Website,
+        service.DefaultPrice,
+        service.CreatedAt,
+        service.UpdatedAt,
+    ).Scan(&service.ID)
+    if err != nil {
+        return fmt.Errorf("failed to create service: %w", err)
+    }
+    return nil
+}
+
+func (r *sqlCatalog) GetByID(ctx context.Context, id int) (_ *model.Service, err error) {
+    ctx, span := r.startCall(ctx, "GetByID")
+    defer r.finishCall(ctx, span, "GetByID", time.Now(), &err)
+
+    query := r.statements.get
+    statementCtx, st := r.startStatementOn(ctx, "services", "SELECT", query)
+    service := &model.Service{}
+    err = r.scanService(r.conn().QueryRowContext(statementCtx, query, id), service)
+    st.end(&err)
+
+    if err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, errors.New("service not found")
+        }
+        return nil, fmt.Errorf("failed to get service: %w", err)
+    }
+    return service, nil
+}
+
+func (r *sqlCatalog) List(ctx context.Context) (_ []model.Service, err error) {
+    ctx, span := r.startCall(ctx, "List")
+    defer r.finishCall(ctx, span, "List", time.Now(), &err)
+    return r.list(ctx)
+}
+
+func (r *sqlCatalog) list(ctx context.Context) (_ []model.Service, err error) {
+    query := r.statements.list
+    ctx, st := r.startStatementOn(ctx, "services", "SELECT", query)
+    defer st.end(&err)
+
+    rows, err := r.conn().QueryContext(ctx, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get services: %w", err)
+    }
+    defer rows.Close()
+
+    services := []model.Service{}
+    for rows.Next() {
+        service := model.Service{}
+        if err := r.scanService(rows, &service); err != nil {
+            return nil, fmt.Errorf("failed to scan service: %w", err)
+        }
+        services = append(services, service)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating services: %w", err)
+    }
+    return services, nil
+}
+
+// Update stores service, renames the subscriptions linked to it and links the ones it now matches
+// in one transaction. Those subscriptions move to another service in monthly_spend, so the closed
+// months of their users are materialized again.
+func (r *sqlCatalog) Update(ctx context.Context, service *model.Service) (relinked []uuid.UUID, err error) {
+    ctx, span := r.startCall(ctx, "Update")
+    defer r.finishCall(ctx, span, "Update", time.Now(), &err)
+    if service.Aliases == nil {
+        service.Aliases = []string{}
+    }
+    err = r.withTx(ctx, func(tx *sqlDB) error {
+        repo := &sqlCatalog{*tx, r.statements}
+        services, err := repo.list(ctx)
+        if err != nil {
+            return err
+        }
+        var current model.Service
+        found := false
+        for i := range services {
+            if services[i].ID == service.ID {
+                current, found = services[i], true
+                services[i] = *service
+            }
+        }
+        if !found {
+            return errors.New("service not found")
+        }
+        if err := checkConflict(service, services); err != nil {
+            return err
+        }
+
+        service.CreatedAt = current.CreatedAt
+        service.UpdatedAt = r.now()
+        err = repo.execOn(ctx, "services", "UPDATE", r.statements.update,
+            service.Name,
+            r.sqlDB.list(&service.Aliases),
+            service.Category,
+            service.Website,
+            service.DefaultPrice,
+            service.UpdatedAt,
+            service.ID,
+        )
+        if err != nil {
+            return fmt.Errorf("failed to update service: %w", err)
+        }
+        relinked = nil
+        if service.Name != current.Name {
+            relinked, err = repo.updateSubscriptions(ctx, r.statements.rename, service.Name, service.UpdatedAt, service.ID)
+            if err != nil {
+                return fmt.Errorf("failed to rename subscriptions: %w", err)
+            }
+        }
+        linked, err := repo.link(ctx, services, service)
+        if err != nil {
+            return err
+        }
+        for _, user := range linked {
+            relinked = addUser(relinked, user)
+        }
+        if len(relinked) == 0 {
+            return nil
+        }
+        return repo.rewriteSpend(ctx, relinked)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return relinked, nil
+}
+
+// link links the unlinked subscriptions to the entry of services, the whole catalog, that their
+// name matches and returns their users. With only set, just the subscriptions matching it are linked.
+func (r *sqlCatalog) link(ctx context.Context, services []model.Service, only *model.Service) ([]uuid.UUID, error) {
+    names, err := r.unlinkedNames(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get unlinked subscriptions: %w", err)
+    }
+    now := r.now()
+    var users []uuid.UUID
+    for _, name := range names {
+        match, ok := catalog.Match(name, services)
+        if !ok || (only != nil && match.ID != only.ID) {
+            continue
+        }
+        linked, err := r.updateSubscriptions(ctx, r.statements.link, match.ID, match.Name, now, name)
+        if err != nil {
+            return nil, fmt.Errorf("failed to link subscriptions: %w", err)
+        }
+        for _, user := range linked {
+            users = addUser(users, user)
+        }
+    }
+    return users, nil
+}
+
+// unlinkedNames returns the distinct names of the subscriptions without a catalog entry, most
+// used first
+func (r *sqlCatalog) unlinkedNames(ctx context.Context) (_ []string, err error) {
+    query := r.statements.unlinked
+    ctx, st := r.startStatementOn(ctx, "subscriptions", "SELECT", query)
+    defer st.end(&err)
+
+    rows, err := r.conn().QueryContext(ctx, query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var names []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return nil, err
+        }
+        names = append(names, name)
+    }
+    return names, rows.Err()
+}
+
+// updateSubscriptions runs an UPDATE of subscriptions that returns user_id and collects the users
+func (r *sqlCatalog) updateSubscriptions(ctx context.Context, query string, args ...interface{}) (_ []uuid.UUID, err error) {
+    ctx, st := r.startStatementOn(ctx, "subscriptions", "UPDATE", query)
+    defer st.end(&err)
+
+    rows, err := r.conn().QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var users []uuid.UUID
+    for rows.Next() {
+        var user uuid.UUID
+        if err := rows.Scan(&user); err != nil {
+            return nil, err
+        }
+        users = addUser(users, user)
+    }
+    return users, rows.Err()
+}
+
+// addUser appends user to users unless it is there already
+func addUser(users []uuid.UUID, user uuid.UUID) []uuid.UUID {
+    for _, existing := range users {
+        if existing == user {
+            return users
+        }
+    }
+    return append(users, user)
+}
+
+// Seed adds the entries catalog.Seed finds for the names of the unlinked subscriptions and links
+// them in one transaction, which also records that the catalog was seeded
+func (r *sqlCatalog) Seed(ctx context.Context) (linked []uuid.UUID, err error) {
+    ctx, span := r.startCall(ctx, "Seed")
+    defer r.finishCall(ctx, span, "Seed", time.Now(), &err)
+
+    err = r.withTx(ctx, func(tx *sqlDB) error {
+        linked = nil
+        repo := &sqlCatalog{*tx, r.statements}
+        var seeded bool
+        query := r.statements.seeded
+        statementCtx, st := repo.startStatementOn(ctx, "services_seed_state", "SELECT", query)
+        err := repo.conn().QueryRowContext(statementCtx, query).Scan(&seeded)
+        st.end(&err)
+        if err != nil {
+            return fmt.Errorf("failed to get seed state: %w", err)
+        }
+        if seeded {
+            return nil
+        }
+
+        services, err := repo.list(ctx)
+        if err != nil {
+            return err
+        }
+        names, err := repo.unlinkedNames(ctx)
+        if err != nil {
+            return fmt.Errorf("failed to get unlinked subscriptions: %w", err)
+        }
+        for _, service := range catalog.Seed(services, names) {
+            if err := repo.insert(ctx, &service); err != nil {
+                return err
+            }
+            services = append(services, service)
+        }
+        linked, err = repo.link(ctx, services, nil)
+        if err != nil {
+            return err
+        }
+        if len(linked) > 0 {
+            if err := repo.rewriteSpend(ctx, linked); err != nil {
+                return err
+            }
+        }
+        return repo.execOn(ctx, "services_seed_state", "UPDATE", r.statements.setSeeded)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return linked, nil
+}
+
+// Delete removes the entry; the foreign key of subscriptions unlinks them
+func (r *sqlCatalog) Delete(ctx context.Context, id int) (err error) {
+    ctx, span := r.startCall(ctx, "Delete")
+    defer r.finishCall(ctx, span, "Delete", time.Now(), &err)
+
+    query := r.statements.delete
+    statementCtx, st := r.startStatementOn(ctx, "services", "DELETE", query)
+    result, err := r.conn().ExecContext(statementCtx, query, id)
+    st.end(&err)
+    if err != nil {
+        return fmt.Errorf("failed to delete service: %w", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get affected rows: %w", err)
+    }
+    if rowsAffected == 0 {
+        return errors.New("service not found")
+    }
+    return nil
+}
+
+// MemoryServiceRepository keeps the service catalog in memory next to a MemoryRepository,
+// whose subscriptions it renames and unlinks through the SubscriptionRepository interface
+type MemoryServiceRepository struct {
+    mu            sync.Mutex
+    services      map[int]model.Service
+    nextID        int
+    seeded        bool
+    subscriptions SubscriptionRepository
+}
+
+// NewMemoryServiceRepository creates an empty in-memory catalog for the subscriptions of subscriptions
+func NewMemoryServiceRepository(subscriptions SubscriptionRepository) ServiceRepository {
+    return &MemoryServiceRepository{services: make(map[int]model.Service), subscriptions: subscriptions}
+}
+
+func (r *MemoryServiceRepository) Create(ctx context.Context, service *model.Service) ([]uuid.UUID, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to create service: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    services := r.sorted()
+    if err := checkConflict(service, services); err != nil {
+        return nil, err
+    }
+    if service.Aliases == nil {
+        service.Aliases = []string{}
+    }
+    now := time.Now()
+    service.CreatedAt = now
+    service.UpdatedAt = now
+    service.ID = r.nextID + 1
+    linked, err := r.relink(ctx, append(services, *service), service, false)
+    if err != nil {
+        return nil, fmt.Errorf("failed to link subscriptions: %w", err)
+    }
+    r.nextID++
+    r.services[service.ID] = cloneService(*service)
+    return linked, nil
+}
+
+func (r *MemoryServiceRepository) GetByID(ctx context.Context, id int) (*model.Service, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to get service: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    service, ok := r.services[id]
+    if !ok {
+        return nil, errors.New("service not found")
+    }
+    service = cloneService(service)
+    return &service, nil
+}
+
+func (r *MemoryServiceRepository) List(ctx context.Context) ([]model.Service, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to get services: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.sorted(), nil
+}
+
+func (r *MemoryServiceRepository) Update(ctx context.Context, service *model.Service) ([]uuid.UUID, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to update service: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    current, ok := r.services[service.ID]
+    if !ok {
+        return nil, errors.New("service not found")
+    }
+    services := r.sorted()
+    if err := checkConflict(service, services); err != nil {
+        return nil, err
+    }
+    if service.Aliases == nil {
+        service.Aliases = []string{}
+    }
+    service.CreatedAt = current.CreatedAt
+    service.UpdatedAt = time.Now()
+    for i := range services {
+        if services[i].ID == service.ID {
+            services[i] = *service
+        }
+    }
+    relinked, err := r.relink(ctx, services, service, service.Name != current.Name)
+    if err != nil {
+        return nil, fmt.Errorf("failed to relink subscriptions: %w", err)
+    }
+    r.services[service.ID] = cloneService(*service)
+    return relinked, nil
+}
+
+func (r *MemoryServiceRepository) Delete(ctx context.Context, id int) error {
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to delete service: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if _, ok := r.services[id]; !ok {
+        return errors.New("service not found")
+    }
+    err := r.subscriptions.WithTx(ctx, func(tx SubscriptionRepository) error {
+        subscriptions, err := tx.GetAll(ctx)
+        if err != nil {
+            return err
+        }
+        for i := range subscriptions {
+            subscription := &subscriptions[i]
+            if subscription.ServiceID == nil || *subscription.ServiceID != id {
+                continue
+            }
+            subscription.ServiceID = nil
+            if err := tx.Update(ctx, subscription); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("failed to unlink subscriptions: %w", err)
+    }
+    delete(r.services, id)
+    return nil
+}
+
+// relink links the unlinked subscriptions to the entry of services, the whole catalog, that their
+// name matches in one transaction. With only set, just the subscriptions matching it are linked,
+// and with rename the subscriptions already linked to it take its name too. The users of the
+// changed subscriptions are returned.
+func (r *MemoryServiceRepository) relink(ctx context.Context, services []model.Service, only *model.Service, rename bool) (users []uuid.UUID, err error) {
+    err = r.subscriptions.WithTx(ctx, func(tx SubscriptionRepository) error {
+        users = nil
+        subscriptions, err := tx.GetAll(ctx)
+        if err != nil {
+            return err
+        }
+        for i := range subscriptions {
+            subscription := &subscriptions[i]
+            var service model.Service
+            if subscription.ServiceID != nil {
+                if !rename || *subscription.ServiceID != only.ID {
+                    continue
+                }
+                service = *only
+            } else {
+                match, ok := catalog.Match(subscription.ServiceName, services)
+                if !ok || (only != nil && match.ID != only.ID) {
+                    continue
+                }
+                service = match
+            }
+            subscription.ServiceID = &service.ID
+            subscription.ServiceName = service.Name
+            if err := tx.Update(ctx, subscription); err != nil {
+                return err
+            }
+            users = addUser(users, subscription.UserID)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return users, nil
+}
+
+// Seed adds the entries catalog.Seed finds for the names of the unlinked subscriptions, most used
+// first, and links them
+func (r *MemoryServiceRepository) Seed(ctx context.Context) ([]uuid.UUID, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to seed services: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.seeded {
+        return nil, nil
+    }
+
+    subscriptions, err := r.subscriptions.GetAll(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get unlinked subscriptions: %w", err)
+    }
+    // Most used first and, like the SQL backends, the earliest used first among equals
+    uses, first := make(map[string]int), make(map[string]int)
+    var names []string
+    for _, subscription := range subscriptions {
+        name := subscription.ServiceName
+        if subscription.ServiceID != nil {
+            continue
+        }
+        if uses[name] == 0 {
+            names = append(names, name)
+            first[name] = subscription.ID
+        } else if subscription.ID < first[name] {
+            first[name] = subscription.ID
+        }
+        uses[name]++
+    }
+    sort.Slice(names, func(i, j int) bool {
+        if uses[names[i]] != uses[names[j]] {
+            return uses[names[i]] > uses[names[j]]
+        }
+        return first[names[i]] < first[names[j]]
+    })
+
+    services := r.sorted()
+    added := catalog.Seed(services, names)
+    now := time.Now()
+    for i := range added {
+        added[i].ID = r.nextID + i + 1
+        added[i].CreatedAt = now
+        added[i].UpdatedAt = now
+        services = append(services, added[i])
+    }
+    linked, err := r.relink(ctx, services, nil, false)
+    if err != nil {
+        return nil, fmt.Errorf("failed to link subscriptions: %w", err)
+    }
+    for _, service := range added {
+        r.services[service.ID] = cloneService(service)
+    }
+    r.nextID += len(added)
+    r.seeded = true
+    return linked, nil
+}
+
+// sorted returns copies of the entries in the order of their IDs
+func (r *MemoryServiceRepository) sorted() []model.Service {
+    services := make([]model.Service, 0, len(r.services))
+    for _, service := range r.services {
+        services = append(services, cloneService(service))
+    }
+    sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+    return services
+}
+
+// cloneService copies s so that callers cannot modify stored data through its slices and pointers
+func cloneService(s model.Service) model.Service {
+    s.Aliases = append([]string{}, s.Aliases...)
+    if s.DefaultPrice != nil {
+        price := *s.DefaultPrice
+        s.DefaultPrice = &price
+    }
+    return s
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "subscription-service/internal/model"
+)
+
+// monthNumber counts months from year 0, so that consecutive months differ by one
+func monthNumber(t time.Time) int {
+    return t.Year()*12 + int(t.Month()) - 1
+}
+
+// formatMonthNumber turns a month number back into MM-YYYY
+func formatMonthNumber(n int) string {
+    return fmt.Sprintf("%02d-%04d", n%12+1, n/12)
+}
+
+// parseMonth returns the month number of an MM-YYYY date
+func parseMonth(date string) (int, error) {
+    month, err := time.Parse("01-2006", date)
+    if err != nil {
+        return 0, err
+    }
+    return monthNumber(month), nil
+}
+
+// summarizeCost aggregates subscriptions in memory the way SummarizeCost does in SQL
+func summarizeCost(subscriptions []model.Subscription, period *string, now time.Time) *model.CostSummary {
+    type activeRange struct {
+        start, end, price int
+    }
+
+    summary := &model.CostSummary{Months: []model.MonthlyCost{}}
+    ranges := make([]activeRange, 0, len(subscriptions))
+    first, last := 0, 0
+    for _, subscription := range subscriptions {
+        summary.TotalCost += subscription.Price
+        summary.SubscriptionCount++
+
+        start, err := time.Parse("01-2006", subscription.StartDate)
+        if err != nil {
+            continue
+        }
+        active := activeRange{start: monthNumber(start), price: subscription.Price}
+        // Open-ended subscriptions run to the current month, or their start if that is later
+        active.end = monthNumber(now)
+        if active.start > active.end {
+            active.end = active.start
+        }
+        if subscription.EndDate != nil {
+            end, err := time.Parse("01-2006", *subscription.EndDate)
+            if err != nil {
+                continue
+            }
+            active.end = monthNumber(end)
+        }
+        if len(ranges) == 0 || active.start < first {
+            first = active.start
+        }
+        if len(ranges) == 0 || active.end > last {
+            last = active.end
+        }
+        ranges = append(ranges, active)
+    }
+
+    if period != nil && *period != "" {
+        month, err := time.Parse("01-2006", *period)
+        if err != nil {
+            return summary
+        }
+        first, last = monthNumber(month), monthNumber(month)
+    } else if len(ranges) == 0 {
+        return summary
+    }
+
+    for month := first; month <= last; month++ {
+        cost := model.MonthlyCost{Month: formatMonthNumber(month)}
+        for _, active := range ranges {
+            if active.start <= month && active.end >= month {
+                cost.Cost += active.price
+                cost.SubscriptionCount++
+            }
+        }
+        summary.Months = append(summary.Months, cost)
+    }
+    return summary
+}
+
+// groupCost sums subscriptions per value of the groupBy dimension the way SummarizeCost does in
+// SQL. A subscription counts once in each of its tags; without a category or tags it falls into
+// the empty key.
+func groupCost(subscriptions []model.Subscription, groupBy string) []model.CostGroup {
+    groups := make(map[string]*model.CostGroup)
+    add := func(key string, subscription model.Subscription) {
+        group, ok := groups[key]
+        if !ok {
+            group = &model.CostGroup{Key: key}
+            groups[key] = group
+        }
+        group.TotalCost += subscription.Price
+        group.SubscriptionCount++
+    }
+    for _, subscription := range subscriptions {
+        switch groupBy {
+        case model.GroupByCategory:
+            category := ""
+            if subscription.Category != nil {
+                category = *subscription.Category
+            }
+            add(category, subscription)
+        case model.GroupByTag:
+            if len(subscription.Tags) == 0 {
+                add("", subscription)
+            }
+            for _, tag := range subscription.Tags {
+                add(tag, subscription)
+            }
+        case model.GroupByServiceName:
+            add(subscription.ServiceName, subscription)
+        }
+    }
+
+    result := make([]model.CostGroup, 0, len(groups))
+    for _, group := range groups {
+        result = append(result, *group)
+    }
+    sortCostGroups(result)
+    return result
+}
+
+// sortCostGroups puts the most expensive groups first, and groups of the same cost by key
+func sortCostGroups(groups []model.CostGroup) {
+    sort.Slice(groups, func(i, j int) bool {
+        a, b := groups[i], groups[j]
+        if a.TotalCost != b.TotalCost {
+            return a.TotalCost > b.TotalCost
+        }
+        return a.Key < b.Key
+    })
+}
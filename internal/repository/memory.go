@@ -0,0 +1,312 @@
+package repository
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+
+    "subscription-service/internal/model"
+)
+
+// MemoryRepository keeps subscriptions in memory. It is safe for concurrent use and behaves
+// like PostgresRepository: same ordering, filters and errors. Data is lost on restart.
+type MemoryRepository struct {
+    mu *sync.RWMutex
+    // subscriptions is the live data, or a transaction's working copy
+    subscriptions map[int]model.Subscription
+    // nextID is shared with transactions: like a PostgreSQL sequence, IDs taken by a
+    // rolled back transaction are not reused
+    nextID *int
+    // inTx is set on the repositories handed to WithTx callbacks, which run under the write lock
+    inTx bool
+}
+
+// NewMemoryRepository creates an empty in-memory repository
+func NewMemoryRepository() SubscriptionRepository {
+    return &MemoryRepository{
+        mu:            &sync.RWMutex{},
+        subscriptions: make(map[int]model.Subscription),
+        nextID:        new(int),
+    }
+}
+
+// lock takes the write lock unless r belongs to a transaction, which holds it already
+func (r *MemoryRepository) lock() (unlock func()) {
+    if r.inTx {
+        return func() {}
+    }
+    r.mu.Lock()
+    return r.mu.Unlock
+}
+
+func (r *MemoryRepository) rlock() (unlock func()) {
+    if r.inTx {
+        return func() {}
+    }
+    r.mu.RLock()
+    return r.mu.RUnlock
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, subscription *model.Subscription) error {
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to create subscription: %w", err)
+    }
+    defer r.lock()()
+
+    if subscription.Price <= 0 {
+        return errors.New("failed to create subscription: price must be greater than 0")
+    }
+    now := time.Now()
+    subscription.CreatedAt = now
+    subscription.UpdatedAt = now
+    *r.nextID++
+    subscription.ID = *r.nextID
+    r.subscriptions[subscription.ID] = cloneSubscription(*subscription)
+    return nil
+}
+
+func (r *MemoryRepository) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to get subscription: %w", err)
+    }
+    defer r.rlock()()
+    subscription, ok := r.subscriptions[id]
+    if !ok {
+        return nil, errors.New("subscription not found")
+    }
+    subscription = cloneSubscription(subscription)
+    return &subscription, nil
+}
+
+func (r *MemoryRepository) GetAll(ctx context.Context) ([]model.Subscription, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to get subscriptions: %w", err)
+    }
+    return r.matching(model.SubscriptionFilter{}), nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, subscription *model.Subscription) error {
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to update subscription: %w", err)
+    }
+    defer r.lock()()
+
+    existing, ok := r.subscriptions[subscription.ID]
+    if !ok {
+        return errors.New("subscription not found")
+    }
+    subscription.UpdatedAt = time.Now()
+    updated := cloneSubscription(*subscription)
+    // created_at is not touched by updates
+    updated.CreatedAt = existing.CreatedAt
+    r.subscriptions[subscription.ID] = updated
+    return nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id int) error {
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to delete subscription: %w", err)
+    }
+    defer r.lock()()
+
+    if _, ok := r.subscriptions[id]; !ok {
+        return errors.New("subscription not found")
+    }
+    delete(r.subscriptions, id)
+    return nil
+}
+
+// ApplyBatch applies all operations in a transaction, keeping them only if every operation succeeds
+func (r *MemoryRepository) ApplyBatch(ctx context.Context, ops []BatchOp) error {
+    return r.WithTx(ctx, func(tx SubscriptionRepository) error {
+        return applyBatch(ctx, tx, ops)
+    })
+}
+
+// WithTx runs fn against a copy of the data under the write lock and keeps the copy if fn
+// succeeds. Conflicts are impossible, so fn runs exactly once; it must not use r itself.
+func (r *MemoryRepository) WithTx(ctx context.Context, fn func(SubscriptionRepository) error) error {
+    if r.inTx {
+        return fn(r)
+    }
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    tx := &MemoryRepository{
+        mu:            r.mu,
+        subscriptions: make(map[int]model.Subscription, len(r.subscriptions)),
+        nextID:        r.nextID,
+        inTx:          true,
+    }
+    for id, subscription := range r.subscriptions {
+        tx.subscriptions[id] = subscription
+    }
+
+    if err := fn(tx); err != nil {
+        return err
+    }
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    r.subscriptions = tx.subscriptions
+    return nil
+}
+
+// WithSnapshot runs fn against a copy of the data taken under the read lock. Writes made through
+// the copy are discarded.
+func (r *MemoryRepository) WithSnapshot(ctx context.Context, fn func(SubscriptionRepository) error) error {
+    if r.inTx {
+        return fn(r)
+    }
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    r.mu.RLock()
+    nextID := *r.nextID
+    snapshot := &MemoryRepository{
+        mu:            &sync.RWMutex{},
+        subscriptions: make(map[int]model.Subscription, len(r.subscriptions)),
+        nextID:        &nextID,
+    }
+    for id, subscription := range r.subscriptions {
+        snapshot.subscriptions[id] = subscription
+    }
+    r.mu.RUnlock()
+
+    return fn(snapshot)
+}
+
+// GetByFilters retrieves subscriptions based on optional filters
+func (r *MemoryRepository) GetByFilters(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to get filtered subscriptions: %w", err)
+    }
+    return r.matching(filter), nil
+}
+
+// SummarizeCost aggregates the subscriptions matching the optional filters
+func (r *MemoryRepository) SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (*model.CostSummary, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("failed to summarize cost: %w", err)
+    }
+    subscriptions := r.matching(filter)
+    summary := summarizeCost(subscriptions, filter.Period, time.Now())
+    if groupBy != "" {
+        summary.GroupBy = groupBy
+        summary.Groups = groupCost(subscriptions, groupBy)
+    }
+    return summary, nil
+}
+
+// IterateByFilters calls fn for every subscription matching the optional filters. It works on a
+// snapshot, so fn may use the repository.
+func (r *MemoryRepository) IterateByFilters(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) error {
+    subscriptions, err := r.GetByFilters(ctx, filter)
+    if err != nil {
+        return err
+    }
+    for i := range subscriptions {
+        if err := ctx.Err(); err != nil {
+            return fmt.Errorf("error iterating filtered subscriptions: %w", err)
+        }
+        if err := fn(&subscriptions[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// matching returns copies of the subscriptions matching the filters, newest first
+func (r *MemoryRepository) matching(filter model.SubscriptionFilter) []model.Subscription {
+    defer r.rlock()()
+
+    // Empty results are an empty slice, never nil, so they encode as [] rather than null
+    subscriptions := []model.Subscription{}
+    for _, subscription := range r.subscriptions {
+        if filter.UserID != nil && subscription.UserID != *filter.UserID {
+            continue
+        }
+        if filter.ServiceName != nil && *filter.ServiceName != "" && subscription.ServiceName != *filter.ServiceName {
+            continue
+        }
+        if filter.Period != nil && *filter.Period != "" && !activeInPeriod(subscription, *filter.Period) {
+            continue
+        }
+        if filter.Category != nil && *filter.Category != "" &&
+            (subscription.Category == nil || *subscription.Category != *filter.Category) {
+            continue
+        }
+        if !hasTags(subscription, filter.Tags) {
+            continue
+        }
+        subscriptions = append(subscriptions, cloneSubscription(subscription))
+    }
+    sort.Slice(subscriptions, func(i, j int) bool {
+        a, b := subscriptions[i], subscriptions[j]
+        if !a.CreatedAt.Equal(b.CreatedAt) {
+            return a.CreatedAt.After(b.CreatedAt)
+        }
+        return a.ID > b.ID
+    })
+    return subscriptions
+}
+
+// activeInPeriod reports whether the subscription runs in the MM-YYYY month period
+func activeInPeriod(subscription model.Subscription, period string) bool {
+    month, err := time.Parse("01-2006", period)
+    if err != nil {
+        return false
+    }
+    start, err := time.Parse("01-2006", subscription.StartDate)
+    if err != nil || start.After(month) {
+        return false
+    }
+    if subscription.EndDate == nil {
+        return true
+    }
+    end, err := time.Parse("01-2006", *subscription.EndDate)
+    return err == nil && !end.Before(month)
+}
+
+// hasTags reports whether the subscription carries every one of tags
+func hasTags(subscription model.Subscription, tags []string) bool {
+    for _, tag := range tags {
+        found := false
+        for _, own := range subscription.Tags {
+            if own == tag {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
+
+// cloneSubscription copies s so that callers cannot modify stored data through its pointers
+func cloneSubscription(s model.Subscription) model.Subscription {
+    if s.EndDate != nil {
+        end := *s.EndDate
+        s.EndDate = &end
+    }
+    if s.ServiceID != nil {
+        id := *s.ServiceID
+        s.ServiceID = &id
+    }
+    if s.Category != nil {
+        category := *s.Category
+        s.Category = &category
+    }
+    if s.Tags != nil {
+        s.Tags = append([]string(nil), s.Tags...)
+    }
+    return s
+}
@@ -1,42 +1,222 @@
 package repository
 
 import (
+    "context"
     "database/sql"
     "errors"
     "fmt"
     "time"
     
+    "subscription-service/internal/logger"
     "subscription-service/internal/model"
-    "github.com/google/uuid"
+    "github.com/lib/pq"
+    semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 // SubscriptionRepository defines the repository interface
 type SubscriptionRepository interface {
-    Create(subscription *model.Subscription) error
-    GetByID(id int) (*model.Subscription, error)
-    GetAll() ([]model.Subscription, error)
-    Update(subscription *model.Subscription) error
-    Delete(id int) error
-    GetByFilters(userID *uuid.UUID, serviceName *string, period *string) ([]model.Subscription, error)
+    Create(ctx context.Context, subscription *model.Subscription) error
+    GetByID(ctx context.Context, id int) (*model.Subscription, error)
+    GetAll(ctx context.Context) ([]model.Subscription, error)
+    Update(ctx context.Context, subscription *model.Subscription) error
+    Delete(ctx context.Context, id int) error
+    GetByFilters(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error)
+    IterateByFilters(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) error
+    // SummarizeCost aggregates the subscriptions matching the optional filters without loading them.
+    // The monthly breakdown covers the period if one is given, otherwise every month from the earliest
+    // start date to the latest end date, with open-ended subscriptions running to the current month.
+    // With groupBy, one of the model.GroupBy dimensions, the summary also holds the cost per value of
+    // it, most expensive first. The groups are aggregated by a statement of their own, so they add up
+    // to the totals only when read inside WithSnapshot.
+    SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (*model.CostSummary, error)
+    // ApplyBatch applies ops in order in one transaction, joining a running one, and reports the
+    // first failure as a *BatchError
+    ApplyBatch(ctx context.Context, ops []BatchOp) error
+    // WithTx runs fn in a transaction and commits it only if fn returns nil. Everything done through
+    // the repository passed to fn is part of the transaction; that repository must not be used
+    // after fn returns. Calling WithTx on it joins the running transaction. fn may be run more
+    // than once when the transaction conflicts with another one, so it must not have side effects
+    // outside the repository.
+    WithTx(ctx context.Context, fn func(SubscriptionRepository) error) error
+    // WithSnapshot runs fn in a read-only transaction, so everything fn reads through the repository
+    // passed to it is consistent. The snapshot may come from a replica and lag behind recent writes,
+    // and fn may be run more than once. Calling it inside WithTx joins the running transaction.
+    WithSnapshot(ctx context.Context, fn func(SubscriptionRepository) error) error
+}
+
+// BatchOp is a single write applied by ApplyBatch
+type BatchOp struct {
+    Op           string
+    ID           int
+    Subscription *model.Subscription
+}
+
+// BatchError reports which operation of a batch failed
+type BatchError struct {
+    Index int
+    Err   error
+}
+
+func (e *BatchError) Error() string {
+    return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+    return e.Err
+}
+
+// applyBatch runs ops in order on repo, which is bound to a transaction, and reports the
+// first failure as a BatchError
+func applyBatch(ctx context.Context, repo SubscriptionRepository, ops []BatchOp) error {
+    for i, op := range ops {
+        var err error
+        switch op.Op {
+        case model.BatchOpCreate:
+            err = repo.Create(ctx, op.Subscription)
+        case model.BatchOpUpdate:
+            err = repo.Update(ctx, op.Subscription)
+        case model.BatchOpDelete:
+            err = repo.Delete(ctx, op.ID)
+        default:
+            err = fmt.Errorf("unknown operation %q", op.Op)
+        }
+        if err != nil {
+            return &BatchError{Index: i, Err: err}
+        }
+    }
+    return nil
 }
 
 type PostgresRepository struct {
-    db *sql.DB
+    sqlDB
+}
+
+// NewPostgresRepository creates a repository that bounds every statement by queryTimeout
+// in addition to the caller's context; zero disables the timeout
+func NewPostgresRepository(db *sql.DB, log *logger.Logger, queryTimeout time.Duration) SubscriptionRepository {
+    return NewPostgresRepositoryWithReplica(db, nil, log, queryTimeout)
+}
+
+// NewPostgresRepositoryWithReplica creates a repository that reads listings and cost reports from
+// replica while it is usable. Writes, lookups by ID and transactions always use db, so a
+// subscription can be read back right after it was written.
+func NewPostgresRepositoryWithReplica(db *sql.DB, replica Replica, log *logger.Logger, queryTimeout time.Duration) SubscriptionRepository {
+    return &PostgresRepository{sqlDB{
+        db:           db,
+        log:          log,
+        queryTimeout: queryTimeout,
+        system:       semconv.DBSystemPostgreSQL,
+        txOptions:    &sql.TxOptions{Isolation: sql.LevelSerializable},
+        retryable:    isSerializationFailure,
+        replica:      replica,
+        spend:        postgresSpend,
+        watermark:    &spendWatermark{},
+        list:         postgresList,
+    }}
+}
+
+// postgresList stores lists in text[] columns
+func postgresList(list *[]string) listColumn {
+    return (*pq.StringArray)(list)
+}
+
+// postgresMonthNumber is the SQL counterpart of monthNumber for an MM-YYYY column
+func postgresMonthNumber(column string) string {
+    return fmt.Sprintf("(substr(%[1]s, 4, 4)::integer * 12 + substr(%[1]s, 1, 2)::integer - 1)", column)
+}
+
+// postgresCloseMonths materializes the months from $1 up to, not including, $2 of the
+// subscriptions that where selects
+func postgresCloseMonths(where string) string {
+    return `INSERT INTO monthly_spend (user_id, service_name, month, amount, subscription_count)
+        SELECT s.user_id, s.service_name, m.month, SUM(s.price), COUNT(*)
+        FROM subscriptions s
+        CROSS JOIN LATERAL generate_series(
+            GREATEST(` + postgresMonthNumber("s.start_date") + `, $1::integer),
+            LEAST(COALESCE(` + postgresMonthNumber("s.end_date") + `, $2::integer - 1), $2::integer - 1)) AS m(month)
+        WHERE ` + where + `
+        GROUP BY s.user_id, s.service_name, m.month`
+}
+
+var postgresSpend = &spendStatements{
+    state:           "SELECT closed_before FROM monthly_spend_state",
+    setState:        "UPDATE monthly_spend_state SET closed_before = $1",
+    closeMonths:     postgresCloseMonths("true"),
+    closeUserMonths: postgresCloseMonths("s.user_id = $3::uuid"),
+    add: `INSERT INTO monthly_spend (user_id, service_name, month, amount, subscription_count)
+        SELECT $3::uuid, $4::varchar, m.month, $5::bigint, $6::integer
+        FROM generate_series($1::integer, $2::integer) AS m(month)
+        ON CONFLICT (user_id, service_name, month) DO UPDATE
+        SET amount = monthly_spend.amount + excluded.amount,
+            subscription_count = monthly_spend.subscription_count + excluded.subscription_count`,
+    prune:     "DELETE FROM monthly_spend WHERE user_id = $1 AND service_name = $2 AND subscription_count = 0",
+    clearUser: "DELETE FROM monthly_spend WHERE user_id = $1",
 }
 
-func NewPostgresRepository(db *sql.DB) SubscriptionRepository {
-    return &PostgresRepository{db: db}
+// NewPostgresServiceRepository creates the service catalog stored next to the subscriptions of
+// NewPostgresRepository, with the same query timeout
+func NewPostgresServiceRepository(db *sql.DB, log *logger.Logger, queryTimeout time.Duration) ServiceRepository {
+    return &sqlCatalog{
+        sqlDB: sqlDB{
+            db:           db,
+            log:          log,
+            queryTimeout: queryTimeout,
+            system:       semconv.DBSystemPostgreSQL,
+            txOptions:    &sql.TxOptions{Isolation: sql.LevelSerializable},
+            retryable:    isSerializationFailure,
+            spend:        postgresSpend,
+            watermark:    &spendWatermark{},
+            list:         postgresList,
+        },
+        statements: postgresCatalog,
+    }
+}
+
+var postgresCatalog = &catalogStatements{
+    list: "SELECT " + serviceColumns + " FROM services ORDER BY id",
+    get:  "SELECT " + serviceColumns + " FROM services WHERE id = $1",
+    insert: `INSERT INTO services (name, aliases, category, website, default_price, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+    update: `UPDATE services SET name = $1, aliases = $2, category = $3, website = $4, default_price = $5,
+        updated_at = $6 WHERE id = $7`,
+    delete: "DELETE FROM services WHERE id = $1",
+    rename: "UPDATE subscriptions SET service_name = $1, updated_at = $2 WHERE service_id = $3 RETURNING user_id",
+    unlinked: `SELECT service_name FROM subscriptions WHERE service_id IS NULL
+        GROUP BY service_name ORDER BY count(*) DESC, min(id)`,
+    link: `UPDATE subscriptions SET service_id = $1, service_name = $2, updated_at = $3
+        WHERE service_id IS NULL AND service_name = $4 RETURNING user_id`,
+    seeded:    "SELECT seeded FROM services_seed_state",
+    setSeeded: "UPDATE services_seed_state SET seeded = true",
+}
+
+// isSerializationFailure reports serialization failures and detected deadlocks, after which
+// PostgreSQL expects the whole transaction to be retried
+func isSerializationFailure(err error) bool {
+    var pqErr *pq.Error
+    return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+func (r *PostgresRepository) Create(ctx context.Context, subscription *model.Subscription) (err error) {
+    ctx, span := r.startCall(ctx, "Create")
+    defer r.finishCall(ctx, span, "Create", time.Now(), &err)
+    return r.withSpend(ctx, func(tx *sqlDB) (*model.Subscription, *model.Subscription, error) {
+        repo := &PostgresRepository{*tx}
+        return nil, subscription, repo.createSubscription(ctx, tx.conn(), subscription)
+    })
 }
 
-func (r *PostgresRepository) Create(subscription *model.Subscription) error {
-    query := `INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date, created_at, updated_at) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+func (r *PostgresRepository) createSubscription(ctx context.Context, q queryer, subscription *model.Subscription) (err error) {
+    query := `INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date, created_at, updated_at, service_id, category, tags) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
     
     now := time.Now()
     subscription.CreatedAt = now
     subscription.UpdatedAt = now
     
-    err := r.db.QueryRow(query, 
+    ctx, st := r.startStatement(ctx, "INSERT", query)
+    defer st.end(&err)
+    
+    err = q.QueryRowContext(ctx, query, 
         subscription.ServiceName,
         subscription.Price,
         subscription.UserID,
@@ -44,6 +224,9 @@ func (r *PostgresRepository) Create(subscription *model.Subscription) error {
         subscription.EndDate,
         subscription.CreatedAt,
         subscription.UpdatedAt,
+        subscription.ServiceID,
+        subscription.Category,
+        r.listValue(subscription.Tags),
     ).Scan(&subscription.ID)
     
     if err != nil {
@@ -52,24 +235,19 @@ func (r *PostgresRepository) Create(subscription *model.Subscription) error {
     return nil
 }
 
-func (r *PostgresRepository) GetByID(id int) (*model.Subscription, error) {
-    query := `SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at 
-              FROM subscriptions WHERE id = $1`
+func (r *PostgresRepository) GetByID(ctx context.Context, id int) (_ *model.Subscription, err error) {
+    ctx, span := r.startCall(ctx, "GetByID")
+    defer r.finishCall(ctx, span, "GetByID", time.Now(), &err)
+
+    query := "SELECT " + subscriptionColumns + " FROM subscriptions WHERE id = $1"
     
+    statementCtx, st := r.startStatement(ctx, "SELECT", query)
     subscription := &model.Subscription{}
-    err := r.db.QueryRow(query, id).Scan(
-        &subscription.ID,
-        &subscription.ServiceName,
-        &subscription.Price,
-        &subscription.UserID,
-        &subscription.StartDate,
-        &subscription.EndDate,
-        &subscription.CreatedAt,
-        &subscription.UpdatedAt,
-    )
+    err = r.scanSubscription(r.conn().QueryRowContext(statementCtx, query, id), subscription)
+    st.end(&err)
     
     if err != nil {
-        if err == sql.ErrNoRows {
+        if errors.Is(err, sql.ErrNoRows) {
             return nil, errors.New("subscription not found")
         }
         return nil, fmt.Errorf("failed to get subscription: %w", err)
@@ -77,29 +255,25 @@ func (r *PostgresRepository) GetByID(id int) (*model.Subscription, error) {
     return subscription, nil
 }
 
-func (r *PostgresRepository) GetAll() ([]model.Subscription, error) {
-    query := `SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at 
-              FROM subscriptions ORDER BY created_at DESC`
+func (r *PostgresRepository) GetAll(ctx context.Context) (_ []model.Subscription, err error) {
+    ctx, span := r.startCall(ctx, "GetAll")
+    defer r.finishCall(ctx, span, "GetAll", time.Now(), &err)
+
+    query := "SELECT " + subscriptionColumns + " FROM subscriptions ORDER BY created_at DESC, id DESC"
+    
+    ctx, st := r.startStatement(ctx, "SELECT", query)
+    defer st.end(&err)
     
-    rows, err := r.db.Query(query)
+    rows, err := r.queryReport(ctx, query)
     if err != nil {
         return nil, fmt.Errorf("failed to get subscriptions: %w", err)
     }
     defer rows.Close()
 
-    var subscriptions []model.Subscription
+    subscriptions := []model.Subscription{}
     for rows.Next() {
         subscription := model.Subscription{}
-        if err := rows.Scan(
-            &subscription.ID,
-            &subscription.ServiceName,
-            &subscription.Price,
-            &subscription.UserID,
-            &subscription.StartDate,
-            &subscription.EndDate,
-            &subscription.CreatedAt,
-            &subscription.UpdatedAt,
-        ); err != nil {
+        if err := r.scanSubscription(rows, &subscription); err != nil {
             return nil, fmt.Errorf("failed to scan subscription: %w", err)
         }
         subscriptions = append(subscriptions, subscription)
@@ -112,19 +286,38 @@ func (r *PostgresRepository) GetAll() ([]model.Subscription, error) {
     return subscriptions, nil
 }
 
-func (r *PostgresRepository) Update(subscription *model.Subscription) error {
+func (r *PostgresRepository) Update(ctx context.Context, subscription *model.Subscription) (err error) {
+    ctx, span := r.startCall(ctx, "Update")
+    defer r.finishCall(ctx, span, "Update", time.Now(), &err)
+    return r.withSpend(ctx, func(tx *sqlDB) (*model.Subscription, *model.Subscription, error) {
+        repo := &PostgresRepository{*tx}
+        old, err := repo.GetByID(ctx, subscription.ID)
+        if err != nil {
+            return nil, nil, err
+        }
+        return old, subscription, repo.updateSubscription(ctx, tx.conn(), subscription)
+    })
+}
+
+func (r *PostgresRepository) updateSubscription(ctx context.Context, q queryer, subscription *model.Subscription) (err error) {
     query := `UPDATE subscriptions SET service_name = $1, price = $2, user_id = $3, 
-              start_date = $4, end_date = $5, updated_at = $6 WHERE id = $7`
+              start_date = $4, end_date = $5, updated_at = $6, service_id = $7, category = $8, tags = $9 WHERE id = $10`
+    
+    ctx, st := r.startStatement(ctx, "UPDATE", query)
+    defer st.end(&err)
     
     subscription.UpdatedAt = time.Now()
     
-    result, err := r.db.Exec(query,
+    result, err := q.ExecContext(ctx, query,
         subscription.ServiceName,
         subscription.Price,
         subscription.UserID,
         subscription.StartDate,
         subscription.EndDate,
         subscription.UpdatedAt,
+        subscription.ServiceID,
+        subscription.Category,
+        r.listValue(subscription.Tags),
         subscription.ID,
     )
     if err != nil {
@@ -141,9 +334,26 @@ func (r *PostgresRepository) Update(subscription *model.Subscription) error {
     return nil
 }
 
-func (r *PostgresRepository) Delete(id int) error {
+func (r *PostgresRepository) Delete(ctx context.Context, id int) (err error) {
+    ctx, span := r.startCall(ctx, "Delete")
+    defer r.finishCall(ctx, span, "Delete", time.Now(), &err)
+    return r.withSpend(ctx, func(tx *sqlDB) (*model.Subscription, *model.Subscription, error) {
+        repo := &PostgresRepository{*tx}
+        old, err := repo.GetByID(ctx, id)
+        if err != nil {
+            return nil, nil, err
+        }
+        return old, nil, repo.deleteSubscription(ctx, tx.conn(), id)
+    })
+}
+
+func (r *PostgresRepository) deleteSubscription(ctx context.Context, q queryer, id int) (err error) {
     query := "DELETE FROM subscriptions WHERE id = $1"
-    result, err := r.db.Exec(query, id)
+    
+    ctx, st := r.startStatement(ctx, "DELETE", query)
+    defer st.end(&err)
+    
+    result, err := q.ExecContext(ctx, query, id)
     if err != nil {
         return fmt.Errorf("failed to delete subscription: %w", err)
     }
@@ -158,66 +368,230 @@ func (r *PostgresRepository) Delete(id int) error {
     return nil
 }
 
+// ApplyBatch executes all operations in a single transaction, rolling back on the first failure.
+// Each statement is bounded by the query timeout; cancelling ctx rolls the transaction back.
+func (r *PostgresRepository) ApplyBatch(ctx context.Context, ops []BatchOp) (err error) {
+    ctx, span := r.startCall(ctx, "ApplyBatch")
+    defer r.finishCall(ctx, span, "ApplyBatch", time.Now(), &err)
+    return r.WithTx(ctx, func(tx SubscriptionRepository) error {
+        return applyBatch(ctx, tx, ops)
+    })
+}
+
+// WithTx runs fn in a serializable transaction, retrying it on serialization failures
+func (r *PostgresRepository) WithTx(ctx context.Context, fn func(SubscriptionRepository) error) (err error) {
+    ctx, span := r.startCall(ctx, "WithTx")
+    defer r.finishCall(ctx, span, "WithTx", time.Now(), &err)
+    return r.withTx(ctx, func(tx *sqlDB) error {
+        return fn(&PostgresRepository{*tx})
+    })
+}
+
+// WithSnapshot runs fn in a read-only repeatable read transaction, on the replica while it is usable
+func (r *PostgresRepository) WithSnapshot(ctx context.Context, fn func(SubscriptionRepository) error) (err error) {
+    ctx, span := r.startCall(ctx, "WithSnapshot")
+    defer r.finishCall(ctx, span, "WithSnapshot", time.Now(), &err)
+    return r.withSnapshot(ctx, func(tx *sqlDB) error {
+        return fn(&PostgresRepository{*tx})
+    })
+}
+
 // GetByFilters retrieves subscriptions based on optional filters
-func (r *PostgresRepository) GetByFilters(userID *uuid.UUID, serviceName *string, period *string) ([]model.Subscription, error) {
-    query := `SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at 
-              FROM subscriptions WHERE 1=1`
+func (r *PostgresRepository) GetByFilters(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+    subscriptions := []model.Subscription{}
+    err := r.IterateByFilters(ctx, filter, func(subscription *model.Subscription) error {
+        subscriptions = append(subscriptions, *subscription)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return subscriptions, nil
+}
+
+// IterateByFilters streams subscriptions matching the optional filters to fn row by row,
+// without loading the whole result set into memory. Iteration stops at the first error returned by fn.
+// The query timeout applies to waiting for the database, not to the time spent in fn.
+func (r *PostgresRepository) IterateByFilters(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) (err error) {
+    ctx, span := r.startCall(ctx, "IterateByFilters")
+    defer r.finishCall(ctx, span, "IterateByFilters", time.Now(), &err)
+
+    where, args := postgresFilters(filter)
+    query := "SELECT " + subscriptionColumns + " FROM subscriptions WHERE 1=1" + where + " ORDER BY created_at DESC, id DESC"
+    
+    ctx, st := r.startStatement(ctx, "SELECT", query)
+    defer st.end(&err)
+    
+    rows, err := r.queryReport(ctx, query, args...)
+    if err != nil {
+        return fmt.Errorf("failed to get filtered subscriptions: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        subscription := model.Subscription{}
+        if err := r.scanSubscription(rows, &subscription); err != nil {
+            return fmt.Errorf("failed to scan subscription: %w", err)
+        }
+        st.pause()
+        if err := fn(&subscription); err != nil {
+            return err
+        }
+        st.resume()
+    }
     
+    if err = rows.Err(); err != nil {
+        return fmt.Errorf("error iterating filtered subscriptions: %w", err)
+    }
+    
+    return nil
+}
+// postgresFilters builds the conditions shared by the filtered queries, numbering
+// the placeholders from $1
+func postgresFilters(filter model.SubscriptionFilter) (string, []interface{}) {
+    var where string
     var args []interface{}
     argCount := 0
     
-    if userID != nil {
+    if filter.UserID != nil {
         argCount++
-        query += fmt.Sprintf(" AND user_id = $%d", argCount)
-        args = append(args, *userID)
+        where += fmt.Sprintf(" AND user_id = $%d", argCount)
+        args = append(args, *filter.UserID)
     }
     
-    if serviceName != nil && *serviceName != "" {
+    if filter.ServiceName != nil && *filter.ServiceName != "" {
         argCount++
-        query += fmt.Sprintf(" AND service_name = $%d", argCount)
-        args = append(args, *serviceName)
+        where += fmt.Sprintf(" AND service_name = $%d", argCount)
+        args = append(args, *filter.ServiceName)
     }
     
-    if period != nil && *period != "" {
-        // Filter by period - assuming period format is "MM-YYYY"
+    if filter.Period != nil && *filter.Period != "" {
+        // Dates are stored as MM-YYYY strings, which do not sort chronologically as text
         argCount++
-        query += fmt.Sprintf(" AND start_date <= $%d", argCount)
-        args = append(args, *period)
+        where += fmt.Sprintf(" AND to_date(start_date, 'MM-YYYY') <= to_date($%d, 'MM-YYYY')", argCount)
+        args = append(args, *filter.Period)
         
         argCount++
-        query += fmt.Sprintf(" AND (end_date IS NULL OR end_date >= $%d)", argCount)
-        args = append(args, *period)
+        where += fmt.Sprintf(" AND (end_date IS NULL OR to_date(end_date, 'MM-YYYY') >= to_date($%d, 'MM-YYYY'))", argCount)
+        args = append(args, *filter.Period)
     }
     
-    query += " ORDER BY created_at DESC"
+    if filter.Category != nil && *filter.Category != "" {
+        argCount++
+        where += fmt.Sprintf(" AND category = $%d", argCount)
+        args = append(args, *filter.Category)
+    }
     
-    rows, err := r.db.Query(query, args...)
+    if len(filter.Tags) > 0 {
+        argCount++
+        where += fmt.Sprintf(" AND tags @> $%d", argCount)
+        args = append(args, pq.StringArray(filter.Tags))
+    }
+    return where, args
+}
+
+// postgresCostQuery sums the matching subscriptions per month between the bounds. Closed months are
+// read from monthly_spend; only the months from its watermark on are computed by joining the
+// subscriptions to the series of months. The totals are repeated on every row. Its placeholders after
+// the filters are the current month and the period, or NULL, as month numbers; the monthly_spend
+// conditions reuse the user and service placeholders of the filters.
+var postgresCostQuery = `WITH filtered AS (
+        SELECT price, ` + postgresMonthNumber("start_date") + ` AS start_month,
+               COALESCE(` + postgresMonthNumber("end_date") + `,
+                        GREATEST(` + postgresMonthNumber("start_date") + `, $%[2]d::integer)) AS end_month
+        FROM subscriptions WHERE 1=1%[1]s
+    ), totals AS (
+        SELECT COALESCE(SUM(price), 0) AS total_cost, COUNT(*) AS subscription_count,
+               COALESCE($%[3]d::integer, MIN(start_month)) AS first_month,
+               COALESCE($%[3]d::integer, MAX(end_month)) AS last_month,
+               %[5]s AS closed_before
+        FROM filtered
+    ), spend AS (
+        SELECT month, SUM(amount)::bigint AS cost, SUM(subscription_count) AS subscription_count
+        FROM monthly_spend, totals t
+        WHERE month BETWEEN t.first_month AND t.last_month AND month < t.closed_before%[4]s
+        GROUP BY month
+    )
+    SELECT m.month, COALESCE(MAX(s.cost), SUM(f.price), 0), COALESCE(MAX(s.subscription_count), COUNT(f.price)),
+           t.total_cost, t.subscription_count
+    FROM totals t
+    CROSS JOIN LATERAL generate_series(t.first_month, t.last_month) AS m(month)
+    LEFT JOIN spend s ON s.month = m.month
+    LEFT JOIN filtered f ON m.month >= t.closed_before AND f.start_month <= m.month AND f.end_month >= m.month
+    GROUP BY m.month, t.total_cost, t.subscription_count
+    ORDER BY m.month`
+
+// postgresGroupQueries sum the price of the filtered subscriptions per value of a group_by
+// dimension. Subscriptions without a category or tags fall into the empty key.
+var postgresGroupQueries = map[string]string{
+    model.GroupByCategory: `SELECT COALESCE(category, ''), SUM(price), COUNT(*)
+        FROM subscriptions WHERE 1=1%s GROUP BY 1`,
+    model.GroupByTag: `SELECT COALESCE(t.tag, ''), SUM(s.price), COUNT(*)
+        FROM (SELECT price, tags FROM subscriptions WHERE 1=1%s) s
+        LEFT JOIN LATERAL unnest(s.tags) AS t(tag) ON true
+        GROUP BY 1`,
+    model.GroupByServiceName: `SELECT service_name, SUM(price), COUNT(*)
+        FROM subscriptions WHERE 1=1%s GROUP BY 1`,
+}
+
+func (r *PostgresRepository) SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (_ *model.CostSummary, err error) {
+    ctx, span := r.startCall(ctx, "SummarizeCost")
+    defer r.finishCall(ctx, span, "SummarizeCost", time.Now(), &err)
+
+    summary, err := r.summarizeMonths(ctx, filter)
+    if err != nil || groupBy == "" {
+        return summary, err
+    }
+    query, ok := postgresGroupQueries[groupBy]
+    if !ok {
+        return nil, fmt.Errorf("unknown group_by %q", groupBy)
+    }
+    where, args := postgresFilters(filter)
+    summary.GroupBy = groupBy
+    summary.Groups, err = r.costGroups(ctx, fmt.Sprintf(query, where), args...)
     if err != nil {
-        return nil, fmt.Errorf("failed to get filtered subscriptions: %w", err)
+        return nil, err
+    }
+    return summary, nil
+}
+
+// summarizeMonths reads the totals and the monthly breakdown of SummarizeCost
+func (r *PostgresRepository) summarizeMonths(ctx context.Context, filter model.SubscriptionFilter) (_ *model.CostSummary, err error) {
+    where, args := postgresFilters(filter)
+    // The user and service come first in the filters, so they are numbered the same way here
+    spendWhere, _ := postgresFilters(spendFilter(filter))
+    query := fmt.Sprintf(postgresCostQuery, where, len(args)+1, len(args)+2, spendWhere, spendWatermarkExpr(filter))
+    var bound interface{}
+    if filter.Period != nil && *filter.Period != "" {
+        month, err := parseMonth(*filter.Period)
+        if err != nil {
+            return nil, fmt.Errorf("invalid period: %w", err)
+        }
+        bound = month
+    }
+    args = append(args, monthNumber(time.Now()), bound)
+
+    ctx, st := r.startStatement(ctx, "SELECT", query)
+    defer st.end(&err)
+
+    rows, err := r.queryReport(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to summarize cost: %w", err)
     }
     defer rows.Close()
 
-    var subscriptions []model.Subscription
+    summary := &model.CostSummary{Months: []model.MonthlyCost{}}
     for rows.Next() {
-        subscription := model.Subscription{}
-        if err := rows.Scan(
-            &subscription.ID,
-            &subscription.ServiceName,
-            &subscription.Price,
-            &subscription.UserID,
-            &subscription.StartDate,
-            &subscription.EndDate,
-            &subscription.CreatedAt,
-            &subscription.UpdatedAt,
-        ); err != nil {
-            return nil, fmt.Errorf("failed to scan subscription: %w", err)
+        var number int
+        month := model.MonthlyCost{}
+        if err := rows.Scan(&number, &month.Cost, &month.SubscriptionCount, &summary.TotalCost, &summary.SubscriptionCount); err != nil {
+            return nil, fmt.Errorf("failed to scan monthly cost: %w", err)
         }
-        subscriptions = append(subscriptions, subscription)
+        month.Month = formatMonthNumber(number)
+        summary.Months = append(summary.Months, month)
     }
-    
     if err = rows.Err(); err != nil {
-        return nil, fmt.Errorf("error iterating filtered subscriptions: %w", err)
+        return nil, fmt.Errorf("error iterating monthly costs: %w", err)
     }
-    
-    return subscriptions, nil
-}
\ No newline at end of file
+    return summary, nil
+}
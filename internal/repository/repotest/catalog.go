@@ -0,0 +1,291 @@
+package repotest
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "subscription-service/internal/model"
+    "subscription-service/internal/repository"
+    "github.com/google/uuid"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// CatalogFactory returns an empty service catalog and the subscription repository it links to
+// for a single test
+type CatalogFactory func(t *testing.T) (repository.ServiceRepository, repository.SubscriptionRepository)
+
+// RunCatalog runs the ServiceRepository suite against catalogs created by newCatalog
+func RunCatalog(t *testing.T, newCatalog CatalogFactory) {
+    tests := []struct {
+        name string
+        fn   func(t *testing.T, catalog repository.ServiceRepository, subscriptions repository.SubscriptionRepository)
+    }{
+        {"CreateAndList", testCatalogCreateAndList},
+        {"NotFound", testCatalogNotFound},
+        {"RejectsConflicts", testCatalogConflicts},
+        {"RenameMovesLinkedSubscriptions", testCatalogRename},
+        {"LinksMatchingSubscriptions", testCatalogLink},
+        {"SeedsFromSubscriptions", testCatalogSeed},
+        {"DeleteUnlinksSubscriptions", testCatalogDelete},
+    }
+    for _, tt := range tests {
+        tt := tt
+        t.Run(tt.name, func(t *testing.T) {
+            catalog, subscriptions := newCatalog(t)
+            tt.fn(t, catalog, subscriptions)
+        })
+    }
+}
+
+func intPtr(i int) *int { return &i }
+
+// addService stores service in catalog
+func addService(t *testing.T, catalog repository.ServiceRepository, service *model.Service) {
+    t.Helper()
+    _, err := catalog.Create(context.Background(), service)
+    require.NoError(t, err)
+}
+
+// linked returns a stored subscription of service
+func linked(t *testing.T, subscriptions repository.SubscriptionRepository, service *model.Service, userID uuid.UUID, start string) *model.Subscription {
+    t.Helper()
+    sub := newSubscription(service.Name, userID, start, nil)
+    sub.ServiceID = intPtr(service.ID)
+    create(t, subscriptions, sub)
+    return sub
+}
+
+func testCatalogCreateAndList(t *testing.T, catalog repository.ServiceRepository, _ repository.SubscriptionRepository) {
+    ctx := context.Background()
+    before := time.Now().Add(-time.Second)
+
+    plus := &model.Service{Name: "Yandex Plus", Aliases: []string{"Яндекс Плюс"}, Category: "entertainment",
+        Website: "https://plus.yandex.ru", DefaultPrice: intPtr(299)}
+    addService(t, catalog, plus)
+    netflix := &model.Service{Name: "Netflix"}
+    addService(t, catalog, netflix)
+    assert.NotZero(t, plus.ID)
+    assert.NotEqual(t, plus.ID, netflix.ID)
+    assert.True(t, plus.CreatedAt.After(before))
+
+    got, err := catalog.GetByID(ctx, plus.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Yandex Plus", got.Name)
+    assert.Equal(t, []string{"Яндекс Плюс"}, got.Aliases)
+    assert.Equal(t, "entertainment", got.Category)
+    assert.Equal(t, "https://plus.yandex.ru", got.Website)
+    assert.Equal(t, intPtr(299), got.DefaultPrice)
+
+    services, err := catalog.List(ctx)
+    require.NoError(t, err)
+    if assert.Len(t, services, 2) {
+        assert.Equal(t, []int{plus.ID, netflix.ID}, []int{services[0].ID, services[1].ID})
+        assert.Equal(t, []string{}, services[1].Aliases)
+        assert.Nil(t, services[1].DefaultPrice)
+    }
+}
+
+func testCatalogNotFound(t *testing.T, catalog repository.ServiceRepository, _ repository.SubscriptionRepository) {
+    ctx := context.Background()
+
+    _, err := catalog.GetByID(ctx, 999)
+    assert.EqualError(t, err, "service not found")
+    _, err = catalog.Update(ctx, &model.Service{ID: 999, Name: "Missing"})
+    assert.EqualError(t, err, "service not found")
+    assert.EqualError(t, catalog.Delete(ctx, 999), "service not found")
+}
+
+func testCatalogConflicts(t *testing.T, catalog repository.ServiceRepository, _ repository.SubscriptionRepository) {
+    ctx := context.Background()
+    plus := &model.Service{Name: "Yandex Plus", Aliases: []string{"Kinopoisk"}}
+    addService(t, catalog, plus)
+    netflix := &model.Service{Name: "Netflix"}
+    addService(t, catalog, netflix)
+
+    _, err := catalog.Create(ctx, &model.Service{Name: "yandex plus"})
+    assert.True(t, errors.Is(err, repository.ErrServiceConflict), "%v", err)
+    _, err = catalog.Create(ctx, &model.Service{Name: "Кинопоиск"})
+    assert.True(t, errors.Is(err, repository.ErrServiceConflict), "%v", err)
+    netflix.Aliases = []string{"Yandex.Plus"}
+    _, err = catalog.Update(ctx, netflix)
+    assert.True(t, errors.Is(err, repository.ErrServiceConflict), "%v", err)
+
+    // An entry may keep its own name and aliases
+    plus.Aliases = []string{"Kinopoisk", "Yandex Plus Multi"}
+    _, err = catalog.Update(ctx, plus)
+    assert.NoError(t, err)
+}
+
+func testCatalogRename(t *testing.T, catalog repository.ServiceRepository, subscriptions repository.SubscriptionRepository) {
+    ctx := context.Background()
+    userID := uuid.New()
+    service := &model.Service{Name: "Yandex Plus"}
+    addService(t, catalog, service)
+    // Started in the past, so its closed months are in monthly spend
+    sub := linked(t, subscriptions, service, userID, "01-2024")
+    other := newSubscription("Yandex Plus", userID, "01-2024", nil)
+    create(t, subscriptions, other)
+    before, err := subscriptions.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID, ServiceName: strPtr("Yandex Plus")}, "")
+    require.NoError(t, err)
+
+    service.Name = "Yandex Plus Multi"
+    users, err := catalog.Update(ctx, service)
+    require.NoError(t, err)
+    // Only the users of the linked subscriptions are reported
+    assert.Equal(t, []uuid.UUID{userID}, users)
+
+    renamed, err := subscriptions.GetByID(ctx, sub.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Yandex Plus Multi", renamed.ServiceName)
+    assert.Equal(t, intPtr(service.ID), renamed.ServiceID)
+    unlinked, err := subscriptions.GetByID(ctx, other.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Yandex Plus", unlinked.ServiceName)
+
+    // Reports follow the rename, before and after the next write
+    check := func() {
+        t.Helper()
+        moved, err := subscriptions.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID, ServiceName: strPtr("Yandex Plus Multi")}, "")
+        require.NoError(t, err)
+        left, err := subscriptions.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID, ServiceName: strPtr("Yandex Plus")}, "")
+        require.NoError(t, err)
+        assert.Equal(t, 400, moved.TotalCost)
+        assert.Equal(t, 400, left.TotalCost)
+        if assert.Equal(t, len(before.Months), len(moved.Months)) {
+            for i, month := range before.Months {
+                assert.Equal(t, month.Cost/2, moved.Months[i].Cost, month.Month)
+                assert.Equal(t, month.Cost/2, left.Months[i].Cost, month.Month)
+            }
+        }
+    }
+    check()
+    create(t, subscriptions, newSubscription("Netflix", uuid.New(), "01-2024", nil))
+    check()
+}
+
+func testCatalogLink(t *testing.T, catalog repository.ServiceRepository, subscriptions repository.SubscriptionRepository) {
+    ctx := context.Background()
+    userID, otherID, kinopoiskID := uuid.New(), uuid.New(), uuid.New()
+    lower := newSubscription("yandex plus", userID, "01-2024", nil)
+    cyrillic := newSubscription("Яндекс Плюс", otherID, "01-2024", nil)
+    netflix := newSubscription("Netflix", userID, "01-2024", nil)
+    kinopoisk := newSubscription("Kinopoisk", kinopoiskID, "01-2024", nil)
+    create(t, subscriptions, lower, cyrillic, netflix, kinopoisk)
+    before, err := subscriptions.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID, ServiceName: strPtr("Yandex Plus")}, "")
+    require.NoError(t, err)
+    assert.Zero(t, before.TotalCost)
+
+    // A new entry takes the subscriptions written with any spelling of it
+    plus := &model.Service{Name: "Yandex Plus"}
+    users, err := catalog.Create(ctx, plus)
+    require.NoError(t, err)
+    assert.ElementsMatch(t, []uuid.UUID{userID, otherID}, users)
+    for _, sub := range []*model.Subscription{lower, cyrillic} {
+        got, err := subscriptions.GetByID(ctx, sub.ID)
+        require.NoError(t, err)
+        assert.Equal(t, "Yandex Plus", got.ServiceName)
+        assert.Equal(t, intPtr(plus.ID), got.ServiceID)
+    }
+    got, err := subscriptions.GetByID(ctx, netflix.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Netflix", got.ServiceName)
+    assert.Nil(t, got.ServiceID)
+
+    // Monthly spend follows the new name
+    after, err := subscriptions.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID, ServiceName: strPtr("Yandex Plus")}, "")
+    require.NoError(t, err)
+    assert.Equal(t, 400, after.TotalCost)
+    assert.NotEmpty(t, after.Months)
+
+    // So does a new alias
+    plus.Aliases = []string{"Kinopoisk"}
+    users, err = catalog.Update(ctx, plus)
+    require.NoError(t, err)
+    assert.Equal(t, []uuid.UUID{kinopoiskID}, users)
+    got, err = subscriptions.GetByID(ctx, kinopoisk.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Yandex Plus", got.ServiceName)
+    assert.Equal(t, intPtr(plus.ID), got.ServiceID)
+
+    // Nothing is left to link
+    users, err = catalog.Update(ctx, plus)
+    require.NoError(t, err)
+    assert.Empty(t, users)
+}
+
+func testCatalogSeed(t *testing.T, catalog repository.ServiceRepository, subscriptions repository.SubscriptionRepository) {
+    ctx := context.Background()
+    netflix := &model.Service{Name: "Netflix"}
+    addService(t, catalog, netflix)
+    userID, otherID := uuid.New(), uuid.New()
+    var plus []*model.Subscription
+    for _, name := range []string{"Yandex Plus", "yandex plus", "yandex plus", "Яндекс Плюс", "Yandex.Plus"} {
+        sub := newSubscription(name, userID, "01-2024", nil)
+        create(t, subscriptions, sub)
+        plus = append(plus, sub)
+    }
+    hulu := newSubscription(" Hulu ", otherID, "01-2024", nil)
+    lower := newSubscription("netflix", otherID, "01-2024", nil)
+    create(t, subscriptions, hulu, lower)
+    linked(t, subscriptions, netflix, uuid.New(), "01-2024")
+
+    users, err := catalog.Seed(ctx)
+    require.NoError(t, err)
+    assert.ElementsMatch(t, []uuid.UUID{userID, otherID}, users)
+
+    // Spellings that match the same way subscriptions do become one entry, named after the most used
+    services, err := catalog.List(ctx)
+    require.NoError(t, err)
+    names := make([]string, len(services))
+    for i, service := range services {
+        names[i] = service.Name
+    }
+    assert.Equal(t, []string{"Netflix", "yandex plus", "Hulu"}, names)
+    for _, sub := range plus {
+        got, err := subscriptions.GetByID(ctx, sub.ID)
+        require.NoError(t, err)
+        assert.Equal(t, "yandex plus", got.ServiceName)
+        assert.Equal(t, intPtr(services[1].ID), got.ServiceID)
+    }
+    got, err := subscriptions.GetByID(ctx, hulu.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Hulu", got.ServiceName)
+    got, err = subscriptions.GetByID(ctx, lower.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Netflix", got.ServiceName)
+    assert.Equal(t, intPtr(netflix.ID), got.ServiceID)
+
+    // Monthly spend follows the new names
+    summary, err := subscriptions.SummarizeCost(ctx, model.SubscriptionFilter{ServiceName: strPtr("yandex plus")}, "")
+    require.NoError(t, err)
+    assert.Equal(t, 2000, summary.TotalCost)
+    assert.NotEmpty(t, summary.Months)
+
+    // The catalog is seeded once
+    create(t, subscriptions, newSubscription("Spotify", userID, "01-2024", nil))
+    users, err = catalog.Seed(ctx)
+    require.NoError(t, err)
+    assert.Empty(t, users)
+    services, err = catalog.List(ctx)
+    require.NoError(t, err)
+    assert.Len(t, services, 3)
+}
+
+func testCatalogDelete(t *testing.T, catalog repository.ServiceRepository, subscriptions repository.SubscriptionRepository) {
+    ctx := context.Background()
+    service := &model.Service{Name: "Yandex Plus"}
+    addService(t, catalog, service)
+    sub := linked(t, subscriptions, service, uuid.New(), "07-2025")
+
+    require.NoError(t, catalog.Delete(ctx, service.ID))
+
+    _, err := catalog.GetByID(ctx, service.ID)
+    assert.EqualError(t, err, "service not found")
+    got, err := subscriptions.GetByID(ctx, sub.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Yandex Plus", got.ServiceName)
+    assert.Nil(t, got.ServiceID)
+}
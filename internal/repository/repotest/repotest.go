@@ -0,0 +1,789 @@
+// Package repotest is a behavioral test suite for SubscriptionRepository implementations.
+// Every backend runs the same suite, so they agree on ordering, filters and errors:
+//
+//    func TestMemoryRepositoryConformance(t *testing.T) {
+//        repotest.Run(t, func(t *testing.T) repository.SubscriptionRepository {
+//            return repository.NewMemoryRepository()
+//        })
+//    }
+package repotest
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+
+    "subscription-service/internal/model"
+    "subscription-service/internal/repository"
+    "github.com/google/uuid"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty repository for a single test. It is called once per subtest and
+// should register any cleanup with t.Cleanup.
+type Factory func(t *testing.T) repository.SubscriptionRepository
+
+// notFound is the error message every backend reports for a missing subscription
+const notFound = "subscription not found"
+
+// Run runs the whole suite against repositories created by newRepo
+func Run(t *testing.T, newRepo Factory) {
+    tests := []struct {
+        name string
+        fn   func(t *testing.T, repo repository.SubscriptionRepository)
+    }{
+        {"CreateAssignsIDAndTimestamps", testCreate},
+        {"CreateRejectsNonPositivePrice", testCreateRejectsPrice},
+        {"GetAllEmpty", testGetAllEmpty},
+        {"NotFound", testNotFound},
+        {"Update", testUpdate},
+        {"Delete", testDelete},
+        {"NewestFirst", testOrdering},
+        {"FilterCombinations", testFilters},
+        {"PeriodEdgeCases", testPeriods},
+        {"IterateStopsAtCallbackError", testIterateStops},
+        {"SummarizeCost", testSummarizeCost},
+        {"SummarizeCostEmpty", testSummarizeCostEmpty},
+        {"SummarizeCostFollowsWrites", testSummarizeCostFollowsWrites},
+        {"Labels", testLabels},
+        {"SummarizeCostByLabels", testSummarizeCostByLabels},
+        {"BatchCommits", testBatchCommits},
+        {"BatchRollsBack", testBatchRollsBack},
+        {"TxCommits", testTxCommits},
+        {"TxRollsBack", testTxRollsBack},
+        {"NestedTxJoins", testNestedTx},
+        {"SnapshotReads", testSnapshot},
+        {"CanceledContext", testCanceledContext},
+        {"ReturnsCopies", testReturnsCopies},
+        {"ConcurrentUse", testConcurrentUse},
+    }
+    for _, tt := range tests {
+        tt := tt
+        t.Run(tt.name, func(t *testing.T) {
+            tt.fn(t, newRepo(t))
+        })
+    }
+}
+
+// newSubscription returns a valid subscription that has not been stored yet
+func newSubscription(serviceName string, userID uuid.UUID, start string, end *string) *model.Subscription {
+    return &model.Subscription{ServiceName: serviceName, Price: 400, UserID: userID, StartDate: start, EndDate: end}
+}
+
+func create(t *testing.T, repo repository.SubscriptionRepository, subs ...*model.Subscription) {
+    t.Helper()
+    for _, sub := range subs {
+        require.NoError(t, repo.Create(context.Background(), sub))
+    }
+}
+
+func ids(subs []model.Subscription) []int {
+    result := make([]int, len(subs))
+    for i, sub := range subs {
+        result[i] = sub.ID
+    }
+    return result
+}
+
+func strPtr(s string) *string { return &s }
+
+func testCreate(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    before := time.Now()
+    first := newSubscription("Yandex Plus", uuid.New(), "07-2025", strPtr("12-2025"))
+    second := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    create(t, repo, first, second)
+
+    assert.NotZero(t, first.ID)
+    assert.NotEqual(t, first.ID, second.ID)
+    assert.False(t, first.CreatedAt.Before(before.Add(-time.Second)))
+    assert.Equal(t, first.CreatedAt, first.UpdatedAt)
+
+    got, err := repo.GetByID(ctx, first.ID)
+    require.NoError(t, err)
+    assert.Equal(t, first.ID, got.ID)
+    assert.Equal(t, "Yandex Plus", got.ServiceName)
+    assert.Equal(t, 400, got.Price)
+    assert.Equal(t, first.UserID, got.UserID)
+    assert.Equal(t, "07-2025", got.StartDate)
+    if assert.NotNil(t, got.EndDate) {
+        assert.Equal(t, "12-2025", *got.EndDate)
+    }
+    // Databases may store timestamps with microsecond precision
+    assert.WithinDuration(t, first.CreatedAt, got.CreatedAt, time.Millisecond)
+
+    got, err = repo.GetByID(ctx, second.ID)
+    require.NoError(t, err)
+    assert.Nil(t, got.EndDate)
+}
+
+func testCreateRejectsPrice(t *testing.T, repo repository.SubscriptionRepository) {
+    sub := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    sub.Price = 0
+    assert.Error(t, repo.Create(context.Background(), sub))
+
+    all, err := repo.GetAll(context.Background())
+    require.NoError(t, err)
+    assert.Empty(t, all)
+}
+
+func testGetAllEmpty(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    // Empty results encode as [] rather than null
+    assert.NotNil(t, all)
+    assert.Empty(t, all)
+
+    filtered, err := repo.GetByFilters(ctx, model.SubscriptionFilter{ServiceName: strPtr("Netflix")})
+    require.NoError(t, err)
+    assert.NotNil(t, filtered)
+    assert.Empty(t, filtered)
+}
+
+func testNotFound(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    existing := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    create(t, repo, existing)
+    missing := existing.ID + 1000
+
+    got, err := repo.GetByID(ctx, missing)
+    assert.EqualError(t, err, notFound)
+    assert.Nil(t, got)
+
+    update := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    update.ID = missing
+    assert.EqualError(t, repo.Update(ctx, update), notFound)
+    assert.EqualError(t, repo.Delete(ctx, missing), notFound)
+}
+
+func testUpdate(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    sub := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    create(t, repo, sub)
+    createdAt := sub.CreatedAt
+
+    time.Sleep(2 * time.Millisecond)
+    updatedUser := uuid.New()
+    sub.ServiceName = "Yandex Plus Multi"
+    sub.Price = 650
+    sub.UserID = updatedUser
+    sub.StartDate = "08-2025"
+    sub.EndDate = strPtr("07-2026")
+    require.NoError(t, repo.Update(ctx, sub))
+    assert.True(t, sub.UpdatedAt.After(createdAt))
+
+    got, err := repo.GetByID(ctx, sub.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "Yandex Plus Multi", got.ServiceName)
+    assert.Equal(t, 650, got.Price)
+    assert.Equal(t, updatedUser, got.UserID)
+    assert.Equal(t, "08-2025", got.StartDate)
+    if assert.NotNil(t, got.EndDate) {
+        assert.Equal(t, "07-2026", *got.EndDate)
+    }
+    assert.WithinDuration(t, createdAt, got.CreatedAt, time.Millisecond)
+    assert.True(t, got.UpdatedAt.After(got.CreatedAt))
+
+    // Clearing the end date
+    sub.EndDate = nil
+    require.NoError(t, repo.Update(ctx, sub))
+    got, err = repo.GetByID(ctx, sub.ID)
+    require.NoError(t, err)
+    assert.Nil(t, got.EndDate)
+}
+
+func testDelete(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    kept := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    deleted := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    create(t, repo, kept, deleted)
+
+    require.NoError(t, repo.Delete(ctx, deleted.ID))
+    _, err := repo.GetByID(ctx, deleted.ID)
+    assert.EqualError(t, err, notFound)
+    assert.EqualError(t, repo.Delete(ctx, deleted.ID), notFound)
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    assert.Equal(t, []int{kept.ID}, ids(all))
+
+    // IDs are not reused after a delete
+    next := newSubscription("Kinopoisk", uuid.New(), "07-2025", nil)
+    create(t, repo, next)
+    assert.Greater(t, next.ID, deleted.ID)
+}
+
+func testOrdering(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    userID := uuid.New()
+    subs := []*model.Subscription{
+        newSubscription("Yandex Plus", userID, "07-2025", nil),
+        newSubscription("Netflix", userID, "01-2020", nil),
+        newSubscription("Kinopoisk", userID, "12-2030", nil),
+    }
+    create(t, repo, subs...)
+    newestFirst := []int{subs[2].ID, subs[1].ID, subs[0].ID}
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    assert.Equal(t, newestFirst, ids(all))
+
+    filtered, err := repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID})
+    require.NoError(t, err)
+    assert.Equal(t, newestFirst, ids(filtered))
+
+    var iterated []int
+    require.NoError(t, repo.IterateByFilters(ctx, model.SubscriptionFilter{UserID: &userID}, func(sub *model.Subscription) error {
+        iterated = append(iterated, sub.ID)
+        return nil
+    }))
+    assert.Equal(t, newestFirst, iterated)
+}
+
+func testFilters(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    alice, bob := uuid.New(), uuid.New()
+    aliceYandex := newSubscription("Yandex Plus", alice, "07-2025", nil)
+    aliceNetflix := newSubscription("Netflix", alice, "07-2025", nil)
+    bobYandex := newSubscription("Yandex Plus", bob, "07-2025", nil)
+    bobEnded := newSubscription("Yandex Plus", bob, "01-2024", strPtr("06-2024"))
+    create(t, repo, aliceYandex, aliceNetflix, bobYandex, bobEnded)
+
+    yandex, netflix, empty, unknown := "Yandex Plus", "Netflix", "", "yandex plus"
+    period := "08-2025"
+    nobody := uuid.New()
+    tests := []struct {
+        name        string
+        userID      *uuid.UUID
+        serviceName *string
+        period      *string
+        want        []int
+    }{
+        {"none", nil, nil, nil, []int{bobEnded.ID, bobYandex.ID, aliceNetflix.ID, aliceYandex.ID}},
+        {"user", &alice, nil, nil, []int{aliceNetflix.ID, aliceYandex.ID}},
+        {"service", nil, &yandex, nil, []int{bobEnded.ID, bobYandex.ID, aliceYandex.ID}},
+        {"user and service", &bob, &yandex, nil, []int{bobEnded.ID, bobYandex.ID}},
+        {"user, service and period", &bob, &yandex, &period, []int{bobYandex.ID}},
+        {"service and period", nil, &netflix, &period, []int{aliceNetflix.ID}},
+        {"empty service is ignored", &alice, &empty, nil, []int{aliceNetflix.ID, aliceYandex.ID}},
+        {"empty period is ignored", &bob, nil, &empty, []int{bobEnded.ID, bobYandex.ID}},
+        {"service is case sensitive", nil, &unknown, nil, []int{}},
+        {"unknown user", &nobody, nil, nil, []int{}},
+    }
+    for _, tt := range tests {
+        subs, err := repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: tt.userID, ServiceName: tt.serviceName, Period: tt.period})
+        require.NoError(t, err, tt.name)
+        assert.Equal(t, tt.want, ids(subs), tt.name)
+    }
+}
+
+func testPeriods(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    userID := uuid.New()
+    december := newSubscription("December start", userID, "12-2025", nil)
+    january := newSubscription("January start", userID, "01-2026", nil)
+    untilJanuary := newSubscription("Ends in January", userID, "07-2024", strPtr("01-2026"))
+    untilDecember := newSubscription("Ends in December", userID, "03-2025", strPtr("12-2025"))
+    singleMonth := newSubscription("Single month", userID, "10-2025", strPtr("10-2025"))
+    create(t, repo, december, january, untilJanuary, untilDecember, singleMonth)
+
+    tests := []struct {
+        period string
+        want   []int
+    }{
+        // Year boundaries: MM-YYYY does not sort chronologically as text
+        {"11-2025", []int{untilDecember.ID, untilJanuary.ID}},
+        {"12-2025", []int{untilDecember.ID, untilJanuary.ID, december.ID}},
+        {"01-2026", []int{untilJanuary.ID, january.ID, december.ID}},
+        {"02-2026", []int{january.ID, december.ID}},
+        // Start and end months are both inclusive
+        {"10-2025", []int{singleMonth.ID, untilDecember.ID, untilJanuary.ID}},
+        {"09-2025", []int{untilDecember.ID, untilJanuary.ID}},
+        {"06-2024", []int{}},
+        {"07-2024", []int{untilJanuary.ID}},
+        {"12-2099", []int{january.ID, december.ID}},
+    }
+    for _, tt := range tests {
+        period := tt.period
+        subs, err := repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID, Period: &period})
+        require.NoError(t, err, period)
+        assert.Equal(t, tt.want, ids(subs), period)
+    }
+}
+
+func testIterateStops(t *testing.T, repo repository.SubscriptionRepository) {
+    userID := uuid.New()
+    create(t, repo,
+        newSubscription("Yandex Plus", userID, "07-2025", nil),
+        newSubscription("Netflix", userID, "07-2025", nil),
+        newSubscription("Kinopoisk", userID, "07-2025", nil),
+    )
+
+    stop := errors.New("stop")
+    calls := 0
+    err := repo.IterateByFilters(context.Background(), model.SubscriptionFilter{UserID: &userID}, func(*model.Subscription) error {
+        calls++
+        if calls == 2 {
+            return stop
+        }
+        return nil
+    })
+    assert.Same(t, stop, err)
+    assert.Equal(t, 2, calls)
+}
+
+func testSummarizeCost(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    user := uuid.New()
+    yandex := newSubscription("Yandex Plus", user, "11-2024", strPtr("02-2025"))
+    netflix := newSubscription("Netflix", user, "01-2025", strPtr("03-2025"))
+    netflix.Price = 600
+    other := newSubscription("Yandex Plus", uuid.New(), "12-2024", strPtr("12-2024"))
+    create(t, repo, yandex, netflix, other)
+
+    summary, err := repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &user}, "")
+    require.NoError(t, err)
+    assert.Equal(t, 1000, summary.TotalCost)
+    assert.Equal(t, 2, summary.SubscriptionCount)
+    // The breakdown crosses the year boundary and includes both end months
+    assert.Equal(t, []model.MonthlyCost{
+        {Month: "11-2024", Cost: 400, SubscriptionCount: 1},
+        {Month: "12-2024", Cost: 400, SubscriptionCount: 1},
+        {Month: "01-2025", Cost: 1000, SubscriptionCount: 2},
+        {Month: "02-2025", Cost: 1000, SubscriptionCount: 2},
+        {Month: "03-2025", Cost: 600, SubscriptionCount: 1},
+    }, summary.Months)
+
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{ServiceName: strPtr("Yandex Plus"), Period: strPtr("12-2024")}, "")
+    require.NoError(t, err)
+    assert.Equal(t, 800, summary.TotalCost)
+    assert.Equal(t, []model.MonthlyCost{{Month: "12-2024", Cost: 800, SubscriptionCount: 2}}, summary.Months)
+
+    // A period without subscriptions still has its month
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &user, Period: strPtr("06-2025")}, "")
+    require.NoError(t, err)
+    assert.Zero(t, summary.TotalCost)
+    assert.Equal(t, []model.MonthlyCost{{Month: "06-2025"}}, summary.Months)
+
+    // Open-ended subscriptions run to the current month
+    now := time.Now()
+    openEnded := newSubscription("Kinopoisk", uuid.New(), now.AddDate(0, -2, 0).Format("01-2006"), nil)
+    create(t, repo, openEnded)
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &openEnded.UserID}, "")
+    require.NoError(t, err)
+    if assert.Len(t, summary.Months, 3) {
+        assert.Equal(t, now.Format("01-2006"), summary.Months[2].Month)
+        assert.Equal(t, 400, summary.Months[2].Cost)
+    }
+}
+
+func testSummarizeCostFollowsWrites(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    user, other := uuid.New(), uuid.New()
+    sub := newSubscription("Yandex Plus", user, "01-2024", strPtr("03-2024"))
+    removed := newSubscription("Netflix", user, "02-2024", strPtr("02-2024"))
+    create(t, repo, sub, removed)
+
+    // Shorter, more expensive and moved to another user
+    sub.Price = 500
+    sub.EndDate = strPtr("02-2024")
+    sub.UserID = other
+    require.NoError(t, repo.Update(ctx, sub))
+    require.NoError(t, repo.Delete(ctx, removed.ID))
+
+    summary, err := repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &user, Period: strPtr("02-2024")}, "")
+    require.NoError(t, err)
+    assert.Equal(t, []model.MonthlyCost{{Month: "02-2024"}}, summary.Months)
+
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &other}, "")
+    require.NoError(t, err)
+    assert.Equal(t, []model.MonthlyCost{
+        {Month: "01-2024", Cost: 500, SubscriptionCount: 1},
+        {Month: "02-2024", Cost: 500, SubscriptionCount: 1},
+    }, summary.Months)
+
+    // A failed write leaves the breakdown as it was
+    err = repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+        require.NoError(t, tx.Delete(ctx, sub.ID))
+        return errors.New("failed")
+    })
+    require.Error(t, err)
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{ServiceName: strPtr("Yandex Plus"), Period: strPtr("01-2024")}, "")
+    require.NoError(t, err)
+    assert.Equal(t, []model.MonthlyCost{{Month: "01-2024", Cost: 500, SubscriptionCount: 1}}, summary.Months)
+}
+
+func testLabels(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    user := uuid.New()
+    plus := newSubscription("Yandex Plus", user, "07-2025", nil)
+    plus.Category = strPtr("entertainment")
+    plus.Tags = []string{"family", "music"}
+    aws := newSubscription("AWS", user, "07-2025", nil)
+    aws.Category = strPtr("cloud")
+    aws.Tags = []string{"infra"}
+    plain := newSubscription("Netflix", user, "07-2025", nil)
+    create(t, repo, plus, aws, plain)
+
+    got, err := repo.GetByID(ctx, plus.ID)
+    require.NoError(t, err)
+    assert.Equal(t, strPtr("entertainment"), got.Category)
+    assert.Equal(t, []string{"family", "music"}, got.Tags)
+    got, err = repo.GetByID(ctx, plain.ID)
+    require.NoError(t, err)
+    assert.Nil(t, got.Category)
+    assert.Nil(t, got.Tags)
+
+    for name, tc := range map[string]struct {
+        filter model.SubscriptionFilter
+        want   []int
+    }{
+        "category":        {model.SubscriptionFilter{Category: strPtr("cloud")}, []int{aws.ID}},
+        "tag":             {model.SubscriptionFilter{Tags: []string{"music"}}, []int{plus.ID}},
+        "all tags":        {model.SubscriptionFilter{Tags: []string{"family", "music"}}, []int{plus.ID}},
+        "missing tag":     {model.SubscriptionFilter{Tags: []string{"family", "infra"}}, []int{}},
+        "category+tag":    {model.SubscriptionFilter{Category: strPtr("entertainment"), Tags: []string{"infra"}}, []int{}},
+        "user+category":   {model.SubscriptionFilter{UserID: &user, Category: strPtr("entertainment")}, []int{plus.ID}},
+        "unused category": {model.SubscriptionFilter{Category: strPtr("education")}, []int{}},
+    } {
+        subs, err := repo.GetByFilters(ctx, tc.filter)
+        require.NoError(t, err, name)
+        assert.Equal(t, tc.want, ids(subs), name)
+    }
+
+    // Updates replace the labels
+    plus.Category = nil
+    plus.Tags = []string{"shared"}
+    require.NoError(t, repo.Update(ctx, plus))
+    got, err = repo.GetByID(ctx, plus.ID)
+    require.NoError(t, err)
+    assert.Nil(t, got.Category)
+    assert.Equal(t, []string{"shared"}, got.Tags)
+    subs, err := repo.GetByFilters(ctx, model.SubscriptionFilter{Tags: []string{"music"}})
+    require.NoError(t, err)
+    assert.Empty(t, subs)
+}
+
+func testSummarizeCostByLabels(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    user := uuid.New()
+    // Started in the past, so their closed months are in monthly spend, which has no labels
+    plus := newSubscription("Yandex Plus", user, "01-2024", strPtr("03-2024"))
+    plus.Category = strPtr("entertainment")
+    plus.Tags = []string{"family"}
+    aws := newSubscription("AWS", user, "02-2024", strPtr("03-2024"))
+    aws.Price = 1000
+    aws.Category = strPtr("cloud")
+    aws.Tags = []string{"infra", "family"}
+    create(t, repo, plus, aws)
+
+    summary, err := repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &user, Category: strPtr("cloud")}, "")
+    require.NoError(t, err)
+    assert.Equal(t, 1000, summary.TotalCost)
+    assert.Equal(t, 1, summary.SubscriptionCount)
+    assert.Equal(t, []model.MonthlyCost{
+        {Month: "02-2024", Cost: 1000, SubscriptionCount: 1},
+        {Month: "03-2024", Cost: 1000, SubscriptionCount: 1},
+    }, summary.Months)
+
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &user, Tags: []string{"family"}}, "")
+    require.NoError(t, err)
+    assert.Equal(t, 1400, summary.TotalCost)
+    assert.Equal(t, []model.MonthlyCost{
+        {Month: "01-2024", Cost: 400, SubscriptionCount: 1},
+        {Month: "02-2024", Cost: 1400, SubscriptionCount: 2},
+        {Month: "03-2024", Cost: 1400, SubscriptionCount: 2},
+    }, summary.Months)
+
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{Tags: []string{"infra"}, Period: strPtr("01-2024")}, "")
+    require.NoError(t, err)
+    assert.Zero(t, summary.TotalCost)
+    assert.Equal(t, []model.MonthlyCost{{Month: "01-2024"}}, summary.Months)
+
+    // Groups come most expensive first; a subscription counts once in each of its tags, and one
+    // without a category or tags falls into the empty key
+    create(t, repo, newSubscription("Hulu", user, "01-2024", strPtr("01-2024")))
+    for groupBy, want := range map[string][]model.CostGroup{
+        model.GroupByCategory: {{Key: "cloud", TotalCost: 1000, SubscriptionCount: 1}, {Key: "", TotalCost: 400, SubscriptionCount: 1},
+            {Key: "entertainment", TotalCost: 400, SubscriptionCount: 1}},
+        model.GroupByTag: {{Key: "family", TotalCost: 1400, SubscriptionCount: 2}, {Key: "infra", TotalCost: 1000, SubscriptionCount: 1},
+            {Key: "", TotalCost: 400, SubscriptionCount: 1}},
+        model.GroupByServiceName: {{Key: "AWS", TotalCost: 1000, SubscriptionCount: 1}, {Key: "Hulu", TotalCost: 400, SubscriptionCount: 1},
+            {Key: "Yandex Plus", TotalCost: 400, SubscriptionCount: 1}},
+    } {
+        summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &user}, groupBy)
+        require.NoError(t, err, groupBy)
+        assert.Equal(t, 1800, summary.TotalCost, groupBy)
+        assert.Equal(t, groupBy, summary.GroupBy)
+        assert.Equal(t, want, summary.Groups, groupBy)
+    }
+
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{Tags: []string{"family"}}, model.GroupByCategory)
+    require.NoError(t, err)
+    assert.Equal(t, []model.CostGroup{
+        {Key: "cloud", TotalCost: 1000, SubscriptionCount: 1},
+        {Key: "entertainment", TotalCost: 400, SubscriptionCount: 1},
+    }, summary.Groups)
+    stranger := uuid.New()
+    summary, err = repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &stranger}, model.GroupByTag)
+    require.NoError(t, err)
+    assert.Equal(t, []model.CostGroup{}, summary.Groups)
+}
+
+func testSummarizeCostEmpty(t *testing.T, repo repository.SubscriptionRepository) {
+    summary, err := repo.SummarizeCost(context.Background(), model.SubscriptionFilter{}, "")
+    require.NoError(t, err)
+    assert.Zero(t, summary.TotalCost)
+    assert.Zero(t, summary.SubscriptionCount)
+    assert.NotNil(t, summary.Months)
+    assert.Empty(t, summary.Months)
+}
+
+func testBatchCommits(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    updated := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    deleted := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    create(t, repo, updated, deleted)
+
+    created := newSubscription("Kinopoisk", uuid.New(), "07-2025", nil)
+    updated.Price = 500
+    require.NoError(t, repo.ApplyBatch(ctx, []repository.BatchOp{
+        {Op: model.BatchOpCreate, Subscription: created},
+        {Op: model.BatchOpUpdate, Subscription: updated},
+        {Op: model.BatchOpDelete, ID: deleted.ID},
+    }))
+    assert.NotZero(t, created.ID)
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    assert.Equal(t, []int{created.ID, updated.ID}, ids(all))
+    got, err := repo.GetByID(ctx, updated.ID)
+    require.NoError(t, err)
+    assert.Equal(t, 500, got.Price)
+}
+
+func testBatchRollsBack(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    existing := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    create(t, repo, existing)
+
+    changed := *existing
+    changed.Price = 999
+    missing := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    missing.ID = existing.ID + 1000
+    err := repo.ApplyBatch(ctx, []repository.BatchOp{
+        {Op: model.BatchOpCreate, Subscription: newSubscription("Kinopoisk", uuid.New(), "07-2025", nil)},
+        {Op: model.BatchOpUpdate, Subscription: &changed},
+        {Op: model.BatchOpUpdate, Subscription: missing},
+        {Op: model.BatchOpDelete, ID: existing.ID},
+    })
+    var batchErr *repository.BatchError
+    if assert.ErrorAs(t, err, &batchErr) {
+        assert.Equal(t, 2, batchErr.Index)
+        assert.EqualError(t, batchErr.Err, notFound)
+    }
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    if assert.Equal(t, []int{existing.ID}, ids(all)) {
+        assert.Equal(t, 400, all[0].Price)
+    }
+}
+
+func testTxCommits(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    existing := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    create(t, repo, existing)
+
+    created := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    err := repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+        if err := tx.Create(ctx, created); err != nil {
+            return err
+        }
+        // Reads inside the transaction see its own writes
+        got, err := tx.GetByID(ctx, created.ID)
+        if err != nil {
+            return err
+        }
+        got.Price = 700
+        if err := tx.Update(ctx, got); err != nil {
+            return err
+        }
+        return tx.Delete(ctx, existing.ID)
+    })
+    require.NoError(t, err)
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    if assert.Equal(t, []int{created.ID}, ids(all)) {
+        assert.Equal(t, 700, all[0].Price)
+    }
+}
+
+func testTxRollsBack(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    existing := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    create(t, repo, existing)
+
+    failed := errors.New("failed")
+    created := newSubscription("Netflix", uuid.New(), "07-2025", nil)
+    err := repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+        require.NoError(t, tx.Create(ctx, created))
+        changed := *existing
+        changed.Price = 999
+        require.NoError(t, tx.Update(ctx, &changed))
+        require.NoError(t, tx.Delete(ctx, existing.ID))
+        return failed
+    })
+    assert.Same(t, failed, err)
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    if assert.Equal(t, []int{existing.ID}, ids(all)) {
+        assert.Equal(t, 400, all[0].Price)
+    }
+    _, err = repo.GetByID(ctx, created.ID)
+    assert.EqualError(t, err, notFound)
+}
+
+func testNestedTx(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    failed := errors.New("failed")
+    err := repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+        err := tx.WithTx(ctx, func(inner repository.SubscriptionRepository) error {
+            return inner.Create(ctx, newSubscription("Netflix", uuid.New(), "07-2025", nil))
+        })
+        require.NoError(t, err)
+        // The inner call joined the outer transaction, so failing here discards its write too
+        return failed
+    })
+    assert.Same(t, failed, err)
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    assert.Empty(t, all)
+}
+
+func testSnapshot(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    userID := uuid.New()
+    sub := newSubscription("Yandex Plus", userID, "07-2025", nil)
+    create(t, repo, sub)
+
+    err := repo.WithSnapshot(ctx, func(snapshot repository.SubscriptionRepository) error {
+        summary, err := snapshot.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID, Period: strPtr("07-2025")}, "")
+        require.NoError(t, err)
+        assert.Equal(t, 400, summary.TotalCost)
+        items, err := snapshot.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID, Period: strPtr("07-2025")})
+        require.NoError(t, err)
+        assert.Equal(t, []int{sub.ID}, ids(items))
+        return nil
+    })
+    require.NoError(t, err)
+
+    // Inside a transaction the snapshot joins it and sees its uncommitted writes
+    failed := errors.New("failed")
+    err = repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+        require.NoError(t, tx.Delete(ctx, sub.ID))
+        err := tx.WithSnapshot(ctx, func(snapshot repository.SubscriptionRepository) error {
+            all, err := snapshot.GetAll(ctx)
+            require.NoError(t, err)
+            assert.Empty(t, all)
+            return nil
+        })
+        require.NoError(t, err)
+        return failed
+    })
+    assert.Same(t, failed, err)
+
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    assert.Equal(t, []int{sub.ID}, ids(all))
+}
+
+func testCanceledContext(t *testing.T, repo repository.SubscriptionRepository) {
+    sub := newSubscription("Yandex Plus", uuid.New(), "07-2025", nil)
+    create(t, repo, sub)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    _, err := repo.GetAll(ctx)
+    assert.ErrorIs(t, err, context.Canceled)
+    _, err = repo.GetByID(ctx, sub.ID)
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.ErrorIs(t, repo.Create(ctx, newSubscription("Netflix", uuid.New(), "07-2025", nil)), context.Canceled)
+    err = repo.IterateByFilters(ctx, model.SubscriptionFilter{}, func(*model.Subscription) error { return nil })
+    assert.ErrorIs(t, err, context.Canceled)
+    err = repo.WithTx(ctx, func(repository.SubscriptionRepository) error { return nil })
+    assert.ErrorIs(t, err, context.Canceled)
+    err = repo.WithSnapshot(ctx, func(repository.SubscriptionRepository) error { return nil })
+    assert.ErrorIs(t, err, context.Canceled)
+
+    all, err := repo.GetAll(context.Background())
+    require.NoError(t, err)
+    assert.Len(t, all, 1)
+}
+
+func testReturnsCopies(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    sub := newSubscription("Yandex Plus", uuid.New(), "07-2025", strPtr("12-2025"))
+    create(t, repo, sub)
+    // Changing the caller's value after Create does not change what is stored
+    *sub.EndDate = "01-2030"
+    sub.Price = 1
+
+    got, err := repo.GetByID(ctx, sub.ID)
+    require.NoError(t, err)
+    assert.Equal(t, "12-2025", *got.EndDate)
+    assert.Equal(t, 400, got.Price)
+
+    *got.EndDate = "01-2030"
+    all, err := repo.GetAll(ctx)
+    require.NoError(t, err)
+    assert.Equal(t, "12-2025", *all[0].EndDate)
+}
+
+func testConcurrentUse(t *testing.T, repo repository.SubscriptionRepository) {
+    ctx := context.Background()
+    const workers = 10
+    const perWorker = 5
+    userID := uuid.New()
+
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    seen := make(map[int]bool)
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < perWorker; i++ {
+                sub := newSubscription(fmt.Sprintf("Service %d-%d", w, i), userID, "07-2025", nil)
+                if !assert.NoError(t, repo.Create(ctx, sub)) {
+                    return
+                }
+                mu.Lock()
+                seen[sub.ID] = true
+                mu.Unlock()
+
+                sub.Price = 500
+                assert.NoError(t, repo.Update(ctx, sub))
+                _, err := repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID})
+                assert.NoError(t, err)
+            }
+        }(w)
+    }
+    wg.Wait()
+
+    assert.Len(t, seen, workers*perWorker, "IDs must be unique")
+    all, err := repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID})
+    require.NoError(t, err)
+    assert.Len(t, all, workers*perWorker)
+    for _, sub := range all {
+        assert.Equal(t, 500, sub.Price)
+    }
+}
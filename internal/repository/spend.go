@@ -0,0 +1,177 @@
+package repository
+
+import (
+    "context"
+    "fmt"
+    "sync/atomic"
+    "time"
+
+    "github.com/google/uuid"
+
+    "subscription-service/internal/model"
+)
+
+// spendStatements maintain the monthly_spend table, which holds the spend per user and service in
+// every month before the closed_before watermark of monthly_spend_state. Cost reports read closed
+// months from it and sum only the current and later months from subscriptions.
+type spendStatements struct {
+    // state reads the watermark; setState ($1) moves it
+    state    string
+    setState string
+    // closeMonths materializes the months from $1 up to, not including, $2
+    closeMonths string
+    // closeUserMonths materializes the months from $1 up to, not including, $2 of user $3
+    closeUserMonths string
+    // add adds amount $5 and subscription count $6 for user $3 and service $4 to the months $1 to $2
+    add string
+    // prune removes the months of user $1 and service $2 that no subscription is active in any more
+    prune string
+    // clearUser removes the materialized months of user $1
+    clearUser string
+}
+
+// spendWatermark remembers the last closed_before seen by any copy of a repository
+type spendWatermark struct {
+    closedBefore atomic.Int64
+}
+
+// withSpend runs write in a transaction that keeps monthly_spend in step with subscriptions.
+// write returns the subscription it replaced or removed and the one it stored, either may be nil;
+// their spend is moved in the closed months they were active in.
+func (r *sqlDB) withSpend(ctx context.Context, write func(tx *sqlDB) (old, stored *model.Subscription, err error)) error {
+    if r.tx == nil && r.watermark.closedBefore.Load() < int64(monthNumber(time.Now())) {
+        // Materialize ended months in a transaction of their own, so that writes racing at the
+        // start of a month conflict over this small one and not over their own
+        if err := r.withTx(ctx, func(tx *sqlDB) error {
+            _, err := tx.closeMonths(ctx)
+            return err
+        }); err != nil {
+            return err
+        }
+    }
+
+    return r.withTx(ctx, func(tx *sqlDB) error {
+        closedBefore, err := tx.closeMonths(ctx)
+        if err != nil {
+            return err
+        }
+        old, stored, err := write(tx)
+        if err != nil {
+            return err
+        }
+        if old != nil {
+            if err := tx.addSpend(ctx, old, -1, closedBefore); err != nil {
+                return err
+            }
+        }
+        if stored != nil {
+            if err := tx.addSpend(ctx, stored, 1, closedBefore); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// closeMonths materializes the months that ended since the watermark was last moved and returns
+// the new watermark. It must run in a transaction.
+func (r *sqlDB) closeMonths(ctx context.Context) (_ int, err error) {
+    var closedBefore int
+    stateCtx, st := r.startStatementOn(ctx, "monthly_spend_state", "SELECT", r.spend.state)
+    err = r.conn().QueryRowContext(stateCtx, r.spend.state).Scan(&closedBefore)
+    st.end(&err)
+    if err != nil {
+        return 0, fmt.Errorf("failed to read monthly spend state: %w", err)
+    }
+
+    current := monthNumber(time.Now())
+    if closedBefore < current {
+        if err := r.execOn(ctx, "monthly_spend", "INSERT", r.spend.closeMonths, closedBefore, current); err != nil {
+            return 0, fmt.Errorf("failed to close months: %w", err)
+        }
+        if err := r.execOn(ctx, "monthly_spend_state", "UPDATE", r.spend.setState, current); err != nil {
+            return 0, fmt.Errorf("failed to update monthly spend state: %w", err)
+        }
+        r.log.WithContext(ctx).Info("monthly spend materialized", "from", formatMonthNumber(closedBefore), "to", formatMonthNumber(current-1))
+        closedBefore = current
+    }
+    r.watermark.closedBefore.Store(int64(closedBefore))
+    return closedBefore, nil
+}
+
+// addSpend adds sign times the price of subscription to the closed months it is active in
+func (r *sqlDB) addSpend(ctx context.Context, subscription *model.Subscription, sign int, closedBefore int) error {
+    first, err := parseMonth(subscription.StartDate)
+    if err != nil {
+        return fmt.Errorf("invalid start date: %w", err)
+    }
+    last := closedBefore - 1
+    if subscription.EndDate != nil {
+        end, err := parseMonth(*subscription.EndDate)
+        if err != nil {
+            return fmt.Errorf("invalid end date: %w", err)
+        }
+        if end < last {
+            last = end
+        }
+    }
+    if first > last {
+        return nil
+    }
+
+    userID := subscription.UserID.String()
+    err = r.execOn(ctx, "monthly_spend", "INSERT", r.spend.add,
+        first, last, userID, subscription.ServiceName, sign*subscription.Price, sign)
+    if err != nil {
+        return fmt.Errorf("failed to update monthly spend: %w", err)
+    }
+    if sign < 0 {
+        if err := r.execOn(ctx, "monthly_spend", "DELETE", r.spend.prune, userID, subscription.ServiceName); err != nil {
+            return fmt.Errorf("failed to update monthly spend: %w", err)
+        }
+    }
+    return nil
+}
+
+// rewriteSpend materializes the closed months of users again after their subscriptions were
+// changed in bulk without withSpend. Other users' months and the watermark are kept.
+// It must run in a transaction.
+func (r *sqlDB) rewriteSpend(ctx context.Context, users []uuid.UUID) error {
+    closedBefore, err := r.closeMonths(ctx)
+    if err != nil {
+        return err
+    }
+    for _, user := range users {
+        userID := user.String()
+        if err := r.execOn(ctx, "monthly_spend", "DELETE", r.spend.clearUser, userID); err != nil {
+            return fmt.Errorf("failed to rewrite monthly spend: %w", err)
+        }
+        if err := r.execOn(ctx, "monthly_spend", "INSERT", r.spend.closeUserMonths, 0, closedBefore, userID); err != nil {
+            return fmt.Errorf("failed to rewrite monthly spend: %w", err)
+        }
+    }
+    return nil
+}
+
+// spendFilter returns the part of filter that monthly_spend can answer: the user and service
+func spendFilter(filter model.SubscriptionFilter) model.SubscriptionFilter {
+    return model.SubscriptionFilter{UserID: filter.UserID, ServiceName: filter.ServiceName}
+}
+
+// spendWatermarkExpr is the SQL of the watermark a cost report reads closed months before.
+// monthly_spend is kept per user and service only, so reports filtered by category or tags
+// take a watermark of zero and sum the subscriptions in every month.
+func spendWatermarkExpr(filter model.SubscriptionFilter) string {
+    if (filter.Category != nil && *filter.Category != "") || len(filter.Tags) > 0 {
+        return "0"
+    }
+    return "(SELECT closed_before FROM monthly_spend_state)"
+}
+
+// execOn runs a statement that returns no rows against table
+func (r *sqlDB) execOn(ctx context.Context, table, operation, query string, args ...interface{}) (err error) {
+    ctx, st := r.startStatementOn(ctx, table, operation, query)
+    defer st.end(&err)
+    _, err = r.conn().ExecContext(ctx, query, args...)
+    return err
+}
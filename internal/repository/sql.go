@@ -0,0 +1,404 @@
+package repository
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+
+    "subscription-service/internal/logger"
+    "subscription-service/internal/model"
+    "subscription-service/internal/tracing"
+    "go.opentelemetry.io/otel/attribute"
+    semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// ErrQueryTimeout is reported when a statement runs longer than the repository's query timeout.
+// It matches context.DeadlineExceeded.
+var ErrQueryTimeout = fmt.Errorf("query timed out: %w", context.DeadlineExceeded)
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Replica is a read-only copy of the database that listings and cost reports may be read from
+type Replica interface {
+    DB() *sql.DB
+    // Usable reports whether the replica is reachable and close enough to the primary
+    Usable() bool
+    // Failed records a query that failed on the replica, so reads go to the primary until
+    // the replica is found healthy again
+    Failed(err error)
+}
+
+type primaryKey struct{}
+
+// ReadPrimary returns a context whose reads skip the replica. Results that outlive the request,
+// such as cached cost reports, must not be read behind the latest writes.
+func ReadPrimary(ctx context.Context) context.Context {
+    return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// errReplicaFailed marks a query that failed on the replica and should be repeated on the primary
+var errReplicaFailed = errors.New("replica query failed")
+
+// snapshotOptions give WithSnapshot a consistent view without blocking writers. Hot standby
+// replicas do not support serializable transactions.
+var snapshotOptions = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// subscriptionColumns are the columns read by scanSubscription, in its order
+const subscriptionColumns = "id, service_name, price, user_id, start_date, end_date, created_at, updated_at, service_id, category, tags"
+
+// scanSubscription reads a row of subscriptionColumns. A subscription without tags gets nil Tags.
+func (r *sqlDB) scanSubscription(row rowScanner, subscription *model.Subscription) error {
+    err := row.Scan(
+        &subscription.ID,
+        &subscription.ServiceName,
+        &subscription.Price,
+        &subscription.UserID,
+        &subscription.StartDate,
+        &subscription.EndDate,
+        &subscription.CreatedAt,
+        &subscription.UpdatedAt,
+        &subscription.ServiceID,
+        &subscription.Category,
+        r.list(&subscription.Tags),
+    )
+    if len(subscription.Tags) == 0 {
+        subscription.Tags = nil
+    }
+    return err
+}
+
+// listColumn converts a list of strings, such as tags or aliases, to and from its column
+type listColumn interface {
+    sql.Scanner
+    driver.Valuer
+}
+
+// jsonList stores a list as a JSON array in a text column
+type jsonList []string
+
+func (l *jsonList) Scan(src interface{}) error {
+    var data []byte
+    switch v := src.(type) {
+    case string:
+        data = []byte(v)
+    case []byte:
+        data = v
+    default:
+        return fmt.Errorf("cannot scan %T into a list", src)
+    }
+    return json.Unmarshal(data, (*[]string)(l))
+}
+
+func (l *jsonList) Value() (driver.Value, error) {
+    if *l == nil {
+        return "[]", nil
+    }
+    data, err := json.Marshal([]string(*l))
+    return string(data), err
+}
+
+// listValue wraps list for writing; a nil list is stored empty
+func (r *sqlDB) listValue(list []string) listColumn {
+    if list == nil {
+        list = []string{}
+    }
+    return r.list(&list)
+}
+
+// maxTxAttempts bounds how many times a transaction failing with a retryable error is run
+const maxTxAttempts = 3
+
+// txRetryDelay is the pause before the second attempt of a transaction; it grows linearly
+const txRetryDelay = 20 * time.Millisecond
+
+// sqlDB is the part shared by the database/sql repositories: the pool, transactions,
+// call logging, tracing and the per-statement timeout
+type sqlDB struct {
+    db           *sql.DB
+    log          *logger.Logger
+    queryTimeout time.Duration
+    // system is the db.system span attribute
+    system attribute.KeyValue
+    // txOptions are used to begin transactions
+    txOptions *sql.TxOptions
+    // retryable reports whether a failed transaction may be run again from the start;
+    // nil disables retries
+    retryable func(error) bool
+    // replica serves reads that may lag behind the primary; nil sends everything to the primary
+    replica Replica
+    // tx is set on the copies handed to WithTx and WithSnapshot callbacks
+    tx *sql.Tx
+    // onReplica is set when tx runs on the replica
+    onReplica bool
+    // spend maintains monthly_spend on every write
+    spend *spendStatements
+    // watermark is shared with the copies bound to transactions
+    watermark *spendWatermark
+    // list wraps the lists stored in a single column, tags and aliases
+    list func(*[]string) listColumn
+}
+
+// conn returns what statements run on: the transaction, if there is one, or the pool
+func (r *sqlDB) conn() queryer {
+    if r.tx != nil {
+        return r.tx
+    }
+    return r.db
+}
+
+// now returns the time written to created_at and updated_at. SQLite stores timestamps as text,
+// so they are written in UTC there to keep created_at ordering correct.
+func (r *sqlDB) now() time.Time {
+    if r.system == semconv.DBSystemSqlite {
+        return time.Now().UTC()
+    }
+    return time.Now()
+}
+
+// withTx runs fn with a copy of r bound to a new transaction and commits it if fn returns nil.
+// Called inside a transaction, fn joins it. A transaction failing with a retryable error is run
+// again, fn included, up to maxTxAttempts times.
+func (r *sqlDB) withTx(ctx context.Context, fn func(tx *sqlDB) error) error {
+    if r.tx != nil {
+        return fn(r)
+    }
+    for attempt := 1; ; attempt++ {
+        err := r.runTx(ctx, fn)
+        if err == nil || r.retryable == nil || !r.retryable(err) || attempt == maxTxAttempts {
+            return err
+        }
+        r.log.WithContext(ctx).Warn("transaction conflict, retrying", "attempt", attempt, "error", err)
+        select {
+        case <-ctx.Done():
+            return err
+        case <-time.After(time.Duration(attempt) * txRetryDelay):
+        }
+    }
+}
+
+func (r *sqlDB) runTx(ctx context.Context, fn func(tx *sqlDB) error) error {
+    tx, err := r.db.BeginTx(ctx, r.txOptions)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    return r.finishTx(tx, false, fn)
+}
+
+// finishTx runs fn with a copy of r bound to tx and commits tx if fn returns nil
+func (r *sqlDB) finishTx(tx *sql.Tx, onReplica bool, fn func(tx *sqlDB) error) error {
+    defer tx.Rollback()
+
+    bound := *r
+    bound.tx = tx
+    bound.onReplica = onReplica
+    if err := fn(&bound); err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return nil
+}
+
+// withSnapshot runs fn with a copy of r bound to a read-only transaction, on the replica while it
+// is usable. If a query fails on the replica, fn is run again on the primary. Called inside a
+// transaction, fn joins it.
+func (r *sqlDB) withSnapshot(ctx context.Context, fn func(tx *sqlDB) error) error {
+    if r.tx != nil {
+        return fn(r)
+    }
+    if r.replicaUsable(ctx) {
+        err := r.runSnapshot(ctx, r.replica.DB(), true, fn)
+        if !errors.Is(err, errReplicaFailed) {
+            return err
+        }
+        r.log.WithContext(ctx).Warn("Replica query failed, reading from the primary", "error", err)
+    }
+    return r.runSnapshot(ctx, r.db, false, fn)
+}
+
+func (r *sqlDB) runSnapshot(ctx context.Context, db *sql.DB, onReplica bool, fn func(tx *sqlDB) error) error {
+    tx, err := db.BeginTx(ctx, snapshotOptions)
+    if err != nil {
+        err = fmt.Errorf("failed to begin transaction: %w", err)
+        if onReplica {
+            return r.replicaFailed(ctx, err)
+        }
+        return err
+    }
+    return r.finishTx(tx, onReplica, fn)
+}
+
+// replicaUsable reports whether reads for ctx may go to the replica
+func (r *sqlDB) replicaUsable(ctx context.Context) bool {
+    primary, _ := ctx.Value(primaryKey{}).(bool)
+    return r.replica != nil && !primary && r.replica.Usable()
+}
+
+// queryReport runs a read-only query that tolerates replication lag. Outside a transaction it runs
+// on the replica while that is usable and falls back to the primary if it fails there.
+func (r *sqlDB) queryReport(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    switch {
+    case r.onReplica:
+        rows, err := r.tx.QueryContext(ctx, query, args...)
+        if err != nil {
+            return nil, r.replicaFailed(ctx, err)
+        }
+        return rows, nil
+    case r.tx == nil && r.replicaUsable(ctx):
+        rows, err := r.replica.DB().QueryContext(ctx, query, args...)
+        if err == nil {
+            return rows, nil
+        }
+        if err = r.replicaFailed(ctx, err); !errors.Is(err, errReplicaFailed) {
+            return nil, err
+        }
+        r.log.WithContext(ctx).Warn("Replica query failed, reading from the primary", "error", err)
+    }
+    return r.conn().QueryContext(ctx, query, args...)
+}
+
+// costGroups runs a query of cost groups, returning key, cost and subscription count, and sorts
+// the groups like summarizeCost does
+func (r *sqlDB) costGroups(ctx context.Context, query string, args ...interface{}) (_ []model.CostGroup, err error) {
+    ctx, st := r.startStatement(ctx, "SELECT", query)
+    defer st.end(&err)
+
+    rows, err := r.queryReport(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to group cost: %w", err)
+    }
+    defer rows.Close()
+
+    groups := []model.CostGroup{}
+    for rows.Next() {
+        var group model.CostGroup
+        if err := rows.Scan(&group.Key, &group.TotalCost, &group.SubscriptionCount); err != nil {
+            return nil, fmt.Errorf("failed to scan cost group: %w", err)
+        }
+        groups = append(groups, group)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating cost groups: %w", err)
+    }
+    sortCostGroups(groups)
+    return groups, nil
+}
+
+// replicaFailed handles err of a statement run on the replica. Unless the statement was canceled
+// or timed out, the replica is marked unusable and the error is wrapped with errReplicaFailed.
+func (r *sqlDB) replicaFailed(ctx context.Context, err error) error {
+    if ctx.Err() != nil {
+        return err
+    }
+    r.replica.Failed(err)
+    return fmt.Errorf("%w: %w", errReplicaFailed, err)
+}
+
+// startCall starts the span of a repository method
+func (r *sqlDB) startCall(ctx context.Context, method string) (context.Context, trace.Span) {
+    return tracing.Start(ctx, "SubscriptionRepository."+method)
+}
+
+// finishCall logs the outcome of a repository call, failures at error level and everything else
+// at debug, and ends its span. Not found is an expected outcome and is not recorded as a span error.
+func (r *sqlDB) finishCall(ctx context.Context, span trace.Span, method string, start time.Time, err *error) {
+    duration := time.Since(start)
+    log := r.log.WithContext(ctx)
+    if *err != nil && !isNotFound(*err) {
+        log.Error("query failed", "method", method, "duration", duration, "error", *err)
+        tracing.End(span, *err)
+        return
+    }
+    log.Debug("query", "method", method, "duration", duration)
+    tracing.End(span, nil)
+}
+
+// isNotFound reports the errors of lookups that found nothing
+func isNotFound(err error) bool {
+    return err.Error() == "subscription not found" || err.Error() == "service not found"
+}
+
+// statement is a single traced SQL statement bounded by the query timeout
+type statement struct {
+    ctx     context.Context
+    span    trace.Span
+    cancel  context.CancelCauseFunc
+    timer   *time.Timer
+    timeout time.Duration
+}
+
+// startStatement starts a client span for a single SQL statement and derives the context
+// the statement must run with
+func (r *sqlDB) startStatement(ctx context.Context, operation, query string) (context.Context, *statement) {
+    return r.startStatementOn(ctx, "subscriptions", operation, query)
+}
+
+// startStatementOn is startStatement for a statement on another table
+func (r *sqlDB) startStatementOn(ctx context.Context, table, operation, query string) (context.Context, *statement) {
+    ctx, span := tracing.Tracer().Start(ctx, operation+" "+table,
+        trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithAttributes(
+            r.system,
+            semconv.DBOperation(operation),
+            semconv.DBSQLTable(table),
+            semconv.DBStatement(query),
+        ),
+    )
+    ctx, cancel := context.WithCancelCause(ctx)
+    st := &statement{ctx: ctx, span: span, cancel: cancel, timeout: r.queryTimeout}
+    if st.timeout > 0 {
+        st.timer = time.AfterFunc(st.timeout, func() { cancel(ErrQueryTimeout) })
+    }
+    return ctx, st
+}
+
+// pause stops the timeout while a row is handed to the caller, so a slow consumer
+// is not mistaken for a slow database; resume restarts it
+func (st *statement) pause() {
+    if st.timer != nil {
+        st.timer.Stop()
+    }
+}
+
+func (st *statement) resume() {
+    if st.timer != nil {
+        st.timer.Reset(st.timeout)
+    }
+}
+
+// end releases the statement's context and ends its span. A failure caused by the timeout or by
+// cancellation of the caller's context is wrapped with that cause, so callers can tell them apart
+// from database errors. sql.ErrNoRows is an expected outcome, not a failure.
+func (st *statement) end(err *error) {
+    if st.timer != nil {
+        st.timer.Stop()
+    }
+    if *err != nil {
+        if cause := context.Cause(st.ctx); cause != nil && !errors.Is(*err, cause) {
+            *err = fmt.Errorf("%w: %w", *err, cause)
+        }
+    }
+    st.cancel(nil)
+
+    if errors.Is(*err, sql.ErrNoRows) {
+        tracing.End(st.span, nil)
+        return
+    }
+    tracing.End(st.span, *err)
+}
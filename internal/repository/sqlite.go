@@ -0,0 +1,500 @@
+package repository
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "time"
+
+    "subscription-service/internal/logger"
+    "subscription-service/internal/model"
+    semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// SQLiteRepository stores subscriptions in a SQLite database file. It behaves like
+// PostgresRepository; the schema comes from db/migrations/sqlite.
+type SQLiteRepository struct {
+    sqlDB
+}
+
+// NewSQLiteRepository creates a repository that bounds every statement by queryTimeout
+// in addition to the caller's context; zero disables the timeout
+func NewSQLiteRepository(db *sql.DB, log *logger.Logger, queryTimeout time.Duration) SubscriptionRepository {
+    return &SQLiteRepository{sqlDB{
+        db:           db,
+        log:          log,
+        queryTimeout: queryTimeout,
+        system:       semconv.DBSystemSqlite,
+        spend:        sqliteSpend,
+        watermark:    &spendWatermark{},
+        list:         sqliteList,
+    }}
+}
+
+// sqliteList stores lists as JSON arrays in text columns
+func sqliteList(list *[]string) listColumn {
+    return (*jsonList)(list)
+}
+
+// sqliteSpend walks month ranges with recursive CTEs; ?NNN placeholders bind by position
+// like PostgreSQL's $N
+var sqliteSpend = &spendStatements{
+    state:           "SELECT closed_before FROM monthly_spend_state",
+    setState:        "UPDATE monthly_spend_state SET closed_before = ?1",
+    closeMonths:     sqliteCloseMonths("true"),
+    closeUserMonths: sqliteCloseMonths("user_id = ?3"),
+    add: `WITH RECURSIVE months(month) AS (
+            SELECT ?1 UNION ALL SELECT month + 1 FROM months WHERE month < ?2
+        )
+        INSERT INTO monthly_spend (user_id, service_name, month, amount, subscription_count)
+        SELECT ?3, ?4, month, ?5, ?6 FROM months WHERE true
+        ON CONFLICT (user_id, service_name, month) DO UPDATE
+        SET amount = monthly_spend.amount + excluded.amount,
+            subscription_count = monthly_spend.subscription_count + excluded.subscription_count`,
+    prune:     "DELETE FROM monthly_spend WHERE user_id = ?1 AND service_name = ?2 AND subscription_count = 0",
+    clearUser: "DELETE FROM monthly_spend WHERE user_id = ?1",
+}
+
+// sqliteCloseMonths materializes the months from ?1 up to, not including, ?2 of the subscriptions
+// that where selects
+func sqliteCloseMonths(where string) string {
+    return `WITH RECURSIVE spans(user_id, service_name, price, month, last_month) AS (
+            SELECT user_id, service_name, price, max(` + sqliteMonthNumber("start_date") + `, ?1),
+                   min(COALESCE(` + sqliteMonthNumber("end_date") + `, ?2 - 1), ?2 - 1)
+            FROM subscriptions
+            WHERE ` + where + `
+            UNION ALL
+            SELECT user_id, service_name, price, month + 1, last_month FROM spans WHERE month < last_month
+        )
+        INSERT INTO monthly_spend (user_id, service_name, month, amount, subscription_count)
+        SELECT user_id, service_name, month, sum(price), count(*) FROM spans WHERE month <= last_month
+        GROUP BY user_id, service_name, month`
+}
+
+// NewSQLiteServiceRepository creates the service catalog stored next to the subscriptions of
+// NewSQLiteRepository, with the same query timeout
+func NewSQLiteServiceRepository(db *sql.DB, log *logger.Logger, queryTimeout time.Duration) ServiceRepository {
+    return &sqlCatalog{
+        sqlDB: sqlDB{
+            db:           db,
+            log:          log,
+            queryTimeout: queryTimeout,
+            system:       semconv.DBSystemSqlite,
+            spend:        sqliteSpend,
+            watermark:    &spendWatermark{},
+            list:         sqliteList,
+        },
+        statements: sqliteCatalog,
+    }
+}
+
+// sqliteCatalog binds ?NNN placeholders by position like PostgreSQL's $N
+var sqliteCatalog = &catalogStatements{
+    list: "SELECT " + serviceColumns + " FROM services ORDER BY id",
+    get:  "SELECT " + serviceColumns + " FROM services WHERE id = ?1",
+    insert: `INSERT INTO services (name, aliases, category, website, default_price, created_at, updated_at)
+        VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7) RETURNING id`,
+    update: `UPDATE services SET name = ?1, aliases = ?2, category = ?3, website = ?4, default_price = ?5,
+        updated_at = ?6 WHERE id = ?7`,
+    delete: "DELETE FROM services WHERE id = ?1",
+    rename: "UPDATE subscriptions SET service_name = ?1, updated_at = ?2 WHERE service_id = ?3 RETURNING user_id",
+    unlinked: `SELECT service_name FROM subscriptions WHERE service_id IS NULL
+        GROUP BY service_name ORDER BY count(*) DESC, min(id)`,
+    link: `UPDATE subscriptions SET service_id = ?1, service_name = ?2, updated_at = ?3
+        WHERE service_id IS NULL AND service_name = ?4 RETURNING user_id`,
+    seeded:    "SELECT seeded FROM services_seed_state",
+    setSeeded: "UPDATE services_seed_state SET seeded = 1",
+}
+
+// sqliteMonth turns MM-YYYY into YYYYMM, which sorts chronologically as text.
+// The same conversion is applied to the stored dates in SQL.
+func sqliteMonth(date string) string {
+    if len(date) != len("01-2006") {
+        return date
+    }
+    return date[3:] + date[:2]
+}
+
+const sqliteMonthExpr = "(substr(%[1]s, 4, 4) || substr(%[1]s, 1, 2))"
+
+// sqliteFilters builds the conditions shared by the filtered queries
+func sqliteFilters(filter model.SubscriptionFilter) (string, []interface{}) {
+    var where string
+    var args []interface{}
+    if filter.UserID != nil {
+        where += " AND user_id = ?"
+        args = append(args, filter.UserID.String())
+    }
+    if filter.ServiceName != nil && *filter.ServiceName != "" {
+        where += " AND service_name = ?"
+        args = append(args, *filter.ServiceName)
+    }
+    if filter.Period != nil && *filter.Period != "" {
+        month := sqliteMonth(*filter.Period)
+        where += " AND " + fmt.Sprintf(sqliteMonthExpr, "start_date") + " <= ?"
+        where += " AND (end_date IS NULL OR " + fmt.Sprintf(sqliteMonthExpr, "end_date") + " >= ?)"
+        args = append(args, month, month)
+    }
+    if filter.Category != nil && *filter.Category != "" {
+        where += " AND category = ?"
+        args = append(args, *filter.Category)
+    }
+    for _, tag := range filter.Tags {
+        where += " AND EXISTS (SELECT 1 FROM json_each(tags) WHERE value = ?)"
+        args = append(args, tag)
+    }
+    return where, args
+}
+
+func (r *SQLiteRepository) Create(ctx context.Context, subscription *model.Subscription) (err error) {
+    ctx, span := r.startCall(ctx, "Create")
+    defer r.finishCall(ctx, span, "Create", time.Now(), &err)
+    return r.withSpend(ctx, func(tx *sqlDB) (*model.Subscription, *model.Subscription, error) {
+        repo := &SQLiteRepository{*tx}
+        return nil, subscription, repo.createSubscription(ctx, tx.conn(), subscription)
+    })
+}
+
+func (r *SQLiteRepository) createSubscription(ctx context.Context, q queryer, subscription *model.Subscription) (err error) {
+    query := `INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date, created_at, updated_at, service_id, category, tags)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+    // Timestamps are stored as text, so they are written in UTC to keep created_at ordering correct
+    now := time.Now().UTC()
+    subscription.CreatedAt = now
+    subscription.UpdatedAt = now
+
+    ctx, st := r.startStatement(ctx, "INSERT", query)
+    defer st.end(&err)
+
+    err = q.QueryRowContext(ctx, query,
+        subscription.ServiceName,
+        subscription.Price,
+        subscription.UserID.String(),
+        subscription.StartDate,
+        subscription.EndDate,
+        subscription.CreatedAt,
+        subscription.UpdatedAt,
+        subscription.ServiceID,
+        subscription.Category,
+        r.listValue(subscription.Tags),
+    ).Scan(&subscription.ID)
+
+    if err != nil {
+        return fmt.Errorf("failed to create subscription: %w", err)
+    }
+    return nil
+}
+
+func (r *SQLiteRepository) GetByID(ctx context.Context, id int) (_ *model.Subscription, err error) {
+    ctx, span := r.startCall(ctx, "GetByID")
+    defer r.finishCall(ctx, span, "GetByID", time.Now(), &err)
+
+    query := "SELECT " + subscriptionColumns + " FROM subscriptions WHERE id = ?"
+
+    statementCtx, st := r.startStatement(ctx, "SELECT", query)
+    subscription := &model.Subscription{}
+    err = r.scanSubscription(r.conn().QueryRowContext(statementCtx, query, id), subscription)
+    st.end(&err)
+
+    if err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, errors.New("subscription not found")
+        }
+        return nil, fmt.Errorf("failed to get subscription: %w", err)
+    }
+    return subscription, nil
+}
+
+func (r *SQLiteRepository) GetAll(ctx context.Context) (_ []model.Subscription, err error) {
+    ctx, span := r.startCall(ctx, "GetAll")
+    defer r.finishCall(ctx, span, "GetAll", time.Now(), &err)
+
+    subscriptions := []model.Subscription{}
+    err = r.iterate(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions ORDER BY created_at DESC, id DESC", nil,
+        func(subscription *model.Subscription) error {
+            subscriptions = append(subscriptions, *subscription)
+            return nil
+        })
+    if err != nil {
+        return nil, err
+    }
+    return subscriptions, nil
+}
+
+func (r *SQLiteRepository) Update(ctx context.Context, subscription *model.Subscription) (err error) {
+    ctx, span := r.startCall(ctx, "Update")
+    defer r.finishCall(ctx, span, "Update", time.Now(), &err)
+    return r.withSpend(ctx, func(tx *sqlDB) (*model.Subscription, *model.Subscription, error) {
+        repo := &SQLiteRepository{*tx}
+        old, err := repo.GetByID(ctx, subscription.ID)
+        if err != nil {
+            return nil, nil, err
+        }
+        return old, subscription, repo.updateSubscription(ctx, tx.conn(), subscription)
+    })
+}
+
+func (r *SQLiteRepository) updateSubscription(ctx context.Context, q queryer, subscription *model.Subscription) (err error) {
+    query := `UPDATE subscriptions SET service_name = ?, price = ?, user_id = ?,
+              start_date = ?, end_date = ?, updated_at = ?, service_id = ?, category = ?, tags = ? WHERE id = ?`
+
+    ctx, st := r.startStatement(ctx, "UPDATE", query)
+    defer st.end(&err)
+
+    subscription.UpdatedAt = time.Now().UTC()
+
+    result, err := q.ExecContext(ctx, query,
+        subscription.ServiceName,
+        subscription.Price,
+        subscription.UserID.String(),
+        subscription.StartDate,
+        subscription.EndDate,
+        subscription.UpdatedAt,
+        subscription.ServiceID,
+        subscription.Category,
+        r.listValue(subscription.Tags),
+        subscription.ID,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to update subscription: %w", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get affected rows: %w", err)
+    }
+    if rowsAffected == 0 {
+        return errors.New("subscription not found")
+    }
+    return nil
+}
+
+func (r *SQLiteRepository) Delete(ctx context.Context, id int) (err error) {
+    ctx, span := r.startCall(ctx, "Delete")
+    defer r.finishCall(ctx, span, "Delete", time.Now(), &err)
+    return r.withSpend(ctx, func(tx *sqlDB) (*model.Subscription, *model.Subscription, error) {
+        repo := &SQLiteRepository{*tx}
+        old, err := repo.GetByID(ctx, id)
+        if err != nil {
+            return nil, nil, err
+        }
+        return old, nil, repo.deleteSubscription(ctx, tx.conn(), id)
+    })
+}
+
+func (r *SQLiteRepository) deleteSubscription(ctx context.Context, q queryer, id int) (err error) {
+    query := "DELETE FROM subscriptions WHERE id = ?"
+
+    ctx, st := r.startStatement(ctx, "DELETE", query)
+    defer st.end(&err)
+
+    result, err := q.ExecContext(ctx, query, id)
+    if err != nil {
+        return fmt.Errorf("failed to delete subscription: %w", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get affected rows: %w", err)
+    }
+    if rowsAffected == 0 {
+        return errors.New("subscription not found")
+    }
+    return nil
+}
+
+// ApplyBatch executes all operations in a single transaction, rolling back on the first failure
+func (r *SQLiteRepository) ApplyBatch(ctx context.Context, ops []BatchOp) (err error) {
+    ctx, span := r.startCall(ctx, "ApplyBatch")
+    defer r.finishCall(ctx, span, "ApplyBatch", time.Now(), &err)
+    return r.WithTx(ctx, func(tx SubscriptionRepository) error {
+        return applyBatch(ctx, tx, ops)
+    })
+}
+
+// WithTx runs fn in a transaction. SQLite transactions are serializable and take the write lock
+// when they begin, so they are not retried.
+func (r *SQLiteRepository) WithTx(ctx context.Context, fn func(SubscriptionRepository) error) (err error) {
+    ctx, span := r.startCall(ctx, "WithTx")
+    defer r.finishCall(ctx, span, "WithTx", time.Now(), &err)
+    return r.withTx(ctx, func(tx *sqlDB) error {
+        return fn(&SQLiteRepository{*tx})
+    })
+}
+
+// WithSnapshot runs fn in a transaction like WithTx; SQLite has no replicas to read from
+func (r *SQLiteRepository) WithSnapshot(ctx context.Context, fn func(SubscriptionRepository) error) (err error) {
+    ctx, span := r.startCall(ctx, "WithSnapshot")
+    defer r.finishCall(ctx, span, "WithSnapshot", time.Now(), &err)
+    return r.withTx(ctx, func(tx *sqlDB) error {
+        return fn(&SQLiteRepository{*tx})
+    })
+}
+
+// GetByFilters retrieves subscriptions based on optional filters
+func (r *SQLiteRepository) GetByFilters(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+    subscriptions := []model.Subscription{}
+    err := r.IterateByFilters(ctx, filter, func(subscription *model.Subscription) error {
+        subscriptions = append(subscriptions, *subscription)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return subscriptions, nil
+}
+
+// IterateByFilters streams subscriptions matching the optional filters to fn row by row.
+// Iteration stops at the first error returned by fn.
+func (r *SQLiteRepository) IterateByFilters(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) (err error) {
+    ctx, span := r.startCall(ctx, "IterateByFilters")
+    defer r.finishCall(ctx, span, "IterateByFilters", time.Now(), &err)
+
+    where, args := sqliteFilters(filter)
+    query := "SELECT " + subscriptionColumns + " FROM subscriptions WHERE 1=1" + where + " ORDER BY created_at DESC, id DESC"
+    return r.iterate(ctx, query, args, fn)
+}
+
+// sqliteCostQuery walks the months between the bounds with a recursive CTE, as SQLite has no
+// generate_series. Closed months are read from monthly_spend; the months from its watermark on sum
+// the matching subscriptions. Months are month numbers as computed by monthNumber. The placeholders
+// are the current month, the filters, twice the period, or NULL, and the user and service filters
+// again for monthly_spend. The watermark is spliced in by spendWatermarkExpr.
+var sqliteCostQuery = `WITH RECURSIVE filtered AS (
+        SELECT price, ` + sqliteMonthNumber("start_date") + ` AS start_month,
+               COALESCE(` + sqliteMonthNumber("end_date") + `, max(` + sqliteMonthNumber("start_date") + `, ?)) AS end_month
+        FROM subscriptions WHERE 1=1%[1]s
+    ), bounds AS (
+        SELECT COALESCE(?, min(start_month)) AS first_month, COALESCE(?, max(end_month)) AS last_month,
+               %[3]s AS closed_before
+        FROM filtered
+    ), months(month) AS (
+        SELECT first_month FROM bounds WHERE first_month IS NOT NULL
+        UNION ALL
+        SELECT month + 1 FROM months, bounds WHERE month < last_month
+    ), spend AS (
+        SELECT month, sum(amount) AS cost, sum(subscription_count) AS subscription_count
+        FROM monthly_spend, bounds b
+        WHERE month BETWEEN b.first_month AND b.last_month AND month < b.closed_before%[2]s
+        GROUP BY month
+    )
+    SELECT m.month, COALESCE(max(s.cost), sum(f.price), 0), COALESCE(max(s.subscription_count), count(f.price)),
+           (SELECT COALESCE(sum(price), 0) FROM filtered), (SELECT count(*) FROM filtered)
+    FROM months m
+    CROSS JOIN bounds b
+    LEFT JOIN spend s ON s.month = m.month
+    LEFT JOIN filtered f ON m.month >= b.closed_before AND f.start_month <= m.month AND f.end_month >= m.month
+    GROUP BY m.month
+    ORDER BY m.month`
+
+// sqliteMonthNumber is the SQL counterpart of monthNumber for an MM-YYYY column
+func sqliteMonthNumber(column string) string {
+    return fmt.Sprintf("(CAST(substr(%[1]s, 4, 4) AS INTEGER) * 12 + CAST(substr(%[1]s, 1, 2) AS INTEGER) - 1)", column)
+}
+
+// sqliteGroupQueries are the SQLite versions of postgresGroupQueries; tags are walked with json_each
+var sqliteGroupQueries = map[string]string{
+    model.GroupByCategory: `SELECT COALESCE(category, ''), sum(price), count(*)
+        FROM subscriptions WHERE 1=1%s GROUP BY 1`,
+    model.GroupByTag: `SELECT COALESCE(t.value, ''), sum(s.price), count(*)
+        FROM (SELECT price, tags FROM subscriptions WHERE 1=1%s) s
+        LEFT JOIN json_each(s.tags) t
+        GROUP BY 1`,
+    model.GroupByServiceName: `SELECT service_name, sum(price), count(*)
+        FROM subscriptions WHERE 1=1%s GROUP BY 1`,
+}
+
+func (r *SQLiteRepository) SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (_ *model.CostSummary, err error) {
+    ctx, span := r.startCall(ctx, "SummarizeCost")
+    defer r.finishCall(ctx, span, "SummarizeCost", time.Now(), &err)
+
+    summary, err := r.summarizeMonths(ctx, filter)
+    if err != nil || groupBy == "" {
+        return summary, err
+    }
+    query, ok := sqliteGroupQueries[groupBy]
+    if !ok {
+        return nil, fmt.Errorf("unknown group_by %q", groupBy)
+    }
+    where, args := sqliteFilters(filter)
+    summary.GroupBy = groupBy
+    summary.Groups, err = r.costGroups(ctx, fmt.Sprintf(query, where), args...)
+    if err != nil {
+        return nil, err
+    }
+    return summary, nil
+}
+
+// summarizeMonths reads the totals and the monthly breakdown of SummarizeCost
+func (r *SQLiteRepository) summarizeMonths(ctx context.Context, filter model.SubscriptionFilter) (_ *model.CostSummary, err error) {
+    where, filterArgs := sqliteFilters(filter)
+    spendWhere, spendArgs := sqliteFilters(spendFilter(filter))
+    query := fmt.Sprintf(sqliteCostQuery, where, spendWhere, spendWatermarkExpr(filter))
+    var bound interface{}
+    if filter.Period != nil && *filter.Period != "" {
+        month, err := time.Parse("01-2006", *filter.Period)
+        if err != nil {
+            return nil, fmt.Errorf("invalid period: %w", err)
+        }
+        bound = monthNumber(month)
+    }
+    args := append([]interface{}{monthNumber(time.Now())}, filterArgs...)
+    args = append(args, bound, bound)
+    args = append(args, spendArgs...)
+
+    ctx, st := r.startStatement(ctx, "SELECT", query)
+    defer st.end(&err)
+
+    rows, err := r.conn().QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to summarize cost: %w", err)
+    }
+    defer rows.Close()
+
+    summary := &model.CostSummary{Months: []model.MonthlyCost{}}
+    for rows.Next() {
+        var number int
+        month := model.MonthlyCost{}
+        if err := rows.Scan(&number, &month.Cost, &month.SubscriptionCount, &summary.TotalCost, &summary.SubscriptionCount); err != nil {
+            return nil, fmt.Errorf("failed to scan monthly cost: %w", err)
+        }
+        month.Month = formatMonthNumber(number)
+        summary.Months = append(summary.Months, month)
+    }
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating monthly costs: %w", err)
+    }
+    return summary, nil
+}
+
+// iterate runs a SELECT of subscriptionColumns and hands every row to fn, returning fn's errors as is.
+// The query timeout applies to waiting for the database, not to the time spent in fn.
+func (r *SQLiteRepository) iterate(ctx context.Context, query string, args []interface{}, fn func(*model.Subscription) error) (err error) {
+    ctx, st := r.startStatement(ctx, "SELECT", query)
+    defer st.end(&err)
+
+    rows, err := r.conn().QueryContext(ctx, query, args...)
+    if err != nil {
+        return fmt.Errorf("failed to get subscriptions: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        subscription := model.Subscription{}
+        if err := r.scanSubscription(rows, &subscription); err != nil {
+            return fmt.Errorf("failed to scan subscription: %w", err)
+        }
+        st.pause()
+        if err := fn(&subscription); err != nil {
+            return err
+        }
+        st.resume()
+    }
+
+    if err = rows.Err(); err != nil {
+        return fmt.Errorf("error iterating subscriptions: %w", err)
+    }
+    return nil
+}
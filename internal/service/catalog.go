@@ -0,0 +1,245 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "subscription-service/internal/catalog"
+    "subscription-service/internal/logger"
+    "subscription-service/internal/model"
+    "subscription-service/internal/repository"
+    "subscription-service/internal/tracing"
+    "github.com/google/uuid"
+)
+
+// catalogTTL bounds how long matcher keeps the catalog it read. Writes through this instance drop
+// it at once; writes through other instances are seen after at most catalogTTL.
+const catalogTTL = time.Minute
+
+// CatalogService manages the service catalog that subscriptions are linked to
+type CatalogService struct {
+    repo repository.ServiceRepository
+    log  *logger.Logger
+    // relinked is called with the users whose subscriptions a catalog change renamed or linked;
+    // set by SubscriptionService.UseCatalog to drop their cost reports
+    relinked func(ctx context.Context, users ...uuid.UUID)
+
+    // mu guards the catalog kept for matcher. version counts writes, so that a catalog read
+    // while a write was committed is not kept.
+    mu       sync.Mutex
+    services []model.Service
+    loaded   time.Time
+    version  int
+}
+
+func NewCatalogService(repo repository.ServiceRepository, log *logger.Logger) *CatalogService {
+    return &CatalogService{repo: repo, log: log}
+}
+
+// Create adds a service to the catalog. Its name and aliases must not match another service.
+// Existing subscriptions whose name matches it are linked to it and take its name.
+func (c *CatalogService) Create(ctx context.Context, req *model.ServiceRequest) (_ *model.Service, err error) {
+    ctx, span := tracing.Start(ctx, "CatalogService.Create")
+    defer func() { tracing.End(span, err) }()
+
+    service, err := newService(req)
+    if err != nil {
+        return nil, err
+    }
+    defer c.invalidate()
+    linked, err := c.repo.Create(ctx, service)
+    if err != nil {
+        return nil, err
+    }
+    if len(linked) > 0 && c.relinked != nil {
+        c.relinked(ctx, linked...)
+    }
+
+    c.log.WithContext(ctx).Info("service created", "service_id", service.ID, "name", service.Name)
+    return service, nil
+}
+
+// List returns the whole catalog
+func (c *CatalogService) List(ctx context.Context) (_ []model.Service, err error) {
+    ctx, span := tracing.Start(ctx, "CatalogService.List")
+    defer func() { tracing.End(span, err) }()
+    return c.repo.List(ctx)
+}
+
+// GetByID returns a catalog entry by ID
+func (c *CatalogService) GetByID(ctx context.Context, id int) (_ *model.Service, err error) {
+    ctx, span := tracing.Start(ctx, "CatalogService.GetByID")
+    defer func() { tracing.End(span, err) }()
+    return c.repo.GetByID(ctx, id)
+}
+
+// Update replaces a catalog entry. A renamed service keeps its old name as an alias, so
+// subscriptions still written with it are linked, and its subscriptions take the new name.
+// Existing subscriptions that a new name or alias matches are linked to it as well.
+func (c *CatalogService) Update(ctx context.Context, id int, req *model.ServiceRequest) (_ *model.Service, err error) {
+    ctx, span := tracing.Start(ctx, "CatalogService.Update")
+    defer func() { tracing.End(span, err) }()
+
+    service, err := newService(req)
+    if err != nil {
+        return nil, err
+    }
+    current, err := c.repo.GetByID(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    service.ID = id
+    if current.Name != service.Name {
+        service.Aliases = addAlias(service.Aliases, service.Name, current.Name)
+    }
+    defer c.invalidate()
+    relinked, err := c.repo.Update(ctx, service)
+    if err != nil {
+        return nil, err
+    }
+    if len(relinked) > 0 && c.relinked != nil {
+        c.relinked(ctx, relinked...)
+    }
+
+    c.log.WithContext(ctx).Info("service updated", "service_id", id, "name", service.Name, "previous_name", current.Name)
+    return service, nil
+}
+
+// Delete removes a catalog entry; its subscriptions keep their name
+func (c *CatalogService) Delete(ctx context.Context, id int) (err error) {
+    ctx, span := tracing.Start(ctx, "CatalogService.Delete")
+    defer func() { tracing.End(span, err) }()
+
+    defer c.invalidate()
+    if err := c.repo.Delete(ctx, id); err != nil {
+        return err
+    }
+    c.log.WithContext(ctx).Info("service deleted", "service_id", id)
+    return nil
+}
+
+// Seed adds the services in use that the catalog does not know and links their subscriptions.
+// It does something only the first time it is called on a database.
+func (c *CatalogService) Seed(ctx context.Context) (err error) {
+    ctx, span := tracing.Start(ctx, "CatalogService.Seed")
+    defer func() { tracing.End(span, err) }()
+
+    defer c.invalidate()
+    linked, err := c.repo.Seed(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to seed service catalog: %w", err)
+    }
+    if len(linked) == 0 {
+        return nil
+    }
+    if c.relinked != nil {
+        c.relinked(ctx, linked...)
+    }
+    c.log.WithContext(ctx).Info("service catalog seeded from the subscriptions in use", "users", len(linked))
+    return nil
+}
+
+// matcher returns a function that finds the entry a name refers to. The catalog is read once
+// and kept until a write through c or for catalogTTL.
+func (c *CatalogService) matcher(ctx context.Context) (func(name string) (model.Service, bool), error) {
+    services, err := c.catalog(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return func(name string) (model.Service, bool) {
+        return catalog.Match(name, services)
+    }, nil
+}
+
+// catalog returns the kept catalog, reading it again if it was dropped or expired
+func (c *CatalogService) catalog(ctx context.Context) ([]model.Service, error) {
+    c.mu.Lock()
+    if c.services != nil && time.Since(c.loaded) < catalogTTL {
+        services := c.services
+        c.mu.Unlock()
+        return services, nil
+    }
+    version := c.version
+    c.mu.Unlock()
+
+    services, err := c.repo.List(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read service catalog: %w", err)
+    }
+    c.mu.Lock()
+    if c.version == version {
+        c.services, c.loaded = services, time.Now()
+    }
+    c.mu.Unlock()
+    return services, nil
+}
+
+// invalidate drops the kept catalog after a write, whether or not it succeeded
+func (c *CatalogService) invalidate() {
+    c.mu.Lock()
+    c.services = nil
+    c.version++
+    c.mu.Unlock()
+}
+
+// newService validates req and converts it to a catalog entry. Surrounding spaces are trimmed,
+// and aliases that normalize like the name or an earlier alias are dropped. The category is
+// normalized and checked like the category of a subscription.
+func newService(req *model.ServiceRequest) (*model.Service, error) {
+    if req == nil {
+        return nil, errors.New("service request cannot be nil")
+    }
+
+    service := &model.Service{
+        Name:         strings.TrimSpace(req.Name),
+        Aliases:      []string{},
+        Category:     strings.ToLower(strings.TrimSpace(req.Category)),
+        Website:      strings.TrimSpace(req.Website),
+        DefaultPrice: req.DefaultPrice,
+    }
+    if service.Name == "" {
+        return nil, errors.New("name is required")
+    }
+    if len(service.Name) > 255 {
+        return nil, errors.New("name must be at most 255 characters")
+    }
+    if service.Category != "" {
+        if err := validateLabels(&service.Category, nil); err != nil {
+            return nil, err
+        }
+    }
+    if service.Website != "" {
+        website, err := url.Parse(service.Website)
+        if err != nil || (website.Scheme != "http" && website.Scheme != "https") || website.Host == "" {
+            return nil, errors.New("website must be an http or https URL")
+        }
+    }
+    if service.DefaultPrice != nil && *service.DefaultPrice <= 0 {
+        return nil, errors.New("default_price must be greater than 0")
+    }
+    for _, alias := range req.Aliases {
+        service.Aliases = addAlias(service.Aliases, service.Name, alias)
+    }
+    return service, nil
+}
+
+// addAlias appends alias to the aliases of the service called name unless it normalizes
+// like the name or one of them
+func addAlias(aliases []string, name, alias string) []string {
+    alias = strings.TrimSpace(alias)
+    normalized := catalog.Normalize(alias)
+    if normalized == "" || normalized == catalog.Normalize(name) {
+        return aliases
+    }
+    for _, existing := range aliases {
+        if catalog.Normalize(existing) == normalized {
+            return aliases
+        }
+    }
+    return append(aliases, alias)
+}
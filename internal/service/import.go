@@ -0,0 +1,232 @@
+package service
+
+import (
+    "context"
+    "database/sql/driver"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+
+    "subscription-service/internal/export"
+    "subscription-service/internal/model"
+    "subscription-service/internal/repository"
+    "subscription-service/internal/tracing"
+    "github.com/google/uuid"
+)
+
+// ImportBatchSize is the number of rows inserted per transaction during a CSV import
+const ImportBatchSize = 100
+
+// MaxImportErrors is the number of row errors listed in an import report; ErrorCount counts all
+const MaxImportErrors = 100
+
+// requiredImportColumns must be present in the CSV header; end_date, category and tags are optional
+var requiredImportColumns = []string{"service_name", "price", "user_id", "start_date"}
+
+// Import reads subscriptions from CSV, validating every row with the same rules as Create.
+// The first row must be a header naming the columns; end_date, category and tags are optional.
+// Tags are separated by semicolons, as in exports.
+// In dry-run mode nothing is written and only the validation report is returned.
+// A CSV without a readable header is reported as a *CSVError. The import stops with an error when a
+// batch fails for a reason other than one of its rows, such as the database being unreachable;
+// the batches committed before stay imported.
+func (s *SubscriptionService) Import(ctx context.Context, r io.Reader, dryRun bool) (_ *model.ImportReport, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.Import")
+    defer func() { tracing.End(span, err) }()
+
+    reader := csv.NewReader(r)
+    reader.TrimLeadingSpace = true
+    reader.FieldsPerRecord = -1
+
+    header, err := reader.Read()
+    if err == io.EOF {
+        return nil, &CSVError{Err: errors.New("csv is empty")}
+    }
+    var parseErr *csv.ParseError
+    if errors.As(err, &parseErr) {
+        return nil, &CSVError{Err: fmt.Errorf("failed to read csv header: %w", err)}
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read csv header: %w", err)
+    }
+
+    columns, err := parseImportHeader(header)
+    if err != nil {
+        return nil, &CSVError{Err: err}
+    }
+
+    report := &model.ImportReport{
+        DryRun: dryRun,
+        Errors: make([]model.ImportRowError, 0),
+    }
+
+    link, err := s.linker(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var batch []repository.BatchOp
+    var batchRows []int
+    flush := func() error {
+        if len(batch) == 0 {
+            return nil
+        }
+        if err := s.repo.ApplyBatch(ctx, batch); err != nil {
+            var batchErr *repository.BatchError
+            if !errors.As(err, &batchErr) || storageFailure(err) {
+                return fmt.Errorf("import stopped at row %d after %d rows were imported: %w", batchRows[0], report.Imported, err)
+            }
+            for i, row := range batchRows {
+                msg := "batch rolled back: " + err.Error()
+                if batchErr.Index == i {
+                    msg = batchErr.Err.Error()
+                }
+                addImportError(report, row, msg)
+            }
+        } else {
+            report.Imported += len(batch)
+            users := make([]uuid.UUID, len(batch))
+            for i, op := range batch {
+                users[i] = op.Subscription.UserID
+            }
+            s.invalidateCosts(ctx, users...)
+        }
+        batch = batch[:0]
+        batchRows = batchRows[:0]
+        return nil
+    }
+
+    // Row numbers are 1-based and count the header, matching what spreadsheets show
+    row := 1
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        row++
+        if err != nil {
+            var parseErr *csv.ParseError
+            if !errors.As(err, &parseErr) {
+                return nil, fmt.Errorf("failed to read csv: %w", err)
+            }
+            report.TotalRows++
+            addImportError(report, row, parseErr.Err.Error())
+            continue
+        }
+        report.TotalRows++
+
+        req, err := parseImportRecord(record, columns)
+        if err == nil {
+            err = validateCreateRequest(req)
+        }
+        if err != nil {
+            addImportError(report, row, err.Error())
+            continue
+        }
+        report.ValidRows++
+
+        if dryRun {
+            continue
+        }
+        subscription := newSubscription(req)
+        link(subscription)
+        batch = append(batch, repository.BatchOp{Op: model.BatchOpCreate, Subscription: subscription})
+        batchRows = append(batchRows, row)
+        if len(batch) == ImportBatchSize {
+            if err := flush(); err != nil {
+                return nil, err
+            }
+        }
+    }
+    if err := flush(); err != nil {
+        return nil, err
+    }
+
+    s.log.WithContext(ctx).Info("csv import finished", "dry_run", dryRun, "total_rows", report.TotalRows, "imported", report.Imported, "errors", report.ErrorCount)
+    return report, nil
+}
+
+// CSVError reports an import whose CSV cannot be read as a table of subscriptions, as opposed to
+// a failure to read the upload or to store its rows
+type CSVError struct {
+    Err error
+}
+
+func (e *CSVError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *CSVError) Unwrap() error {
+    return e.Err
+}
+
+// addImportError counts a failed row and lists it while the report holds fewer than MaxImportErrors
+func addImportError(report *model.ImportReport, row int, msg string) {
+    report.ErrorCount++
+    if len(report.Errors) < MaxImportErrors {
+        report.Errors = append(report.Errors, model.ImportRowError{Row: row, Error: msg})
+    }
+}
+
+// storageFailure tells whether err comes from the database or the request rather than from the
+// data of a row, so retrying the remaining rows would fail the same way
+func storageFailure(err error) bool {
+    var netErr net.Error
+    return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+        errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+// parseImportHeader maps column names to their position in the record
+func parseImportHeader(header []string) (map[string]int, error) {
+    columns := make(map[string]int, len(header))
+    for i, name := range header {
+        columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+    }
+    for _, name := range requiredImportColumns {
+        if _, ok := columns[name]; !ok {
+            return nil, fmt.Errorf("csv header is missing column %q", name)
+        }
+    }
+    return columns, nil
+}
+
+func parseImportRecord(record []string, columns map[string]int) (*model.CreateSubscriptionRequest, error) {
+    field := func(name string) string {
+        i, ok := columns[name]
+        if !ok || i >= len(record) {
+            return ""
+        }
+        return strings.TrimSpace(record[i])
+    }
+
+    price, err := strconv.Atoi(field("price"))
+    if err != nil {
+        return nil, errors.New("price must be an integer")
+    }
+
+    userID, err := uuid.Parse(field("user_id"))
+    if err != nil {
+        return nil, errors.New("user_id must be a valid UUID")
+    }
+
+    req := &model.CreateSubscriptionRequest{
+        ServiceName: field("service_name"),
+        Price:       price,
+        UserID:      userID,
+        StartDate:   field("start_date"),
+    }
+    if endDate := field("end_date"); endDate != "" {
+        req.EndDate = &endDate
+    }
+    if category := field("category"); category != "" {
+        req.Category = &category
+    }
+    if tags := field("tags"); tags != "" {
+        req.Tags = strings.Split(tags, export.TagSeparator)
+    }
+    return req, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "math"
+    "strings"
+
+    "subscription-service/internal/model"
+    "subscription-service/internal/statement"
+    "subscription-service/internal/tracing"
+    "github.com/google/uuid"
+)
+
+// AnalyzeStatement parses an OFX or CAMT.053 statement, detects recurring debits and matches
+// them against the user's subscriptions by merchant name and amount. Untracked recurring
+// charges are returned as proposals that can be submitted to Create or Batch; nothing is written.
+// Subscription prices are rubles, so charges in other currencies are only listed as such.
+func (s *SubscriptionService) AnalyzeStatement(ctx context.Context, userID uuid.UUID, r io.Reader) (_ *model.StatementReport, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.AnalyzeStatement")
+    defer func() { tracing.End(span, err) }()
+
+    format, txs, err := statement.Parse(r)
+    if err != nil {
+        return nil, err
+    }
+
+    subscriptions, err := s.repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to get subscriptions: %w", err)
+    }
+
+    report := &model.StatementReport{
+        Format:       string(format),
+        Transactions: len(txs),
+        Matched:      make([]model.RecurringCharge, 0),
+        Proposed:     make([]model.RecurringCharge, 0),
+        Foreign:      make([]model.RecurringCharge, 0),
+    }
+
+    for _, charge := range statement.DetectRecurring(txs) {
+        // Amounts are in minor units; subscription prices are whole rubles
+        amount := int(math.Round(float64(charge.Amount) / 100))
+        result := model.RecurringCharge{
+            Merchant:    charge.Merchant,
+            Amount:      amount,
+            Currency:    charge.Currency,
+            Occurrences: charge.Occurrences,
+            FirstCharge: charge.FirstCharge.Format("2006-01-02"),
+            LastCharge:  charge.LastCharge.Format("2006-01-02"),
+        }
+
+        if !isRubles(charge.Currency) {
+            report.Foreign = append(report.Foreign, result)
+            continue
+        }
+        if sub, exact := matchSubscription(subscriptions, charge.Merchant, amount); sub != nil {
+            id := sub.ID
+            result.SubscriptionID = &id
+            result.PriceChanged = !exact
+            report.Matched = append(report.Matched, result)
+            continue
+        }
+
+        result.Proposal = &model.CreateSubscriptionRequest{
+            ServiceName: charge.Merchant,
+            Price:       amount,
+            UserID:      userID,
+            StartDate:   charge.FirstCharge.Format("01-2006"),
+        }
+        report.Proposed = append(report.Proposed, result)
+    }
+
+    s.log.WithContext(ctx).Info("statement analyzed", "user_id", userID, "format", format, "transactions", len(txs), "matched", len(report.Matched), "proposed", len(report.Proposed), "foreign", len(report.Foreign))
+    return report, nil
+}
+
+// isRubles tells whether a statement currency code is rubles. RUR is the code replaced in 1998
+// that some banks still export; a statement that names no currency is taken to be in rubles.
+func isRubles(currency string) bool {
+    switch strings.ToUpper(strings.TrimSpace(currency)) {
+    case "", "RUB", "RUR":
+        return true
+    default:
+        return false
+    }
+}
+
+// matchSubscription finds a subscription whose service name matches the merchant, preferring one
+// with a similar price. exact is false when only the name matched, which usually means a price change.
+func matchSubscription(subscriptions []model.Subscription, merchant string, amount int) (match *model.Subscription, exact bool) {
+    key := statement.NormalizeMerchant(merchant)
+    for i := range subscriptions {
+        name := statement.NormalizeMerchant(subscriptions[i].ServiceName)
+        if name == "" || !(strings.Contains(key, name) || strings.Contains(name, key)) {
+            continue
+        }
+        if statement.SimilarAmount(int64(subscriptions[i].Price), int64(amount)) {
+            return &subscriptions[i], true
+        }
+        if match == nil {
+            match = &subscriptions[i]
+        }
+    }
+    return match, false
+}
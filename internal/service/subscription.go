@@ -1,66 +1,106 @@
 package service
 
 import (
+    "context"
     "errors"
     "fmt"
     "regexp"
+    "strings"
     
+    "subscription-service/internal/cache"
+    "subscription-service/internal/logger"
     "subscription-service/internal/model"
     "subscription-service/internal/repository"
+    "subscription-service/internal/tracing"
     "github.com/google/uuid"
 )
 
+// MaxBatchOperations is the maximum number of operations accepted in a single batch request
+const MaxBatchOperations = 500
+
 type SubscriptionService struct {
     repo repository.SubscriptionRepository
+    log  *logger.Logger
+    // costs caches cost reports; nil disables caching
+    costs *cache.CostCache
+    // catalog links subscriptions to service catalog entries; nil stores names as given
+    catalog *CatalogService
+}
+
+func NewSubscriptionService(repo repository.SubscriptionRepository, log *logger.Logger) *SubscriptionService {
+    return &SubscriptionService{repo: repo, log: log}
 }
 
-func NewSubscriptionService(repo repository.SubscriptionRepository) *SubscriptionService {
-    return &SubscriptionService{repo: repo}
+// UseCostCache serves cost reports from costs and invalidates them on every write.
+// It must be called before the service handles requests.
+func (s *SubscriptionService) UseCostCache(costs *cache.CostCache) {
+    s.costs = costs
+}
+
+// UseCatalog links the subscriptions written from now on to the catalog entry their service_name
+// matches and stores them under its name. Cost filters on service_name are matched the same way.
+// It must be called before the service handles requests.
+func (s *SubscriptionService) UseCatalog(catalog *CatalogService) {
+    s.catalog = catalog
+    catalog.relinked = s.invalidateCosts
 }
 
 // Create creates a new subscription
-func (s *SubscriptionService) Create(req *model.CreateSubscriptionRequest) (*model.Subscription, error) {
-    if req == nil {
-        return nil, errors.New("subscription request cannot be nil")
-    }
+func (s *SubscriptionService) Create(ctx context.Context, req *model.CreateSubscriptionRequest) (_ *model.Subscription, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.Create")
+    defer func() { tracing.End(span, err) }()
     
-    // Validate start date format (MM-YYYY)
-    if !isValidDateFormat(req.StartDate) {
-        return nil, errors.New("start_date must be in MM-YYYY format")
+    if err := validateCreateRequest(req); err != nil {
+        log := s.log.WithContext(ctx)
+        if req != nil {
+            log = log.With("user_id", req.UserID)
+        }
+        log.Debug("subscription rejected", "error", err)
+        return nil, err
     }
     
-    // Validate end date format if provided
-    if req.EndDate != nil && !isValidDateFormat(*req.EndDate) {
-        return nil, errors.New("end_date must be in MM-YYYY format")
-    }
-    
-    subscription := &model.Subscription{
-        ServiceName: req.ServiceName,
-        Price:       req.Price,
-        UserID:      req.UserID,
-        StartDate:   req.StartDate,
-        EndDate:     req.EndDate,
+    link, err := s.linker(ctx)
+    if err != nil {
+        return nil, err
     }
+    subscription := newSubscription(req)
+    link(subscription)
     
-    if err := s.repo.Create(subscription); err != nil {
+    if err := s.repo.Create(ctx, subscription); err != nil {
         return nil, fmt.Errorf("failed to create subscription: %w", err)
     }
+    s.invalidateCosts(ctx, subscription.UserID)
     
+    s.log.WithContext(ctx).Info("subscription created", "subscription_id", subscription.ID, "user_id", subscription.UserID, "service_name", subscription.ServiceName)
     return subscription, nil
 }
 
 // GetAll returns all subscriptions
-func (s *SubscriptionService) GetAll() ([]model.Subscription, error) {
-    return s.repo.GetAll()
+func (s *SubscriptionService) GetAll(ctx context.Context) (_ []model.Subscription, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.GetAll")
+    defer func() { tracing.End(span, err) }()
+    return s.repo.GetAll(ctx)
+}
+
+// GetByUser returns all subscriptions of a user
+func (s *SubscriptionService) GetByUser(ctx context.Context, userID uuid.UUID) (_ []model.Subscription, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.GetByUser")
+    defer func() { tracing.End(span, err) }()
+    return s.repo.GetByFilters(ctx, model.SubscriptionFilter{UserID: &userID})
 }
 
 // GetByID returns subscription by ID
-func (s *SubscriptionService) GetByID(id int) (*model.Subscription, error) {
-    return s.repo.GetByID(id)
+func (s *SubscriptionService) GetByID(ctx context.Context, id int) (_ *model.Subscription, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.GetByID")
+    defer func() { tracing.End(span, err) }()
+    return s.repo.GetByID(ctx, id)
 }
 
 // Update updates existing subscription
-func (s *SubscriptionService) Update(subscription *model.Subscription) error {
+func (s *SubscriptionService) Update(ctx context.Context, subscription *model.Subscription) (err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.Update")
+    defer func() { tracing.End(span, err) }()
+    
     if subscription == nil {
         return errors.New("subscription cannot be nil")
     }
@@ -74,47 +114,600 @@ func (s *SubscriptionService) Update(subscription *model.Subscription) error {
         return errors.New("end_date must be in MM-YYYY format")
     }
     
-    return s.repo.Update(subscription)
+    subscription.Category, subscription.Tags = normalizeLabels(subscription.Category, subscription.Tags)
+    if err := validateLabels(subscription.Category, subscription.Tags); err != nil {
+        return err
+    }
+    
+    link, err := s.linker(ctx)
+    if err != nil {
+        return err
+    }
+    link(subscription)
+    
+    var touched []uuid.UUID
+    err = s.write(ctx, func(repo repository.SubscriptionRepository) error {
+        var err error
+        touched, err = s.applyOp(ctx, repo, repository.BatchOp{Op: model.BatchOpUpdate, Subscription: subscription})
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    s.invalidateCosts(ctx, touched...)
+    
+    s.log.WithContext(ctx).Info("subscription updated", "subscription_id", subscription.ID, "user_id", subscription.UserID)
+    return nil
 }
 
 // Delete deletes subscription by ID
-func (s *SubscriptionService) Delete(id int) error {
-    return s.repo.Delete(id)
+func (s *SubscriptionService) Delete(ctx context.Context, id int) (err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.Delete")
+    defer func() { tracing.End(span, err) }()
+    
+    var touched []uuid.UUID
+    err = s.write(ctx, func(repo repository.SubscriptionRepository) error {
+        var err error
+        touched, err = s.applyOp(ctx, repo, repository.BatchOp{Op: model.BatchOpDelete, ID: id})
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    s.invalidateCosts(ctx, touched...)
+    
+    s.log.WithContext(ctx).Info("subscription deleted", "subscription_id", id)
+    return nil
 }
 
-// CalculateTotalCost calculates total cost with optional filters
-func (s *SubscriptionService) CalculateTotalCost(userID *uuid.UUID, serviceName *string, period *string) (*model.SummaryCostResponse, error) {
-    // Validate period format if provided
-    if period != nil && !isValidDateFormat(*period) {
-        return nil, errors.New("period must be in MM-YYYY format")
+// CostSummary calculates the cost with optional filters without loading the subscriptions.
+// With groupBy the summary also holds the cost per value of that dimension.
+func (s *SubscriptionService) CostSummary(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (_ *model.CostSummary, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.CostSummary")
+    defer func() { tracing.End(span, err) }()
+    
+    filter, err = s.prepareFilter(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+    if err := validateGroupBy(groupBy); err != nil {
+        return nil, &FilterError{Err: err}
     }
     
-    subscriptions, err := s.repo.GetByFilters(userID, serviceName, period)
+    summary := &model.CostSummary{}
+    err = s.cachedCost(ctx, costKey(filter, groupBy, false), summary, func(ctx context.Context) error {
+        compute := func(repo repository.SubscriptionRepository) error {
+            computed, err := repo.SummarizeCost(ctx, filter, groupBy)
+            if err != nil {
+                return err
+            }
+            *summary = *computed
+            return nil
+        }
+        // Groups are read separately from the totals, so they need a snapshot to add up
+        var err error
+        if groupBy == "" {
+            err = compute(s.repo)
+        } else {
+            err = s.repo.WithSnapshot(ctx, compute)
+        }
+        if err != nil {
+            return fmt.Errorf("failed to calculate cost: %w", err)
+        }
+        setCostFilters(summary, filter)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return summary, nil
+}
+
+// CalculateTotalCost calculates the cost with optional filters and lists the subscriptions it covers.
+// Both are read from one snapshot, so the items always add up to the total.
+func (s *SubscriptionService) CalculateTotalCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (_ *model.SummaryCostResponse, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.CalculateTotalCost")
+    defer func() { tracing.End(span, err) }()
+    
+    filter, err = s.prepareFilter(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+    if err := validateGroupBy(groupBy); err != nil {
+        return nil, &FilterError{Err: err}
+    }
+    
+    response := &model.SummaryCostResponse{}
+    err = s.cachedCost(ctx, costKey(filter, groupBy, true), response, func(ctx context.Context) error {
+        err := s.repo.WithSnapshot(ctx, func(repo repository.SubscriptionRepository) error {
+            summary, err := repo.SummarizeCost(ctx, filter, groupBy)
+            if err != nil {
+                return err
+            }
+            items, err := repo.GetByFilters(ctx, filter)
+            if err != nil {
+                return err
+            }
+            response.CostSummary = *summary
+            response.Items = items
+            return nil
+        })
+        if err != nil {
+            return fmt.Errorf("failed to calculate cost: %w", err)
+        }
+        setCostFilters(&response.CostSummary, filter)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return response, nil
+}
+
+// List returns the subscriptions matching the optional filters, newest first
+func (s *SubscriptionService) List(ctx context.Context, filter model.SubscriptionFilter) (_ []model.Subscription, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.List")
+    defer func() { tracing.End(span, err) }()
+    
+    filter, err = s.prepareFilter(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+    return s.repo.GetByFilters(ctx, filter)
+}
+
+// FilterError reports a filter or group_by of a listing or cost report that is not valid, as
+// opposed to a failure to read the subscriptions
+type FilterError struct {
+    Err error
+}
+
+func (e *FilterError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *FilterError) Unwrap() error {
+    return e.Err
+}
+
+// prepareFilter validates filter and returns it with its category and tags normalized like those
+// of subscriptions and its service name matched against the catalog. Invalid filters are reported
+// as a *FilterError.
+func (s *SubscriptionService) prepareFilter(ctx context.Context, filter model.SubscriptionFilter) (model.SubscriptionFilter, error) {
+    if filter.Period != nil && !isValidDateFormat(*filter.Period) {
+        return filter, &FilterError{Err: errors.New("period must be in MM-YYYY format")}
+    }
+    filter.Category, filter.Tags = normalizeLabels(filter.Category, filter.Tags)
+    if err := validateLabels(filter.Category, filter.Tags); err != nil {
+        return filter, &FilterError{Err: err}
+    }
+    serviceName, err := s.canonicalService(ctx, filter.ServiceName)
+    if err != nil {
+        return filter, err
+    }
+    filter.ServiceName = serviceName
+    return filter, nil
+}
+
+// costKey is the cache key of a cost report
+func costKey(filter model.SubscriptionFilter, groupBy string, includeItems bool) cache.CostKey {
+    return cache.CostKey{
+        UserID:       filter.UserID,
+        ServiceName:  filter.ServiceName,
+        Period:       filter.Period,
+        Category:     filter.Category,
+        Tags:         filter.Tags,
+        GroupBy:      groupBy,
+        IncludeItems: includeItems,
+    }
+}
+
+// validateGroupBy checks the group_by dimension of a cost report; empty means no grouping
+func validateGroupBy(groupBy string) error {
+    switch groupBy {
+    case "", model.GroupByCategory, model.GroupByTag, model.GroupByServiceName:
+        return nil
+    }
+    return fmt.Errorf("group_by must be one of %s, %s, %s", model.GroupByCategory, model.GroupByTag, model.GroupByServiceName)
+}
+
+// cachedCost fills report from the cost cache, or with compute and then caches it. A report that
+// is cached is computed on the primary: the replica may lag behind writes that already invalidated
+// the cache, and the stale report would be served until it expires.
+func (s *SubscriptionService) cachedCost(ctx context.Context, key cache.CostKey, report interface{}, compute func(ctx context.Context) error) error {
+    if s.costs == nil {
+        return compute(ctx)
+    }
+    storeKey, ok := s.costs.Get(ctx, key, report)
+    if ok {
+        return nil
+    }
+    if err := compute(repository.ReadPrimary(ctx)); err != nil {
+        return err
+    }
+    s.costs.Set(ctx, storeKey, report)
+    return nil
+}
+
+// invalidateCosts drops the cached cost reports that include subscriptions of users
+func (s *SubscriptionService) invalidateCosts(ctx context.Context, users ...uuid.UUID) {
+    if s.costs != nil && len(users) > 0 {
+        s.costs.Invalidate(ctx, users...)
+    }
+}
+
+// write runs fn in a transaction when cost reports are cached, so that the owners looked up
+// for invalidation are the ones whose subscriptions change. Otherwise no lookups are made.
+func (s *SubscriptionService) write(ctx context.Context, fn func(repository.SubscriptionRepository) error) error {
+    if s.costs == nil {
+        return fn(s.repo)
+    }
+    return s.repo.WithTx(ctx, fn)
+}
+
+// linker returns a function that links a subscription to the catalog entry its service_name refers
+// to and renames it after the entry, or unlinks it if there is none. The catalog is read once, so
+// every subscription of a batch is matched against the same entries.
+func (s *SubscriptionService) linker(ctx context.Context) (func(*model.Subscription), error) {
+    if s.catalog == nil {
+        return func(*model.Subscription) {}, nil
+    }
+    match, err := s.catalog.matcher(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return func(subscription *model.Subscription) {
+        subscription.ServiceID = nil
+        if service, ok := match(subscription.ServiceName); ok {
+            id := service.ID
+            subscription.ServiceID = &id
+            subscription.ServiceName = service.Name
+        }
+    }, nil
+}
+
+// canonicalService returns the catalog name of a service_name filter, so that reports asked for
+// under any spelling cover the subscriptions stored under the catalog name
+func (s *SubscriptionService) canonicalService(ctx context.Context, serviceName *string) (*string, error) {
+    if s.catalog == nil || serviceName == nil || *serviceName == "" {
+        return serviceName, nil
+    }
+    match, err := s.catalog.matcher(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if service, ok := match(*serviceName); ok {
+        return &service.Name, nil
+    }
+    return serviceName, nil
+}
+
+// setCostFilters records the filters a summary was calculated with
+func setCostFilters(summary *model.CostSummary, filter model.SubscriptionFilter) {
+    summary.Period = "all time"
+    if filter.Period != nil {
+        summary.Period = *filter.Period
+    }
+    summary.UserID = filter.UserID
+    summary.Service = filter.ServiceName
+    summary.Category = filter.Category
+    summary.Tags = filter.Tags
+}
+
+// Iterate streams the subscriptions matching the optional filters to fn in the same order as List
+func (s *SubscriptionService) Iterate(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) (err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.Iterate")
+    defer func() { tracing.End(span, err) }()
+    
+    filter, err = s.prepareFilter(ctx, filter)
+    if err != nil {
+        return err
+    }
+    return s.repo.IterateByFilters(ctx, filter, fn)
+}
+
+// IterateCost streams the subscriptions included in a cost calculation to fn
+// and returns the summary without items or monthly breakdown once the stream is exhausted
+func (s *SubscriptionService) IterateCost(ctx context.Context, filter model.SubscriptionFilter, fn func(*model.Subscription) error) (_ *model.SummaryCostResponse, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.IterateCost")
+    defer func() { tracing.End(span, err) }()
+    
+    filter, err = s.prepareFilter(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+    
+    response := &model.SummaryCostResponse{}
+    err = s.repo.IterateByFilters(ctx, filter, func(sub *model.Subscription) error {
+        response.TotalCost += sub.Price
+        response.SubscriptionCount++
+        return fn(sub)
+    })
     if err != nil {
         return nil, fmt.Errorf("failed to get subscriptions: %w", err)
     }
     
-    totalCost := 0
-    for _, sub := range subscriptions {
-        totalCost += sub.Price
+    setCostFilters(&response.CostSummary, filter)
+    return response, nil
+}
+
+// Batch validates and executes a batch of create, update and delete operations.
+// In atomic mode nothing is written unless every operation is valid and succeeds;
+// in best-effort mode each operation is executed independently.
+func (s *SubscriptionService) Batch(ctx context.Context, req *model.BatchRequest) (_ *model.BatchResponse, err error) {
+    ctx, span := tracing.Start(ctx, "SubscriptionService.Batch")
+    defer func() { tracing.End(span, err) }()
+    
+    if req == nil {
+        return nil, errors.New("batch request cannot be nil")
+    }
+    
+    mode := req.Mode
+    if mode == "" {
+        mode = model.BatchModeAtomic
+    }
+    if mode != model.BatchModeAtomic && mode != model.BatchModeBestEffort {
+        return nil, errors.New("mode must be either atomic or best_effort")
+    }
+    
+    if len(req.Operations) == 0 {
+        return nil, errors.New("operations cannot be empty")
+    }
+    if len(req.Operations) > MaxBatchOperations {
+        return nil, fmt.Errorf("batch cannot contain more than %d operations", MaxBatchOperations)
+    }
+    
+    response := &model.BatchResponse{
+        Mode:    mode,
+        Results: make([]model.BatchItemResult, len(req.Operations)),
+    }
+    
+    link, err := s.linker(ctx)
+    if err != nil {
+        return nil, err
+    }
+    
+    ops := make([]repository.BatchOp, len(req.Operations))
+    valid := true
+    for i, operation := range req.Operations {
+        response.Results[i] = model.BatchItemResult{Index: i, Op: operation.Op}
+        op, err := buildBatchOp(operation)
+        if err != nil {
+            response.Results[i].Error = err.Error()
+            valid = false
+            continue
+        }
+        if op.Subscription != nil {
+            link(op.Subscription)
+        }
+        ops[i] = op
     }
     
-    periodStr := "all time"
-    if period != nil {
-        periodStr = *period
+    if mode == model.BatchModeAtomic {
+        if valid {
+            var touched []uuid.UUID
+            err := s.repo.WithTx(ctx, func(repo repository.SubscriptionRepository) error {
+                var err error
+                if touched, err = s.touchedUsers(ctx, repo, ops); err != nil {
+                    return err
+                }
+                return repo.ApplyBatch(ctx, ops)
+            })
+            if err != nil {
+                var batchErr *repository.BatchError
+                if !errors.As(err, &batchErr) {
+                    return nil, fmt.Errorf("failed to apply batch: %w", err)
+                }
+                response.Results[batchErr.Index].Error = batchErr.Err.Error()
+            } else {
+                s.invalidateCosts(ctx, touched...)
+                for i := range ops {
+                    response.Results[i].Success = true
+                    response.Results[i].Subscription = ops[i].Subscription
+                }
+            }
+        }
+    } else {
+        for i, op := range ops {
+            if response.Results[i].Error != "" {
+                continue
+            }
+            var touched []uuid.UUID
+            err := s.write(ctx, func(repo repository.SubscriptionRepository) error {
+                var err error
+                touched, err = s.applyOp(ctx, repo, op)
+                return err
+            })
+            if err != nil {
+                response.Results[i].Error = err.Error()
+                continue
+            }
+            s.invalidateCosts(ctx, touched...)
+            response.Results[i].Success = true
+            response.Results[i].Subscription = op.Subscription
+        }
     }
     
-    response := &model.SummaryCostResponse{
-        TotalCost: totalCost,
-        Period:    periodStr,
-        UserID:    userID,
-        Service:   serviceName,
-        Items:     subscriptions,
+    for _, result := range response.Results {
+        if result.Success {
+            response.Succeeded++
+        } else {
+            response.Failed++
+        }
     }
     
+    s.log.WithContext(ctx).Info("batch applied", "mode", mode, "succeeded", response.Succeeded, "failed", response.Failed)
     return response, nil
 }
 
+// applyOp executes a single batch operation on repo, which may be bound to a transaction, and
+// returns the users whose cost reports it changes
+func (s *SubscriptionService) applyOp(ctx context.Context, repo repository.SubscriptionRepository, op repository.BatchOp) ([]uuid.UUID, error) {
+    touched, err := s.touchedUsers(ctx, repo, []repository.BatchOp{op})
+    if err != nil {
+        return nil, err
+    }
+    switch op.Op {
+    case model.BatchOpCreate:
+        return touched, repo.Create(ctx, op.Subscription)
+    case model.BatchOpUpdate:
+        return touched, repo.Update(ctx, op.Subscription)
+    default:
+        return touched, repo.Delete(ctx, op.ID)
+    }
+}
+
+// touchedUsers returns the users whose cost reports ops change: those they write and, when cost
+// reports are cached, the current owners of the updated and deleted subscriptions, as an update
+// may move one to another user. It must run on repo before ops are applied. Missing subscriptions
+// are skipped; applying the operation reports them.
+func (s *SubscriptionService) touchedUsers(ctx context.Context, repo repository.SubscriptionRepository, ops []repository.BatchOp) ([]uuid.UUID, error) {
+    var touched []uuid.UUID
+    for _, op := range ops {
+        if op.Subscription != nil {
+            touched = append(touched, op.Subscription.UserID)
+        }
+        if s.costs == nil || op.Op == model.BatchOpCreate {
+            continue
+        }
+        id := op.ID
+        if op.Op == model.BatchOpUpdate {
+            id = op.Subscription.ID
+        }
+        current, err := repo.GetByID(ctx, id)
+        if err != nil {
+            if err.Error() == "subscription not found" {
+                continue
+            }
+            return nil, err
+        }
+        touched = append(touched, current.UserID)
+    }
+    return touched, nil
+}
+
+// buildBatchOp validates a batch operation and converts it to a repository write
+func buildBatchOp(operation model.BatchOperation) (repository.BatchOp, error) {
+    switch operation.Op {
+    case model.BatchOpCreate:
+        if err := validateCreateRequest(operation.Subscription); err != nil {
+            return repository.BatchOp{}, err
+        }
+        return repository.BatchOp{Op: operation.Op, Subscription: newSubscription(operation.Subscription)}, nil
+    case model.BatchOpUpdate:
+        if operation.ID <= 0 {
+            return repository.BatchOp{}, errors.New("id is required for update")
+        }
+        if err := validateCreateRequest(operation.Subscription); err != nil {
+            return repository.BatchOp{}, err
+        }
+        subscription := newSubscription(operation.Subscription)
+        subscription.ID = operation.ID
+        return repository.BatchOp{Op: operation.Op, ID: operation.ID, Subscription: subscription}, nil
+    case model.BatchOpDelete:
+        if operation.ID <= 0 {
+            return repository.BatchOp{}, errors.New("id is required for delete")
+        }
+        return repository.BatchOp{Op: operation.Op, ID: operation.ID}, nil
+    default:
+        return repository.BatchOp{}, fmt.Errorf("unknown operation %q", operation.Op)
+    }
+}
+
+// validateCreateRequest applies the validation rules shared by create and update
+func validateCreateRequest(req *model.CreateSubscriptionRequest) error {
+    if req == nil {
+        return errors.New("subscription request cannot be nil")
+    }
+    
+    if req.ServiceName == "" {
+        return errors.New("service_name is required")
+    }
+    
+    if req.Price <= 0 {
+        return errors.New("price must be greater than 0")
+    }
+    
+    if req.UserID == uuid.Nil {
+        return errors.New("user_id is required")
+    }
+    
+    // Validate start date format (MM-YYYY)
+    if !isValidDateFormat(req.StartDate) {
+        return errors.New("start_date must be in MM-YYYY format")
+    }
+    
+    // Validate end date format if provided
+    if req.EndDate != nil && !isValidDateFormat(*req.EndDate) {
+        return errors.New("end_date must be in MM-YYYY format")
+    }
+    
+    return validateLabels(normalizeLabels(req.Category, req.Tags))
+}
+
+func newSubscription(req *model.CreateSubscriptionRequest) *model.Subscription {
+    category, tags := normalizeLabels(req.Category, req.Tags)
+    return &model.Subscription{
+        ServiceName: req.ServiceName,
+        Price:       req.Price,
+        UserID:      req.UserID,
+        StartDate:   req.StartDate,
+        EndDate:     req.EndDate,
+        Category:    category,
+        Tags:        tags,
+    }
+}
+
+// Limits on the tags of a subscription
+const (
+    maxTags      = 20
+    maxTagLength = 50
+)
+
+// normalizeLabels trims and lowercases a category and tags, so that "Infra" and " infra" filter and
+// group together. An empty category becomes nil; empty and repeated tags are dropped.
+func normalizeLabels(category *string, tags []string) (*string, []string) {
+    if category != nil {
+        normalized := strings.ToLower(strings.TrimSpace(*category))
+        category = &normalized
+        if normalized == "" {
+            category = nil
+        }
+    }
+    var normalized []string
+    seen := make(map[string]bool, len(tags))
+    for _, tag := range tags {
+        tag = strings.ToLower(strings.TrimSpace(tag))
+        if tag != "" && !seen[tag] {
+            seen[tag] = true
+            normalized = append(normalized, tag)
+        }
+    }
+    return category, normalized
+}
+
+// validateLabels checks a normalized category and tags
+func validateLabels(category *string, tags []string) error {
+    if category != nil {
+        valid := false
+        for _, known := range model.Categories {
+            valid = valid || *category == known
+        }
+        if !valid {
+            return fmt.Errorf("category must be one of %s", strings.Join(model.Categories, ", "))
+        }
+    }
+    if len(tags) > maxTags {
+        return fmt.Errorf("at most %d tags are allowed", maxTags)
+    }
+    for _, tag := range tags {
+        if len(tag) > maxTagLength {
+            return fmt.Errorf("tags must be at most %d characters", maxTagLength)
+        }
+    }
+    return nil
+}
+
 // isValidDateFormat validates date format MM-YYYY
 func isValidDateFormat(date string) bool {
     // Regular expression for MM-YYYY format (01-12 for month, 4 digits for year)
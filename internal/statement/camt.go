@@ -0,0 +1,103 @@
+package statement
+
+import (
+    "encoding/xml"
+    "fmt"
+    "io"
+    "time"
+)
+
+// camtDocument maps the parts of an ISO 20022 camt.053 statement used for detection.
+// Element names are matched without namespace, so all camt.053.001.xx versions are accepted.
+type camtDocument struct {
+    Statements []struct {
+        Entries []camtEntry `xml:"Ntry"`
+    } `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+    Amount struct {
+        Value    string `xml:",chardata"`
+        Currency string `xml:"Ccy,attr"`
+    } `xml:"Amt"`
+    CreditDebit string   `xml:"CdtDbtInd"`
+    BookingDate camtDate `xml:"BookgDt"`
+    ValueDate   camtDate `xml:"ValDt"`
+    Details     []struct {
+        Creditor string `xml:"RltdPties>Cdtr>Nm"`
+        Debtor   string `xml:"RltdPties>Dbtr>Nm"`
+        Remit    string `xml:"RmtInf>Ustrd"`
+    } `xml:"NtryDtls>TxDtls"`
+    AdditionalInfo string `xml:"AddtlNtryInf"`
+}
+
+type camtDate struct {
+    Date     string `xml:"Dt"`
+    DateTime string `xml:"DtTm"`
+}
+
+func (d camtDate) parse() (time.Time, bool) {
+    if d.Date != "" {
+        t, err := time.Parse("2006-01-02", d.Date)
+        return t, err == nil
+    }
+    if len(d.DateTime) >= 10 {
+        t, err := time.Parse("2006-01-02", d.DateTime[:10])
+        return t, err == nil
+    }
+    return time.Time{}, false
+}
+
+// ParseCAMT053 parses an ISO 20022 camt.053 bank-to-customer statement
+func ParseCAMT053(r io.Reader) ([]Transaction, error) {
+    var doc camtDocument
+    if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+        return nil, fmt.Errorf("failed to parse camt.053: %w", err)
+    }
+
+    var txs []Transaction
+    for _, stmt := range doc.Statements {
+        for _, entry := range stmt.Entries {
+            amount, err := parseAmount(entry.Amount.Value)
+            if err != nil {
+                return nil, err
+            }
+            if entry.CreditDebit == "DBIT" {
+                amount = -amount
+            }
+
+            date, ok := entry.BookingDate.parse()
+            if !ok {
+                if date, ok = entry.ValueDate.parse(); !ok {
+                    return nil, fmt.Errorf("entry without booking or value date")
+                }
+            }
+
+            txs = append(txs, Transaction{
+                Date:     date,
+                Amount:   amount,
+                Currency: entry.Amount.Currency,
+                Merchant: entry.merchant(),
+            })
+        }
+    }
+    return txs, nil
+}
+
+// merchant returns the counterparty name, falling back to the remittance information
+func (e camtEntry) merchant() string {
+    for _, d := range e.Details {
+        if e.CreditDebit == "DBIT" && d.Creditor != "" {
+            return d.Creditor
+        }
+        if e.CreditDebit != "DBIT" && d.Debtor != "" {
+            return d.Debtor
+        }
+    }
+    for _, d := range e.Details {
+        if d.Remit != "" {
+            return d.Remit
+        }
+    }
+    return e.AdditionalInfo
+}
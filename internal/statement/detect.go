@@ -0,0 +1,120 @@
+package statement
+
+import (
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    // Consecutive charges must be roughly a month apart to count as recurring
+    minMonthlyGapDays = 25
+    maxMonthlyGapDays = 35
+    // AmountTolerance is the relative difference still treated as the same price
+    AmountTolerance = 0.1
+)
+
+// RecurringCharge is a merchant that debited the account about once a month
+type RecurringCharge struct {
+    Merchant    string
+    Amount      int64
+    Currency    string
+    Occurrences int
+    FirstCharge time.Time
+    LastCharge  time.Time
+}
+
+var (
+    nonWord       = regexp.MustCompile(`[^\p{L}\s]+`)
+    spaces        = regexp.MustCompile(`\s+`)
+    merchantNoise = regexp.MustCompile(`^(pos|card payment|payment|purchase|www)\s+|\s+(com|ru|net|inc|ltd|llc|ooo)$`)
+)
+
+// NormalizeMerchant reduces a merchant or service name to a comparable key,
+// dropping case, digits, punctuation and common card-terminal noise
+func NormalizeMerchant(name string) string {
+    key := strings.ToLower(name)
+    key = nonWord.ReplaceAllString(key, " ")
+    key = strings.TrimSpace(spaces.ReplaceAllString(key, " "))
+    for {
+        trimmed := strings.TrimSpace(merchantNoise.ReplaceAllString(key, ""))
+        if trimmed == key {
+            return key
+        }
+        key = trimmed
+    }
+}
+
+// DetectRecurring groups debits by merchant and currency and returns those charged at monthly
+// intervals with a stable amount, ordered by merchant and currency
+func DetectRecurring(txs []Transaction) []RecurringCharge {
+    groups := make(map[string][]Transaction)
+    for _, tx := range txs {
+        if tx.Amount >= 0 {
+            continue
+        }
+        key := NormalizeMerchant(tx.Merchant)
+        if key == "" {
+            continue
+        }
+        // Amounts in different currencies cannot be compared
+        key += "\x00" + tx.Currency
+        groups[key] = append(groups[key], tx)
+    }
+
+    var charges []RecurringCharge
+    for _, group := range groups {
+        if len(group) < 2 {
+            continue
+        }
+        sort.Slice(group, func(i, j int) bool { return group[i].Date.Before(group[j].Date) })
+        if !isMonthly(group) {
+            continue
+        }
+
+        last := group[len(group)-1]
+        charges = append(charges, RecurringCharge{
+            Merchant:    strings.TrimSpace(last.Merchant),
+            Amount:      -last.Amount,
+            Currency:    last.Currency,
+            Occurrences: len(group),
+            FirstCharge: group[0].Date,
+            LastCharge:  last.Date,
+        })
+    }
+
+    sort.Slice(charges, func(i, j int) bool {
+        if charges[i].Merchant != charges[j].Merchant {
+            return charges[i].Merchant < charges[j].Merchant
+        }
+        return charges[i].Currency < charges[j].Currency
+    })
+    return charges
+}
+
+func isMonthly(group []Transaction) bool {
+    for i := 1; i < len(group); i++ {
+        gap := int(group[i].Date.Sub(group[i-1].Date).Hours() / 24)
+        if gap < minMonthlyGapDays || gap > maxMonthlyGapDays {
+            return false
+        }
+        if !SimilarAmount(-group[i].Amount, -group[i-1].Amount) {
+            return false
+        }
+    }
+    return true
+}
+
+// SimilarAmount reports whether two amounts differ by no more than AmountTolerance
+func SimilarAmount(a, b int64) bool {
+    diff := a - b
+    if diff < 0 {
+        diff = -diff
+    }
+    max := a
+    if b > max {
+        max = b
+    }
+    return float64(diff) <= float64(max)*AmountTolerance
+}
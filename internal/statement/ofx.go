@@ -0,0 +1,92 @@
+package statement
+
+import (
+    "fmt"
+    "io"
+    "strings"
+    "time"
+)
+
+// ParseOFX parses OFX 1.x (SGML, unclosed tags) and OFX 2.x (XML) statements.
+// Both are handled by reading each STMTTRN block and taking the text that follows each tag.
+// Tags are found in an ASCII upper-cased copy, which has the same byte offsets as the content.
+func ParseOFX(r io.Reader) ([]Transaction, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read OFX: %w", err)
+    }
+    content := string(data)
+    upper := asciiUpper(content)
+
+    currency := ofxValue(content, upper, "CURDEF")
+
+    var txs []Transaction
+    for {
+        start := strings.Index(upper, "<STMTTRN>")
+        if start < 0 {
+            break
+        }
+        end := strings.Index(upper[start:], "</STMTTRN>")
+        if end < 0 {
+            return nil, fmt.Errorf("unterminated STMTTRN block")
+        }
+        block, blockUpper := content[start:start+end], upper[start:start+end]
+        content, upper = content[start+end:], upper[start+end:]
+
+        tx, err := parseOFXTransaction(block, blockUpper)
+        if err != nil {
+            return nil, err
+        }
+        tx.Currency = currency
+        txs = append(txs, tx)
+    }
+    return txs, nil
+}
+
+func parseOFXTransaction(block, upper string) (Transaction, error) {
+    amount, err := parseAmount(ofxValue(block, upper, "TRNAMT"))
+    if err != nil {
+        return Transaction{}, err
+    }
+
+    posted := ofxValue(block, upper, "DTPOSTED")
+    if len(posted) < 8 {
+        return Transaction{}, fmt.Errorf("invalid DTPOSTED %q", posted)
+    }
+    date, err := time.Parse("20060102", posted[:8])
+    if err != nil {
+        return Transaction{}, fmt.Errorf("invalid DTPOSTED %q", posted)
+    }
+
+    merchant := ofxValue(block, upper, "NAME")
+    if merchant == "" {
+        merchant = ofxValue(block, upper, "MEMO")
+    }
+
+    return Transaction{Date: date, Amount: amount, Merchant: merchant}, nil
+}
+
+// ofxValue returns the text following <TAG> up to the next tag
+func ofxValue(content, upper, tag string) string {
+    i := strings.Index(upper, "<"+tag+">")
+    if i < 0 {
+        return ""
+    }
+    value := content[i+len(tag)+2:]
+    if j := strings.IndexByte(value, '<'); j >= 0 {
+        value = value[:j]
+    }
+    return strings.TrimSpace(value)
+}
+
+// asciiUpper upper-cases ASCII letters only. Unlike strings.ToUpper it never changes the length
+// of the string ('ı' becomes the shorter "I" there), so indices found in the result are valid in s.
+func asciiUpper(s string) string {
+    b := []byte(s)
+    for i, c := range b {
+        if 'a' <= c && c <= 'z' {
+            b[i] = c - ('a' - 'A')
+        }
+    }
+    return string(b)
+}
@@ -0,0 +1,60 @@
+package statement
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Format identifies a bank statement file format
+type Format string
+
+const (
+    FormatOFX     Format = "ofx"
+    FormatCAMT053 Format = "camt.053"
+)
+
+// Transaction is a single booked statement entry. Amount is in minor units (kopecks)
+// and is negative for debits.
+type Transaction struct {
+    Date     time.Time
+    Amount   int64
+    Currency string
+    Merchant string
+}
+
+// Parse detects the statement format and parses its transactions
+func Parse(r io.Reader) (Format, []Transaction, error) {
+    br := bufio.NewReader(r)
+    head, err := br.Peek(4096)
+    if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+        return "", nil, fmt.Errorf("failed to read statement: %w", err)
+    }
+
+    switch {
+    case bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(bytes.ToUpper(head), []byte("<OFX>")):
+        txs, err := ParseOFX(br)
+        return FormatOFX, txs, err
+    case bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("BkToCstmrStmt")):
+        txs, err := ParseCAMT053(br)
+        return FormatCAMT053, txs, err
+    default:
+        return "", nil, errors.New("unsupported statement format, expected OFX or CAMT.053")
+    }
+}
+
+// parseAmount converts a decimal string such as "-399.00" or "399,5" to minor units
+func parseAmount(value string) (int64, error) {
+    value = strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
+    f, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid amount %q", value)
+    }
+    return int64(math.Round(f * 100)), nil
+}
@@ -0,0 +1,116 @@
+package tracing
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+    "go.opentelemetry.io/otel/trace"
+    "subscription-service/internal/config"
+)
+
+// instrumentationName identifies the spans created by this service
+const instrumentationName = "subscription-service"
+
+// Setup installs the global tracer provider described by cfg and the W3C trace context propagator.
+// The propagator is installed even when export is disabled, so incoming trace IDs still reach the logs.
+// The returned function flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, cfg config.TracingConfig, serviceName, version string) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+    var (
+        exporter sdktrace.SpanExporter
+        closer   io.Closer
+        err      error
+    )
+    switch cfg.Exporter {
+    case "none", "":
+        return func(context.Context) error { return nil }, nil
+    case "otlp":
+        var opts []otlptracehttp.Option
+        if cfg.Endpoint != "" {
+            opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+        }
+        if cfg.Insecure {
+            opts = append(opts, otlptracehttp.WithInsecure())
+        }
+        exporter, err = otlptracehttp.New(ctx, opts...)
+    case "stdout":
+        exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+    case "file":
+        var f *os.File
+        f, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+        if err == nil {
+            closer = f
+            exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+        }
+    default:
+        return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+    }
+
+    res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+        semconv.SchemaURL,
+        semconv.ServiceName(serviceName),
+        semconv.ServiceVersion(version),
+    ))
+    if err != nil {
+        return nil, fmt.Errorf("failed to build trace resource: %w", err)
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(res),
+        sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+    )
+    otel.SetTracerProvider(provider)
+
+    return func(ctx context.Context) error {
+        err := provider.Shutdown(ctx)
+        if closer != nil {
+            err = errors.Join(err, closer.Close())
+        }
+        return err
+    }, nil
+}
+
+// Tracer returns the service's tracer from the global provider
+func Tracer() trace.Tracer {
+    return otel.Tracer(instrumentationName)
+}
+
+// Start starts an internal span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+    return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on span and ends it
+func End(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
+
+// TraceID returns the trace ID of the span in ctx, or "" if there is none
+func TraceID(ctx context.Context) string {
+    sc := trace.SpanContextFromContext(ctx)
+    if !sc.HasTraceID() {
+        return ""
+    }
+    return sc.TraceID().String()
+}
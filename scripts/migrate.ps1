@@ -10,22 +10,21 @@ if (-not $DB_URL) {
 
 Write-Host "Database URL: $DB_URL" -ForegroundColor Yellow
 
-# Check if psql is available
-$psql = Get-Command psql -ErrorAction SilentlyContinue
-if (-not $psql) {
-    Write-Host "Error: psql command not found. Please install PostgreSQL client tools." -ForegroundColor Red
-    Write-Host "You can download PostgreSQL from: https://www.postgresql.org/download/windows/" -ForegroundColor Yellow
+# Check if golang-migrate is available
+$migrate = Get-Command migrate -ErrorAction SilentlyContinue
+if (-not $migrate) {
+    Write-Host "Error: migrate command not found. Please install golang-migrate:" -ForegroundColor Red
+    Write-Host "go install -tags postgres github.com/golang-migrate/migrate/v4/cmd/migrate@v4.17.0" -ForegroundColor Yellow
     exit 1
 }
 
-# Run migrations
+# Apply every pending migration and record the version in schema_migrations, which /readyz checks
 Write-Host "Applying migrations..." -ForegroundColor Blue
-try {
-    & psql $DB_URL -f "db/migrations/0001_init.up.sql"
-    Write-Host "Migrations completed successfully!" -ForegroundColor Green
-}
-catch {
-    Write-Host "Error running migrations: $_" -ForegroundColor Red
+$migrations = Join-Path $PSScriptRoot "..\db\migrations"
+& migrate -path $migrations -database $DB_URL up
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Error running migrations (exit code $LASTEXITCODE)" -ForegroundColor Red
     Write-Host "Please ensure PostgreSQL is running and connection details are correct." -ForegroundColor Yellow
     exit 1
-}
\ No newline at end of file
+}
+Write-Host "Migrations completed successfully!" -ForegroundColor Green
\ No newline at end of file
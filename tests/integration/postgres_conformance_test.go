@@ -0,0 +1,55 @@
+package integration
+
+import (
+    "context"
+    "database/sql"
+    "os"
+    "testing"
+    "time"
+
+    _ "github.com/lib/pq"
+    "github.com/stretchr/testify/require"
+    "subscription-service/internal/logger"
+    "subscription-service/internal/repository"
+    "subscription-service/internal/repository/repotest"
+)
+
+// TestPostgresRepositoryConformance runs the repository suite against the migrated database
+// in TEST_DATABASE_URL. The subscriptions, services and monthly spend are reset before every subtest.
+func TestPostgresRepositoryConformance(t *testing.T) {
+    dsn := os.Getenv("TEST_DATABASE_URL")
+    if dsn == "" {
+        t.Skip("TEST_DATABASE_URL is not set")
+    }
+    db, err := sql.Open("postgres", dsn)
+    require.NoError(t, err)
+    defer db.Close()
+    require.NoError(t, db.Ping())
+
+    repotest.Run(t, func(t *testing.T) repository.SubscriptionRepository {
+        _, err := db.ExecContext(context.Background(),
+            "TRUNCATE subscriptions, monthly_spend, services; UPDATE monthly_spend_state SET closed_before = 0; UPDATE services_seed_state SET seeded = false")
+        require.NoError(t, err)
+        return repository.NewPostgresRepository(db, logger.Nop(), 5*time.Second)
+    })
+}
+
+// TestPostgresServiceRepositoryConformance runs the catalog suite against the same database
+func TestPostgresServiceRepositoryConformance(t *testing.T) {
+    dsn := os.Getenv("TEST_DATABASE_URL")
+    if dsn == "" {
+        t.Skip("TEST_DATABASE_URL is not set")
+    }
+    db, err := sql.Open("postgres", dsn)
+    require.NoError(t, err)
+    defer db.Close()
+    require.NoError(t, db.Ping())
+
+    repotest.RunCatalog(t, func(t *testing.T) (repository.ServiceRepository, repository.SubscriptionRepository) {
+        _, err := db.ExecContext(context.Background(),
+            "TRUNCATE subscriptions, monthly_spend, services; UPDATE monthly_spend_state SET closed_before = 0; UPDATE services_seed_state SET seeded = false")
+        require.NoError(t, err)
+        return repository.NewPostgresServiceRepository(db, logger.Nop(), 5*time.Second),
+            repository.NewPostgresRepository(db, logger.Nop(), 5*time.Second)
+    })
+}
@@ -0,0 +1,48 @@
+package integration
+
+import (
+    "context"
+    "os"
+    "testing"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+    "subscription-service/internal/cache"
+)
+
+// TestRedisStore exercises the Redis cache backend against the server in TEST_REDIS_URL.
+// Keys are random, so the test can share a server with other data.
+func TestRedisStore(t *testing.T) {
+    rawURL := os.Getenv("TEST_REDIS_URL")
+    if rawURL == "" {
+        t.Skip("TEST_REDIS_URL is not set")
+    }
+    store, err := cache.NewRedisStore(rawURL)
+    require.NoError(t, err)
+    defer store.Close()
+
+    ctx := context.Background()
+    require.NoError(t, store.Ping(ctx))
+
+    key := "test:" + uuid.NewString()
+    _, ok, err := store.Get(ctx, key)
+    require.NoError(t, err)
+    assert.False(t, ok)
+
+    require.NoError(t, store.Set(ctx, key, []byte("report"), time.Second))
+    value, ok, err := store.Get(ctx, key)
+    require.NoError(t, err)
+    assert.True(t, ok)
+    assert.Equal(t, []byte("report"), value)
+
+    generation := "test-generation:" + uuid.NewString()
+    current, err := store.Generation(ctx, generation)
+    require.NoError(t, err)
+    assert.Zero(t, current)
+    require.NoError(t, store.Bump(ctx, generation, generation))
+    current, err = store.Generation(ctx, generation)
+    require.NoError(t, err)
+    assert.EqualValues(t, 2, current)
+}
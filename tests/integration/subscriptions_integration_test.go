@@ -1,87 +1,41 @@
 package integration
 
 import (
+    "context"
     "bytes"
     "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
     "net/http/httptest"
+    "strings"
     "testing"
+    "time"
 
     "github.com/gin-gonic/gin"
     "github.com/google/uuid"
     "github.com/stretchr/testify/assert"
+    "go.opentelemetry.io/otel"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
     "subscription-service/internal/api/handlers"
+    "subscription-service/internal/api/middleware"
+    "subscription-service/internal/calendar"
+    "subscription-service/internal/config"
+    "subscription-service/internal/health"
+    "subscription-service/internal/logger"
+    "subscription-service/internal/metrics"
+    "subscription-service/internal/repository"
     "subscription-service/internal/service"
+    "subscription-service/internal/tracing"
     "subscription-service/internal/model"
 )
 
-// Mock repository for testing
-type mockRepo struct {
-    subscriptions []model.Subscription
-    nextID        int
-}
-
-func (m *mockRepo) Create(sub *model.Subscription) error {
-    m.nextID++
-    sub.ID = m.nextID
-    m.subscriptions = append(m.subscriptions, *sub)
-    return nil
-}
-
-func (m *mockRepo) GetAll() ([]model.Subscription, error) {
-    return m.subscriptions, nil
-}
-
-func (m *mockRepo) GetByID(id int) (*model.Subscription, error) {
-    for _, sub := range m.subscriptions {
-        if sub.ID == id {
-            return &sub, nil
-        }
-    }
-    return nil, nil
-}
-
-func (m *mockRepo) Update(sub *model.Subscription) error {
-    for i, existing := range m.subscriptions {
-        if existing.ID == sub.ID {
-            m.subscriptions[i] = *sub
-            return nil
-        }
-    }
-    return nil
-}
-
-func (m *mockRepo) Delete(id int) error {
-    for i, sub := range m.subscriptions {
-        if sub.ID == id {
-            m.subscriptions = append(m.subscriptions[:i], m.subscriptions[i+1:]...)
-            return nil
-        }
-    }
-    return nil
-}
-
-func (m *mockRepo) GetByFilters(userID *uuid.UUID, serviceName *string, period *string) ([]model.Subscription, error) {
-    var result []model.Subscription
-    for _, sub := range m.subscriptions {
-        if userID != nil && sub.UserID != *userID {
-            continue
-        }
-        if serviceName != nil && sub.ServiceName != *serviceName {
-            continue
-        }
-        result = append(result, sub)
-    }
-    return result, nil
-}
-
 func setupTestRouter() *gin.Engine {
     gin.SetMode(gin.TestMode)
     
-    // Create mock dependencies
-    mockRepo := &mockRepo{}
-    service := service.NewSubscriptionService(mockRepo)
-    handler := handlers.NewSubscriptionHandler(service)
+    service := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+    handler := handlers.NewSubscriptionHandler(service, logger.Nop())
     
     router := gin.New()
     handler.RegisterRoutes(router)
@@ -129,4 +83,535 @@ func TestGetSubscriptionCost(t *testing.T) {
     router.ServeHTTP(w, req)
     
     assert.Equal(t, http.StatusOK, w.Code)
-}
\ No newline at end of file
+}
+
+func TestGetSubscriptionCostWithoutItems(t *testing.T) {
+    router := setupTestRouter()
+    
+    end := "08-2025"
+    for _, start := range []string{"07-2025", "08-2025"} {
+        jsonData, _ := json.Marshal(model.CreateSubscriptionRequest{
+            ServiceName: "Yandex Plus",
+            Price:       400,
+            UserID:      uuid.MustParse("60601fee-2bf1-4721-ae6f-7636e79a0cba"),
+            StartDate:   start,
+            EndDate:     &end,
+        })
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonData))
+        req.Header.Set("Content-Type", "application/json")
+        router.ServeHTTP(w, req)
+        assert.Equal(t, http.StatusCreated, w.Code)
+    }
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions/cost?user_id=60601fee-2bf1-4721-ae6f-7636e79a0cba&include_items=false", nil)
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusOK, w.Code)
+    var body map[string]interface{}
+    assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+    assert.NotContains(t, body, "subscriptions")
+    assert.EqualValues(t, 800, body["total_cost"])
+    assert.EqualValues(t, 2, body["subscription_count"])
+    assert.Equal(t, []interface{}{
+        map[string]interface{}{"month": "07-2025", "cost": 400.0, "subscription_count": 1.0},
+        map[string]interface{}{"month": "08-2025", "cost": 800.0, "subscription_count": 2.0},
+    }, body["months"])
+    
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/v1/subscriptions/cost?include_items=maybe", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestFilterAndGroupByLabels(t *testing.T) {
+    router := setupTestRouter()
+
+    for _, body := range []string{
+        `{"service_name": "AWS", "price": 2000, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "07-2025", "category": "cloud", "tags": ["infra", "Work"]}`,
+        `{"service_name": "Netflix", "price": 500, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "07-2025", "category": "entertainment", "tags": ["family"]}`,
+    } {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("POST", "/api/v1/subscriptions", strings.NewReader(body))
+        req.Header.Set("Content-Type", "application/json")
+        router.ServeHTTP(w, req)
+        assert.Equal(t, http.StatusCreated, w.Code)
+    }
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions?category=cloud&tag=infra,work", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+    var subscriptions []model.Subscription
+    assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &subscriptions))
+    if assert.Len(t, subscriptions, 1) {
+        assert.Equal(t, "AWS", subscriptions[0].ServiceName)
+        assert.Equal(t, []string{"infra", "work"}, subscriptions[0].Tags)
+    }
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/v1/subscriptions/cost?group_by=category&include_items=false", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+    var summary model.CostSummary
+    assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+    assert.Equal(t, []model.CostGroup{
+        {Key: "cloud", TotalCost: 2000, SubscriptionCount: 1},
+        {Key: "entertainment", TotalCost: 500, SubscriptionCount: 1},
+    }, summary.Groups)
+
+    for _, query := range []string{"/api/v1/subscriptions?category=games", "/api/v1/subscriptions/cost?group_by=price"} {
+        w = httptest.NewRecorder()
+        req, _ = http.NewRequest("GET", query, nil)
+        router.ServeHTTP(w, req)
+        assert.Equal(t, http.StatusBadRequest, w.Code, query)
+    }
+}
+
+func TestBatchSubscriptions(t *testing.T) {
+    router := setupTestRouter()
+    
+    userID := uuid.MustParse("60601fee-2bf1-4721-ae6f-7636e79a0cba")
+    batch := model.BatchRequest{
+        Operations: []model.BatchOperation{
+            {Op: model.BatchOpCreate, Subscription: &model.CreateSubscriptionRequest{
+                ServiceName: "Yandex Plus",
+                Price:       400,
+                UserID:      userID,
+                StartDate:   "07-2025",
+            }},
+        },
+    }
+    
+    jsonData, _ := json.Marshal(batch)
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("POST", "/api/v1/subscriptions:batch", bytes.NewBuffer(jsonData))
+    req.Header.Set("Content-Type", "application/json")
+    
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusOK, w.Code)
+    
+    var result model.BatchResponse
+    assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+    assert.Equal(t, model.BatchModeAtomic, result.Mode)
+    assert.Equal(t, 1, result.Succeeded)
+}
+
+func TestSubscriptionActionRoutes(t *testing.T) {
+    router := setupTestRouter()
+    
+    for _, path := range []string{"/api/v1/subscriptions:archive", "/api/v1/subscriptionsXYZ", "/api/v1/subscriptions:"} {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("POST", path, bytes.NewBufferString("{}"))
+        req.Header.Set("Content-Type", "application/json")
+        
+        router.ServeHTTP(w, req)
+        
+        assert.Equal(t, http.StatusNotFound, w.Code, path)
+    }
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("POST", "/api/v1/subscriptions:archive", bytes.NewBufferString("{}"))
+    router.ServeHTTP(w, req)
+    assert.JSONEq(t, `{"error": "Unknown action: archive"}`, w.Body.String())
+    
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("POST", "/api/v1/subscriptionsXYZ", bytes.NewBufferString("{}"))
+    router.ServeHTTP(w, req)
+    assert.Equal(t, "404 page not found", w.Body.String())
+}
+
+func TestImportSubscriptions(t *testing.T) {
+    router := setupTestRouter()
+    
+    csv := "service_name,price,user_id,start_date\n" +
+        "Yandex Plus,400,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025\n"
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("POST", "/api/v1/subscriptions/import", bytes.NewBufferString(csv))
+    req.Header.Set("Content-Type", "text/csv")
+    
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusCreated, w.Code)
+    
+    var report model.ImportReport
+    assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+    assert.Equal(t, 1, report.Imported)
+}
+
+func TestUploadsAreLimitedInSize(t *testing.T) {
+    router := setupTestRouter()
+    
+    uploads := map[string]string{
+        "/api/v1/subscriptions/import?dry_run=true": "service_name,price,user_id,start_date\n" +
+            strings.Repeat("Yandex Plus,400,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025\n", handlers.MaxUploadSize/60+1),
+        "/api/v1/users/60601fee-2bf1-4721-ae6f-7636e79a0cba/statements": "OFXHEADER:100\n" +
+            strings.Repeat(" ", handlers.MaxUploadSize),
+    }
+    for path, body := range uploads {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+        req.Header.Set("Content-Type", "text/plain")
+        
+        router.ServeHTTP(w, req)
+        
+        assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, path)
+        assert.Contains(t, w.Body.String(), "Request body is larger than", path)
+    }
+}
+
+func TestExportSubscriptionsCSV(t *testing.T) {
+    router := setupTestRouter()
+    
+    csv := "service_name,price,user_id,start_date\n" +
+        "Yandex Plus,400,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025\n"
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("POST", "/api/v1/subscriptions/import", bytes.NewBufferString(csv))
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusCreated, w.Code)
+    
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/v1/subscriptions/cost?format=csv", nil)
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusOK, w.Code)
+    assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+    lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+    assert.Len(t, lines, 3)
+    assert.Equal(t, "id,service_name,price,user_id,start_date,end_date,created_at,updated_at,category,tags", lines[0])
+    assert.Equal(t, ",TOTAL,400,,all time,,,,,", lines[2])
+}
+
+func TestExportSubscriptionsNDJSONViaAccept(t *testing.T) {
+    router := setupTestRouter()
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions", nil)
+    req.Header.Set("Accept", "application/x-ndjson")
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusOK, w.Code)
+    assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+    router := setupTestRouter()
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions?format=pdf", nil)
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCalendarFeed(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    userID := uuid.MustParse("60601fee-2bf1-4721-ae6f-7636e79a0cba")
+    endDate := "12-2025"
+    repo := repository.NewMemoryRepository()
+    repo.Create(context.Background(), &model.Subscription{
+        ServiceName: "Yandex Plus",
+        Price:       400,
+        UserID:      userID,
+        StartDate:   "07-2025",
+        EndDate:     &endDate,
+    })
+    
+    signer := calendar.NewTokenSigner("secret")
+    handler := handlers.NewCalendarHandler(service.NewSubscriptionService(repo, logger.Nop()), signer, logger.Nop())
+    router := gin.New()
+    handler.RegisterRoutes(router)
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/users/"+userID.String()+"/calendar.ics?token=wrong", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusUnauthorized, w.Code)
+    
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/v1/users/"+userID.String()+"/calendar.ics?token="+signer.Token(userID), nil)
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusOK, w.Code)
+    assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+    body := w.Body.String()
+    assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n"))
+    assert.Contains(t, body, "DTSTART;VALUE=DATE:20250701\r\n")
+    assert.Contains(t, body, "RRULE:FREQ=MONTHLY;UNTIL=20251201\r\n")
+    assert.Contains(t, body, "DTSTART;VALUE=DATE:20251231\r\n")
+
+    // Tokens are not handed out over the unauthenticated API
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/v1/users/"+userID.String()+"/calendar-token", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    var logs bytes.Buffer
+    log := logger.New("info", "json", &logs)
+    repo := repository.NewMemoryRepository()
+    repo.Create(context.Background(), &model.Subscription{ServiceName: "Yandex Plus", Price: 400, StartDate: "07-2025"})
+    handler := handlers.NewSubscriptionHandler(service.NewSubscriptionService(repo, logger.Nop()), log)
+    router := gin.New()
+    router.Use(middleware.RequestID(), middleware.Logger(log))
+    handler.RegisterRoutes(router)
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions/1", nil)
+    req.Header.Set("X-Request-ID", "gateway-123")
+    router.ServeHTTP(w, req)
+    
+    assert.Equal(t, http.StatusOK, w.Code)
+    assert.Equal(t, "gateway-123", w.Header().Get("X-Request-ID"))
+    
+    var entry map[string]interface{}
+    assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+    assert.Equal(t, "request", entry["msg"])
+    assert.Equal(t, "info", entry["level"])
+    assert.Equal(t, "gateway-123", entry["request_id"])
+    assert.Equal(t, "/api/v1/subscriptions/:id", entry["route"])
+    assert.Equal(t, float64(1), entry["subscription_id"])
+    assert.Equal(t, float64(200), entry["status"])
+    
+    // A missing or malformed ID is replaced with a generated one
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/v1/subscriptions", nil)
+    req.Header.Set("X-Request-ID", "bad id\n")
+    router.ServeHTTP(w, req)
+    _, err := uuid.Parse(w.Header().Get("X-Request-ID"))
+    assert.NoError(t, err)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    m := metrics.New()
+    userID := uuid.MustParse("60601fee-2bf1-4721-ae6f-7636e79a0cba")
+    ended := "02-2020"
+    cloud := "cloud"
+    repo := repository.NewMemoryRepository()
+    repo.Create(context.Background(), &model.Subscription{ServiceName: "Yandex Plus", Price: 400, UserID: userID, StartDate: "07-2020"})
+    repo.Create(context.Background(), &model.Subscription{ServiceName: "Kinopoisk", Price: 300, UserID: userID, StartDate: "01-2020", EndDate: &ended})
+    repo.Create(context.Background(), &model.Subscription{ServiceName: "Yandex Cloud", Price: 1500, UserID: uuid.New(), StartDate: "03-2021", Category: &cloud})
+    repo.Create(context.Background(), &model.Subscription{ServiceName: "Selectel", Price: 900, UserID: uuid.New(), StartDate: "05-2022", Category: &cloud})
+    svc := service.NewSubscriptionService(m.InstrumentRepository(repo), logger.Nop())
+    var months []string
+    m.Register(metrics.NewBusinessCollector(func(ctx context.Context, month string) ([]model.CostGroup, error) {
+        months = append(months, month)
+        summary, err := svc.CostSummary(ctx, model.SubscriptionFilter{Period: &month}, model.GroupByCategory)
+        if err != nil {
+            return nil, err
+        }
+        return summary.Groups, nil
+    }))
+    handler := handlers.NewSubscriptionHandler(svc, logger.Nop())
+    router := gin.New()
+    router.Use(m.Middleware())
+    handler.RegisterRoutes(router)
+    router.GET("/metrics", gin.WrapH(m.Handler()))
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions/1", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+    
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/metrics", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+    
+    body := w.Body.String()
+    assert.Contains(t, body, `subscription_service_http_requests_total{method="GET",route="/api/v1/subscriptions/:id",status="200"} 1`)
+    assert.Contains(t, body, `subscription_service_http_request_duration_seconds_count{method="GET",route="/api/v1/subscriptions/:id"} 1`)
+    assert.Contains(t, body, `subscription_service_repository_query_duration_seconds_count{method="GetByID",outcome="success"} 1`)
+    // Users are summed into categories, so the labels stay bounded
+    assert.Contains(t, body, `subscription_service_active_subscriptions{category="none"} 1`)
+    assert.Contains(t, body, `subscription_service_monthly_recurring_cost_rubles{category="none"} 400`)
+    assert.Contains(t, body, `subscription_service_active_subscriptions{category="cloud"} 2`)
+    assert.Contains(t, body, `subscription_service_monthly_recurring_cost_rubles{category="cloud"} 2400`)
+    assert.NotContains(t, body, userID.String())
+    assert.Equal(t, []string{time.Now().Format("01-2006")}, months)
+    assert.Contains(t, body, "go_goroutines")
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    _, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: "none"}, "subscription-service", "test")
+    assert.NoError(t, err)
+    recorder := tracetest.NewSpanRecorder()
+    previous := otel.GetTracerProvider()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+    defer otel.SetTracerProvider(previous)
+    
+    var logs bytes.Buffer
+    log := logger.New("info", "json", &logs)
+    repo := repository.NewMemoryRepository()
+    repo.Create(context.Background(), &model.Subscription{ServiceName: "Yandex Plus", Price: 400, StartDate: "07-2025"})
+    handler := handlers.NewSubscriptionHandler(service.NewSubscriptionService(repo, logger.Nop()), log)
+    router := gin.New()
+    router.Use(middleware.RequestID(), middleware.Tracing(), middleware.Logger(log))
+    handler.RegisterRoutes(router)
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions/1", nil)
+    req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+    
+    spans := recorder.Ended()
+    assert.Len(t, spans, 2)
+    byName := map[string]sdktrace.ReadOnlySpan{}
+    for _, span := range spans {
+        assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+        byName[span.Name()] = span
+    }
+    server, svc := byName["GET /api/v1/subscriptions/:id"], byName["SubscriptionService.GetByID"]
+    if assert.NotNil(t, server) && assert.NotNil(t, svc) {
+        assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+        assert.True(t, server.Parent().IsRemote())
+        assert.Equal(t, server.SpanContext().SpanID(), svc.Parent().SpanID())
+    }
+    
+    var entry map[string]interface{}
+    assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+    assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+}
+
+// stalledRepo simulates a hung database: reads block until the context ends
+type stalledRepo struct {
+    repository.SubscriptionRepository
+    timeout time.Duration
+}
+
+func (m *stalledRepo) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
+    select {
+    case <-time.After(m.timeout):
+        return nil, fmt.Errorf("failed to get subscription: %w", repository.ErrQueryTimeout)
+    case <-ctx.Done():
+        return nil, fmt.Errorf("failed to get subscription: %w", ctx.Err())
+    }
+}
+
+func TestQueryTimeoutAndClientCancellation(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    repo := &stalledRepo{SubscriptionRepository: repository.NewMemoryRepository(), timeout: 10 * time.Millisecond}
+    handler := handlers.NewSubscriptionHandler(service.NewSubscriptionService(repo, logger.Nop()), logger.Nop())
+    router := gin.New()
+    handler.RegisterRoutes(router)
+    
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions/1", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+    assert.Contains(t, w.Body.String(), "Request timed out")
+    
+    // A client that goes away cancels the query instead of waiting for the timeout
+    repo.timeout = time.Minute
+    ctx, cancel := context.WithCancel(context.Background())
+    time.AfterFunc(10*time.Millisecond, cancel)
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequestWithContext(ctx, "GET", "/api/v1/subscriptions/1", nil)
+    start := time.Now()
+    router.ServeHTTP(w, req)
+    assert.Equal(t, 499, w.Code)
+    assert.Less(t, time.Since(start), time.Second)
+}
+
+// brokenRepo simulates a database that rejects every listing and cost report
+type brokenRepo struct {
+    repository.SubscriptionRepository
+}
+
+func (m *brokenRepo) GetByFilters(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+    return nil, errors.New("failed to get subscriptions: connection refused")
+}
+
+func (m *brokenRepo) WithSnapshot(ctx context.Context, fn func(repository.SubscriptionRepository) error) error {
+    return fn(m)
+}
+
+func (m *brokenRepo) SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (*model.CostSummary, error) {
+    return nil, errors.New("failed to calculate cost: connection refused")
+}
+
+func TestListingFailuresAreServerErrors(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    var logs bytes.Buffer
+    log := logger.New("info", "json", &logs)
+    repo := &brokenRepo{SubscriptionRepository: repository.NewMemoryRepository()}
+    handler := handlers.NewSubscriptionHandler(service.NewSubscriptionService(repo, logger.Nop()), log)
+    router := gin.New()
+    handler.RegisterRoutes(router)
+    
+    for _, query := range []string{"/api/v1/subscriptions", "/api/v1/subscriptions/cost", "/api/v1/subscriptions/cost?include_items=false"} {
+        logs.Reset()
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", query, nil)
+        router.ServeHTTP(w, req)
+        assert.Equal(t, http.StatusInternalServerError, w.Code, query)
+        assert.Contains(t, logs.String(), "connection refused", query)
+    }
+    
+    // Invalid filters are still the client's fault and are not logged as failures
+    logs.Reset()
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/v1/subscriptions?period=2025-07", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusBadRequest, w.Code)
+    assert.Contains(t, w.Body.String(), "period must be in MM-YYYY format")
+    assert.Empty(t, logs.String())
+}
+
+func TestHealthProbes(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    
+    dbErr := error(nil)
+    checker := health.NewChecker(time.Second)
+    checker.Register("database", true, func(context.Context) error { return dbErr })
+    checker.Register("cache", false, func(context.Context) error { return fmt.Errorf("cache unavailable") })
+    router := gin.New()
+    handlers.NewHealthHandler(checker, logger.Nop()).RegisterRoutes(router)
+    
+    readyz := func() (int, health.Report) {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", "/readyz", nil)
+        router.ServeHTTP(w, req)
+        var report health.Report
+        assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+        return w.Code, report
+    }
+    
+    code, report := readyz()
+    assert.Equal(t, http.StatusOK, code)
+    assert.Equal(t, health.StatusDegraded, report.Status)
+    assert.Equal(t, "cache unavailable", report.Checks["cache"].Error)
+    
+    // Liveness does not depend on the database
+    dbErr = fmt.Errorf("connection refused")
+    code, report = readyz()
+    assert.Equal(t, http.StatusServiceUnavailable, code)
+    assert.Equal(t, health.StatusNotReady, report.Status)
+    for _, path := range []string{"/livez", "/health"} {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", path, nil)
+        router.ServeHTTP(w, req)
+        assert.Equal(t, http.StatusOK, w.Code)
+        assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+    }
+    
+    dbErr = nil
+    checker.SetDraining()
+    code, report = readyz()
+    assert.Equal(t, http.StatusServiceUnavailable, code)
+    assert.Equal(t, health.StatusDraining, report.Status)
+}
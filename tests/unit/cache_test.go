@@ -0,0 +1,228 @@
+package unit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subscription-service/internal/cache"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+)
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStore(2)
+	require.NoError(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", []byte("2"), time.Minute))
+	_, ok, _ := store.Get(ctx, "a")
+	assert.True(t, ok)
+
+	require.NoError(t, store.Set(ctx, "c", []byte("3"), time.Minute))
+	assert.Equal(t, 2, store.Len())
+	_, ok, _ = store.Get(ctx, "b")
+	assert.False(t, ok, "b was used least recently")
+	value, ok, _ := store.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestMemoryStoreExpiresValues(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStore(10)
+	require.NoError(t, store.Set(ctx, "a", []byte("1"), 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, ok, _ := store.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestMemoryStoreGenerationsSurviveEviction(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStore(1)
+	require.NoError(t, store.Bump(ctx, "user", "user", "all"))
+	require.NoError(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", []byte("2"), time.Minute))
+
+	generation, err := store.Generation(ctx, "user")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, generation)
+	generation, err = store.Generation(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Zero(t, generation)
+}
+
+// failingStore is a cache store whose backend is down
+type failingStore struct{}
+
+func (failingStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Generation(context.Context, string) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (failingStore) Bump(context.Context, ...string) error {
+	return errors.New("connection refused")
+}
+
+func newCachedService(store cache.Store) (*service.SubscriptionService, *cache.CostCache) {
+	svc := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+	costs := cache.NewCostCache(store, time.Minute, logger.Nop())
+	svc.UseCostCache(costs)
+	return svc, costs
+}
+
+func createFor(t *testing.T, svc *service.SubscriptionService, userID uuid.UUID, price int) *model.Subscription {
+	t.Helper()
+	sub, err := svc.Create(context.Background(), &model.CreateSubscriptionRequest{
+		ServiceName: "Yandex Plus",
+		Price:       price,
+		UserID:      userID,
+		StartDate:   "07-2025",
+	})
+	require.NoError(t, err)
+	return sub
+}
+
+func TestCostCacheServesRepeatedReports(t *testing.T) {
+	ctx := context.Background()
+	svc, costs := newCachedService(cache.NewMemoryStore(100))
+	user := uuid.New()
+	createFor(t, svc, user, 400)
+
+	first, err := svc.CalculateTotalCost(ctx, model.SubscriptionFilter{UserID: &user}, "")
+	require.NoError(t, err)
+	second, err := svc.CalculateTotalCost(ctx, model.SubscriptionFilter{UserID: &user}, "")
+	require.NoError(t, err)
+	assert.Equal(t, first.CostSummary, second.CostSummary)
+	if assert.Len(t, second.Items, 1) {
+		assert.Equal(t, first.Items[0].ID, second.Items[0].ID)
+		assert.True(t, first.Items[0].CreatedAt.Equal(second.Items[0].CreatedAt))
+	}
+	assert.EqualValues(t, 1, costs.Misses())
+	assert.EqualValues(t, 1, costs.Hits())
+
+	// Reports with and without items are cached separately
+	summary, err := svc.CostSummary(ctx, model.SubscriptionFilter{UserID: &user}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 400, summary.TotalCost)
+	assert.EqualValues(t, 2, costs.Misses())
+}
+
+func TestCostCacheInvalidatesAffectedUsers(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newCachedService(cache.NewMemoryStore(100))
+	user, other := uuid.New(), uuid.New()
+	sub := createFor(t, svc, user, 400)
+	createFor(t, svc, other, 100)
+
+	total := func(userID *uuid.UUID) int {
+		t.Helper()
+		summary, err := svc.CostSummary(ctx, model.SubscriptionFilter{UserID: userID}, "")
+		require.NoError(t, err)
+		return summary.TotalCost
+	}
+	assert.Equal(t, 400, total(&user))
+	assert.Equal(t, 100, total(&other))
+	assert.Equal(t, 500, total(nil))
+
+	createFor(t, svc, user, 200)
+	assert.Equal(t, 600, total(&user))
+	assert.Equal(t, 700, total(nil), "reports across users include every user")
+
+	// Moving a subscription to another user changes both users' reports
+	sub.UserID = other
+	require.NoError(t, svc.Update(ctx, sub))
+	assert.Equal(t, 200, total(&user))
+	assert.Equal(t, 500, total(&other))
+
+	require.NoError(t, svc.Delete(ctx, sub.ID))
+	assert.Equal(t, 100, total(&other))
+	assert.Equal(t, 300, total(nil))
+}
+
+func TestCostCacheInvalidatesOnBatch(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newCachedService(cache.NewMemoryStore(100))
+	user := uuid.New()
+	sub := createFor(t, svc, user, 400)
+
+	summary, err := svc.CostSummary(ctx, model.SubscriptionFilter{UserID: &user}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 400, summary.TotalCost)
+
+	resp, err := svc.Batch(ctx, &model.BatchRequest{Operations: []model.BatchOperation{
+		{Op: model.BatchOpDelete, ID: sub.ID},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.Succeeded)
+
+	summary, err = svc.CostSummary(ctx, model.SubscriptionFilter{UserID: &user}, "")
+	require.NoError(t, err)
+	assert.Zero(t, summary.TotalCost)
+}
+
+func TestCostCacheFallsBackWhenStoreFails(t *testing.T) {
+	ctx := context.Background()
+	svc, costs := newCachedService(failingStore{})
+	user := uuid.New()
+	createFor(t, svc, user, 400)
+
+	summary, err := svc.CostSummary(ctx, model.SubscriptionFilter{UserID: &user}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 400, summary.TotalCost)
+	assert.Zero(t, costs.Hits())
+	assert.NotZero(t, costs.Errors())
+}
+
+// replicaProbeRepository records on which database each cost report was read: its probe repository
+// returns one row from the primary and three from the replica
+type replicaProbeRepository struct {
+	repository.SubscriptionRepository
+	probe repository.SubscriptionRepository
+	rows  []int
+}
+
+func (r *replicaProbeRepository) SummarizeCost(ctx context.Context, filter model.SubscriptionFilter, groupBy string) (*model.CostSummary, error) {
+	all, err := r.probe.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.rows = append(r.rows, len(all))
+	return r.SubscriptionRepository.SummarizeCost(ctx, filter, groupBy)
+}
+
+func TestCachedCostReportsSkipReplica(t *testing.T) {
+	primary := sql.OpenDB(&slowConnector{rows: 1})
+	defer primary.Close()
+	replica := &fakeReplica{db: sql.OpenDB(&slowConnector{rows: 3}), usable: true}
+	defer replica.db.Close()
+	repo := &replicaProbeRepository{
+		SubscriptionRepository: repository.NewMemoryRepository(),
+		probe:                  repository.NewPostgresRepositoryWithReplica(primary, replica, logger.Nop(), time.Second),
+	}
+	svc := service.NewSubscriptionService(repo, logger.Nop())
+	ctx := context.Background()
+
+	// Without the cache a report lives as long as the request and may lag behind
+	_, err := svc.CostSummary(ctx, model.SubscriptionFilter{}, "")
+	require.NoError(t, err)
+	svc.UseCostCache(cache.NewCostCache(cache.NewMemoryStore(100), time.Minute, logger.Nop()))
+	_, err = svc.CostSummary(ctx, model.SubscriptionFilter{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 1}, repo.rows)
+}
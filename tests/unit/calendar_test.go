@@ -0,0 +1,115 @@
+package unit
+
+import (
+	"bytes"
+	"strings"
+	"subscription-service/internal/calendar"
+	"subscription-service/internal/model"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFeed renders a feed and returns its physical lines, checking that each ends with CRLF
+// and fits in 75 octets
+func writeFeed(t *testing.T, name string, subscriptions ...model.Subscription) []string {
+	var buf bytes.Buffer
+	require.NoError(t, calendar.WriteFeed(&buf, name, subscriptions))
+	body := buf.String()
+	require.True(t, strings.HasSuffix(body, "\r\n"))
+
+	lines := strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n")
+	for _, line := range lines {
+		assert.NotContains(t, line, "\n")
+		assert.LessOrEqual(t, len(line), 75, line)
+		assert.True(t, utf8.ValidString(line), "line %q splits a UTF-8 sequence", line)
+	}
+	return lines
+}
+
+// unfold joins folded continuation lines back into content lines
+func unfold(lines []string) []string {
+	var unfolded []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, " ") && len(unfolded) > 0 {
+			unfolded[len(unfolded)-1] += line[1:]
+			continue
+		}
+		unfolded = append(unfolded, line)
+	}
+	return unfolded
+}
+
+func feedSubscription(name string) model.Subscription {
+	return model.Subscription{
+		ID:          7,
+		ServiceName: name,
+		Price:       400,
+		StartDate:   "07-2025",
+		UpdatedAt:   time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWriteFeedEscapesText(t *testing.T) {
+	lines := unfold(writeFeed(t, "Renewals, 2025;\nall", feedSubscription(`Tom, Jerry; C:\Games`)))
+
+	assert.Contains(t, lines, `X-WR-CALNAME:Renewals\, 2025\;\nall`)
+	assert.Contains(t, lines, `SUMMARY:Tom\, Jerry\; C:\\Games renewal (400 ₽)`)
+	// Property parameters and rules are not TEXT and keep their separators
+	assert.Contains(t, lines, "RRULE:FREQ=MONTHLY")
+	assert.Contains(t, lines, "DTSTART;VALUE=DATE:20250701")
+}
+
+func TestWriteFeedFoldsLongLines(t *testing.T) {
+	name := strings.TrimSpace(strings.Repeat("Streaming ", 20))
+	lines := writeFeed(t, "Renewals", feedSubscription(name))
+
+	var folded int
+	for _, line := range lines {
+		if strings.HasPrefix(line, " ") {
+			folded++
+		}
+	}
+	assert.Greater(t, folded, 1)
+	// Every physical line is filled up to the limit before a fold, less the octets of a character
+	// that does not fit, such as the three of "₽"
+	for i, line := range lines[:len(lines)-1] {
+		if strings.HasPrefix(lines[i+1], " ") {
+			assert.GreaterOrEqual(t, len(line), 73, line)
+		}
+	}
+	assert.Contains(t, unfold(lines), "SUMMARY:"+name+" renewal (400 ₽)")
+}
+
+func TestWriteFeedFoldsBetweenMultiByteCharacters(t *testing.T) {
+	// Two-byte letters after the odd-length "SUMMARY:" put a character across octet 75
+	name := strings.Repeat("Кинопоиск", 8)
+	lines := writeFeed(t, "Renewals", feedSubscription(name))
+
+	var shortened bool
+	for i, line := range lines[:len(lines)-1] {
+		if strings.HasPrefix(lines[i+1], " ") && len(line) < 75 {
+			shortened = true
+		}
+	}
+	assert.True(t, shortened, "no fold was moved back to a character boundary")
+	assert.Contains(t, unfold(lines), "SUMMARY:"+name+" renewal (400 ₽)")
+}
+
+func TestWriteFeedAddsEndEvent(t *testing.T) {
+	sub := feedSubscription("Yandex Plus")
+	endDate := "02-2024"
+	sub.StartDate = "11-2023"
+	sub.EndDate = &endDate
+
+	lines := unfold(writeFeed(t, "Renewals", sub))
+
+	assert.Contains(t, lines, "RRULE:FREQ=MONTHLY;UNTIL=20240201")
+	assert.Contains(t, lines, "UID:subscription-7-end@subscription-service")
+	assert.Contains(t, lines, "DTSTART;VALUE=DATE:20240229")
+	assert.Contains(t, lines, "DTEND;VALUE=DATE:20240301")
+	assert.Contains(t, lines, "SUMMARY:Yandex Plus subscription ends")
+}
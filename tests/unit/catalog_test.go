@@ -0,0 +1,253 @@
+package unit
+
+import (
+	"context"
+	"subscription-service/internal/cache"
+	"subscription-service/internal/catalog"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCatalog = []model.Service{
+	{ID: 1, Name: "Yandex Plus", Aliases: []string{"Кинопоиск"}},
+	{ID: 2, Name: "Netflix"},
+	{ID: 3, Name: "Hulu"},
+	{ID: 4, Name: "Spotify Premium"},
+	{ID: 5, Name: "Spotify Premier"},
+}
+
+func TestNormalizeFoldsCaseAndSpaces(t *testing.T) {
+	assert.Equal(t, "yandex plus", catalog.Normalize("  Yandex   PLUS "))
+	assert.Equal(t, "яндекс плюс", catalog.Normalize("Яндекс\tПлюс"))
+	assert.Equal(t, "", catalog.Normalize("   "))
+}
+
+func TestMatchFindsSpellingsOfAService(t *testing.T) {
+	for name, id := range map[string]int{
+		"Yandex Plus":  1,
+		"yandex  plus": 1,
+		"Яндекс Плюс":  1,
+		"Yandex.Plus":  1,
+		"Yandeks Plus": 1,
+		"кинопоиск":    1,
+		"Netflx":       2,
+	} {
+		service, ok := catalog.Match(name, testCatalog)
+		if assert.True(t, ok, name) {
+			assert.Equal(t, id, service.ID, name)
+		}
+	}
+}
+
+func TestMatchRejectsDistantShortAndAmbiguousNames(t *testing.T) {
+	for _, name := range []string{"", "YouTube Premium", "Lulu", "Spotify Premi", "Netfl"} {
+		_, ok := catalog.Match(name, testCatalog)
+		assert.False(t, ok, name)
+	}
+
+	service, ok := catalog.Match("hulu", testCatalog)
+	assert.True(t, ok)
+	assert.Equal(t, 3, service.ID)
+}
+
+func TestConflictComparesFoldedNamesAndAliases(t *testing.T) {
+	assert.Equal(t, "yandex-plus", catalog.Conflict(model.Service{Name: "yandex-plus"}, testCatalog))
+	assert.Equal(t, "KinoPoisk", catalog.Conflict(model.Service{Name: "Kinopoisk HD", Aliases: []string{"KinoPoisk"}}, testCatalog))
+	assert.Equal(t, "", catalog.Conflict(model.Service{Name: "Kinopoisk HD"}, testCatalog))
+	// An entry does not conflict with itself
+	assert.Equal(t, "", catalog.Conflict(model.Service{ID: 2, Name: "NETFLIX"}, testCatalog))
+}
+
+func TestSeedGroupsSpellingsLikeMatch(t *testing.T) {
+	existing := []model.Service{{ID: 1, Name: "Netflix"}}
+	names := []string{" yandex plus ", "Yandex Plus", "Яндекс Плюс", "Yandex.Plus", "Netflx", "Okko", "okko", "OKKO"}
+	added := catalog.Seed(existing, names)
+
+	seeded := make([]string, len(added))
+	for i, service := range added {
+		seeded[i] = service.Name
+	}
+	// Spellings of the most used name and of existing entries get no entry of their own
+	assert.Equal(t, []string{"yandex plus", "Okko"}, seeded)
+
+	services := append([]model.Service{}, existing...)
+	for i, service := range added {
+		service.ID = len(existing) + i + 1
+		services = append(services, service)
+	}
+	for _, service := range services {
+		assert.Equal(t, "", catalog.Conflict(service, services), service.Name)
+	}
+	for _, name := range names {
+		_, ok := catalog.Match(name, services)
+		assert.True(t, ok, name)
+	}
+}
+
+func newCatalogServices(t *testing.T) (*service.SubscriptionService, *service.CatalogService) {
+	subscriptions := repository.NewMemoryRepository()
+	catalogService := service.NewCatalogService(repository.NewMemoryServiceRepository(subscriptions), logger.Nop())
+	subscriptionService := service.NewSubscriptionService(subscriptions, logger.Nop())
+	subscriptionService.UseCatalog(catalogService)
+	return subscriptionService, catalogService
+}
+
+func TestCreateLinksSpellingsToTheCatalogName(t *testing.T) {
+	subscriptionService, catalogService := newCatalogServices(t)
+	ctx := context.Background()
+	plus, err := catalogService.Create(ctx, &model.ServiceRequest{Name: "Yandex Plus", Aliases: []string{"Яндекс Плюс"}})
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	for _, name := range []string{"yandex  plus", "Яндекс Плюс", "Yandex Plis"} {
+		sub, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+			ServiceName: name, Price: 300, UserID: userID, StartDate: "07-2025",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Yandex Plus", sub.ServiceName, name)
+		if assert.NotNil(t, sub.ServiceID, name) {
+			assert.Equal(t, plus.ID, *sub.ServiceID)
+		}
+	}
+	other, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+		ServiceName: "Netflix", Price: 500, UserID: userID, StartDate: "07-2025",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Netflix", other.ServiceName)
+	assert.Nil(t, other.ServiceID)
+
+	// A report asked for under any spelling covers the whole service
+	spelling := "YANDEX PLUS"
+	result, err := subscriptionService.CalculateTotalCost(ctx, model.SubscriptionFilter{UserID: &userID, ServiceName: &spelling}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 900, result.TotalCost)
+	assert.Len(t, result.Items, 3)
+}
+
+func TestNewEntryLinksExistingSubscriptions(t *testing.T) {
+	subscriptionService, catalogService := newCatalogServices(t)
+	subscriptionService.UseCostCache(cache.NewCostCache(cache.NewMemoryStore(100), time.Minute, logger.Nop()))
+	ctx := context.Background()
+	userID := uuid.New()
+	for _, name := range []string{"yandex plus", "Яндекс Плюс"} {
+		_, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+			ServiceName: name, Price: 300, UserID: userID, StartDate: "07-2025",
+		})
+		require.NoError(t, err)
+	}
+	spelling := "Yandex Plus"
+	filter := model.SubscriptionFilter{UserID: &userID, ServiceName: &spelling}
+	_, err := subscriptionService.CalculateTotalCost(ctx, filter, "")
+	require.NoError(t, err)
+
+	// Subscriptions written before the entry existed are linked and the cached report is dropped
+	_, err = catalogService.Create(ctx, &model.ServiceRequest{Name: "Yandex Plus"})
+	require.NoError(t, err)
+	result, err := subscriptionService.CalculateTotalCost(ctx, filter, "")
+	require.NoError(t, err)
+	assert.Equal(t, 600, result.TotalCost)
+	assert.Len(t, result.Items, 2)
+}
+
+func TestRenameKeepsTheOldNameAsAnAlias(t *testing.T) {
+	subscriptionService, catalogService := newCatalogServices(t)
+	ctx := context.Background()
+	plus, err := catalogService.Create(ctx, &model.ServiceRequest{Name: "Yandex Plus"})
+	require.NoError(t, err)
+	sub, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+		ServiceName: "Yandex Plus", Price: 300, UserID: uuid.New(), StartDate: "07-2025",
+	})
+	require.NoError(t, err)
+
+	renamed, err := catalogService.Update(ctx, plus.ID, &model.ServiceRequest{Name: "Yandex Plus Multi"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Yandex Plus"}, renamed.Aliases)
+
+	got, err := subscriptionService.GetByID(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Yandex Plus Multi", got.ServiceName)
+
+	// The old name still links new subscriptions
+	again, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+		ServiceName: "yandex plus", Price: 300, UserID: uuid.New(), StartDate: "07-2025",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Yandex Plus Multi", again.ServiceName)
+}
+
+// countingServiceRepository counts how often the whole catalog is read
+type countingServiceRepository struct {
+	repository.ServiceRepository
+	lists int
+}
+
+func (r *countingServiceRepository) List(ctx context.Context) ([]model.Service, error) {
+	r.lists++
+	return r.ServiceRepository.List(ctx)
+}
+
+func TestCatalogIsReadAgainOnlyAfterWrites(t *testing.T) {
+	subscriptions := repository.NewMemoryRepository()
+	services := &countingServiceRepository{ServiceRepository: repository.NewMemoryServiceRepository(subscriptions)}
+	catalogService := service.NewCatalogService(services, logger.Nop())
+	subscriptionService := service.NewSubscriptionService(subscriptions, logger.Nop())
+	subscriptionService.UseCatalog(catalogService)
+	subscriptionService.UseCostCache(cache.NewCostCache(cache.NewMemoryStore(100), time.Minute, logger.Nop()))
+	ctx := context.Background()
+	plus, err := catalogService.Create(ctx, &model.ServiceRequest{Name: "Yandex Plus"})
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	spelling := "yandex plus"
+	filter := model.SubscriptionFilter{UserID: &userID, ServiceName: &spelling}
+	for i := 0; i < 3; i++ {
+		_, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+			ServiceName: spelling, Price: 300, UserID: userID, StartDate: "07-2025",
+		})
+		require.NoError(t, err)
+		_, err = subscriptionService.CalculateTotalCost(ctx, filter, "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, services.lists)
+
+	// A write drops the kept catalog, so the next request sees the new name
+	_, err = catalogService.Update(ctx, plus.ID, &model.ServiceRequest{Name: "Yandex Plus Multi"})
+	require.NoError(t, err)
+	result, err := subscriptionService.CalculateTotalCost(ctx, filter, "")
+	require.NoError(t, err)
+	assert.Equal(t, 900, result.TotalCost)
+	assert.Equal(t, "Yandex Plus Multi", *result.Service)
+	assert.Equal(t, 2, services.lists)
+}
+
+func TestCatalogServiceValidatesRequests(t *testing.T) {
+	_, catalogService := newCatalogServices(t)
+	ctx := context.Background()
+	price := 0
+
+	_, err := catalogService.Create(ctx, &model.ServiceRequest{Name: "  "})
+	assert.EqualError(t, err, "name is required")
+	_, err = catalogService.Create(ctx, &model.ServiceRequest{Name: "Netflix", Website: "netflix.com"})
+	assert.EqualError(t, err, "website must be an http or https URL")
+	_, err = catalogService.Create(ctx, &model.ServiceRequest{Name: "Netflix", DefaultPrice: &price})
+	assert.EqualError(t, err, "default_price must be greater than 0")
+	// Catalog categories come from the same closed set as subscription categories
+	_, err = catalogService.Create(ctx, &model.ServiceRequest{Name: "Netflix", Category: "Streaming"})
+	assert.EqualError(t, err, "category must be one of entertainment, dev_tools, cloud, education")
+	cloud, err := catalogService.Create(ctx, &model.ServiceRequest{Name: "Yandex Cloud", Category: " Cloud "})
+	require.NoError(t, err)
+	assert.Equal(t, model.CategoryCloud, cloud.Category)
+
+	created, err := catalogService.Create(ctx, &model.ServiceRequest{Name: " Netflix ", Aliases: []string{"netflix", "Нетфликс", "нетфликс"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Netflix", created.Name)
+	assert.Equal(t, []string{"Нетфликс"}, created.Aliases)
+}
@@ -0,0 +1,170 @@
+package unit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"subscription-service/internal/database"
+	"subscription-service/internal/logger"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyConnector refuses connections while down is set, or for the first failures attempts
+type flakyConnector struct {
+	down     atomic.Bool
+	failures atomic.Int32
+	attempts atomic.Int32
+}
+
+func (c *flakyConnector) Connect(context.Context) (driver.Conn, error) {
+	c.attempts.Add(1)
+	if c.down.Load() || c.failures.Add(-1) >= 0 {
+		return nil, errors.New("connection refused")
+	}
+	return &slowConn{&slowConnector{}}, nil
+}
+
+func (c *flakyConnector) Driver() driver.Driver { return slowDriver{&slowConnector{}} }
+
+func TestConnectRetriesUntilDatabaseAnswers(t *testing.T) {
+	connector := &flakyConnector{}
+	connector.failures.Store(2)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	err := database.Connect(context.Background(), db, 10*time.Second, logger.Nop())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), connector.attempts.Load())
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	connector := &flakyConnector{}
+	connector.down.Store(true)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	start := time.Now()
+	err := database.Connect(context.Background(), db, 300*time.Millisecond, logger.Nop())
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Greater(t, connector.attempts.Load(), int32(1))
+}
+
+func TestMonitorReportsOutageAndReconnect(t *testing.T) {
+	connector := &flakyConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	// Every ping needs a fresh connection, so outages are seen immediately
+	db.SetMaxIdleConns(0)
+	monitor := database.NewMonitor(db, logger.Nop())
+
+	assert.NoError(t, monitor.Ping(context.Background()))
+	assert.True(t, monitor.Up())
+
+	connector.down.Store(true)
+	err := monitor.Ping(context.Background())
+	assert.ErrorContains(t, err, "unreachable for")
+	assert.False(t, monitor.Up())
+
+	// A caller that gives up does not change the recorded state
+	connector.down.Store(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, monitor.Ping(ctx))
+	assert.False(t, monitor.Up())
+	assert.Equal(t, uint64(0), monitor.Reconnects())
+
+	assert.NoError(t, monitor.Ping(context.Background()))
+	assert.True(t, monitor.Up())
+	assert.Equal(t, uint64(1), monitor.Reconnects())
+}
+
+// lagConnector answers every query with a single value, the replication lag in seconds,
+// and refuses connections while down is set
+type lagConnector struct {
+	lag  atomic.Int64
+	down atomic.Bool
+}
+
+func (c *lagConnector) Connect(context.Context) (driver.Conn, error) {
+	if c.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return &lagConn{c}, nil
+}
+
+func (c *lagConnector) Driver() driver.Driver { return slowDriver{&slowConnector{}} }
+
+type lagConn struct{ c *lagConnector }
+
+func (c *lagConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *lagConn) Close() error                        { return nil }
+func (c *lagConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *lagConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &lagRows{seconds: float64(c.c.lag.Load())}, nil
+}
+
+type lagRows struct {
+	seconds float64
+	done    bool
+}
+
+func (r *lagRows) Columns() []string { return []string{"lag"} }
+func (r *lagRows) Close() error      { return nil }
+func (r *lagRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.seconds
+	return nil
+}
+
+func TestReplicaUsableWhileCloseToPrimary(t *testing.T) {
+	connector := &lagConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxIdleConns(0)
+	replica := database.NewReplica(db, 5*time.Second, logger.Nop())
+
+	// Reads stay on the primary until the replica has been checked
+	assert.False(t, replica.Usable())
+
+	connector.lag.Store(1)
+	assert.NoError(t, replica.Check(context.Background()))
+	assert.True(t, replica.Usable())
+	assert.Equal(t, time.Second, replica.Lag())
+
+	connector.lag.Store(30)
+	assert.ErrorContains(t, replica.Check(context.Background()), "30s behind the primary, more than 5s")
+	assert.False(t, replica.Usable())
+	assert.Equal(t, 30*time.Second, replica.Lag())
+
+	connector.lag.Store(0)
+	assert.NoError(t, replica.Check(context.Background()))
+	assert.True(t, replica.Usable())
+
+	connector.down.Store(true)
+	assert.ErrorContains(t, replica.Check(context.Background()), "connection refused")
+	assert.False(t, replica.Usable())
+}
+
+func TestReplicaFailedQueryStopsUseUntilNextCheck(t *testing.T) {
+	db := sql.OpenDB(&lagConnector{})
+	defer db.Close()
+	replica := database.NewReplica(db, time.Second, logger.Nop())
+	assert.NoError(t, replica.Check(context.Background()))
+
+	replica.Failed(errors.New("connection reset by peer"))
+	assert.False(t, replica.Usable())
+
+	assert.NoError(t, replica.Check(context.Background()))
+	assert.True(t, replica.Usable())
+}
@@ -0,0 +1,79 @@
+package unit
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"subscription-service/internal/export"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readXLSX returns the parts of an XLSX archive by name
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		body, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		parts[f.Name] = string(body)
+	}
+	return parts
+}
+
+func TestXLSXWriterProducesWorkbook(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatXLSX, &buf, []string{"service_name", "price", "end_date"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow([]interface{}{`<Tom & "Jerry">`, 400, nil}))
+	require.NoError(t, w.Close())
+
+	parts := readXLSX(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		assert.Contains(t, parts, name)
+		assert.NoError(t, xml.Unmarshal([]byte(parts[name]), new(interface{})), name)
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<row r="1"><c r="A1" t="inlineStr"><is><t>service_name</t></is></c>`+
+		`<c r="B1" t="inlineStr"><is><t>price</t></is></c><c r="C1" t="inlineStr"><is><t>end_date</t></is></c></row>`)
+	// Strings are escaped, ints are numeric cells and nil leaves the cell out
+	assert.Contains(t, sheet, `<row r="2"><c r="A2" t="inlineStr"><is><t>&lt;Tom &amp; &#34;Jerry&#34;&gt;</t></is></c>`+
+		`<c r="B2"><v>400</v></c></row>`)
+
+	var worksheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(sheet), &worksheet))
+	require.Len(t, worksheet.Rows, 2)
+	assert.Equal(t, `<Tom & "Jerry">`, worksheet.Rows[1].Cells[0].Inline)
+}
+
+func TestXLSXWriterNamesColumnsPastZ(t *testing.T) {
+	columns := make([]string, 703)
+	for i := range columns {
+		columns[i] = fmt.Sprint("column", i)
+	}
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatXLSX, &buf, columns)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	sheet := readXLSX(t, buf.Bytes())["xl/worksheets/sheet1.xml"]
+	for ref, column := range map[string]int{"Z1": 25, "AA1": 26, "AZ1": 51, "BA1": 52, "ZZ1": 701, "AAA1": 702} {
+		assert.Contains(t, sheet, fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t>column%d</t></is></c>`, ref, column))
+	}
+}
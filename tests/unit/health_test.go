@@ -0,0 +1,78 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"subscription-service/db/migrations"
+	"subscription-service/internal/health"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func healthyCheck(context.Context) error { return nil }
+
+func failingCheck(context.Context) error { return errors.New("connection refused") }
+
+func TestCheckerCriticalAndOptional(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Register("database", true, healthyCheck)
+	checker.Register("cache", false, failingCheck)
+
+	report := checker.Evaluate(context.Background())
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.True(t, report.Ready())
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, health.StatusFail, report.Checks["cache"].Status)
+	assert.Equal(t, "connection refused", report.Checks["cache"].Error)
+	assert.False(t, report.Checks["cache"].Critical)
+
+	checker.Register("migrations", true, failingCheck)
+	report = checker.Evaluate(context.Background())
+	assert.Equal(t, health.StatusNotReady, report.Status)
+	assert.False(t, report.Ready())
+}
+
+func TestCheckerTimeoutAndDraining(t *testing.T) {
+	checker := health.NewChecker(20 * time.Millisecond)
+	checker.Register("database", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := checker.Evaluate(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, health.StatusNotReady, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["database"].Error)
+
+	healthy := health.NewChecker(time.Second)
+	healthy.Register("database", true, healthyCheck)
+	assert.True(t, healthy.Evaluate(context.Background()).Ready())
+
+	// Draining fails readiness even when every dependency is fine
+	healthy.SetDraining()
+	report = healthy.Evaluate(context.Background())
+	assert.Equal(t, health.StatusDraining, report.Status)
+	assert.False(t, report.Ready())
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+}
+
+func TestLatestMigration(t *testing.T) {
+	latest, err := health.LatestMigration(fstest.MapFS{
+		"0001_init.up.sql":       {},
+		"0001_init.down.sql":     {},
+		"0012_add_tags.up.sql":   {},
+		"0003_add_index.up.sql":  {},
+		"0013_add_tags.down.sql": {},
+		"README.md":              {},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), latest)
+
+	latest, err = health.LatestMigration(migrations.FS)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), latest)
+}
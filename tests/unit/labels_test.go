@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"context"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func labeled(t *testing.T, subscriptionService *service.SubscriptionService, userID uuid.UUID, name string, price int, category string, tags ...string) *model.Subscription {
+	t.Helper()
+	req := &model.CreateSubscriptionRequest{ServiceName: name, Price: price, UserID: userID, StartDate: "07-2025", Tags: tags}
+	if category != "" {
+		req.Category = &category
+	}
+	sub, err := subscriptionService.Create(context.Background(), req)
+	require.NoError(t, err)
+	return sub
+}
+
+func TestCreateNormalizesLabels(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	sub := labeled(t, subscriptionService, uuid.New(), "Netflix", 500, " Entertainment ", "Family", " family", "Movies ")
+	if assert.NotNil(t, sub.Category) {
+		assert.Equal(t, "entertainment", *sub.Category)
+	}
+	assert.Equal(t, []string{"family", "movies"}, sub.Tags)
+
+	blank := ""
+	plain, err := subscriptionService.Create(context.Background(), &model.CreateSubscriptionRequest{
+		ServiceName: "Hulu", Price: 300, UserID: uuid.New(), StartDate: "07-2025", Category: &blank,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, plain.Category)
+	assert.Nil(t, plain.Tags)
+}
+
+func TestLabelsAreValidated(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+	ctx := context.Background()
+	games := "games"
+
+	_, err := subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+		ServiceName: "Steam", Price: 300, UserID: uuid.New(), StartDate: "07-2025", Category: &games,
+	})
+	assert.EqualError(t, err, "category must be one of entertainment, dev_tools, cloud, education")
+
+	tags := make([]string, 21)
+	for i := range tags {
+		tags[i] = string(rune('a' + i))
+	}
+	_, err = subscriptionService.Create(ctx, &model.CreateSubscriptionRequest{
+		ServiceName: "Steam", Price: 300, UserID: uuid.New(), StartDate: "07-2025", Tags: tags,
+	})
+	assert.EqualError(t, err, "at most 20 tags are allowed")
+
+	_, err = subscriptionService.List(ctx, model.SubscriptionFilter{Category: &games})
+	assert.EqualError(t, err, "category must be one of entertainment, dev_tools, cloud, education")
+	_, err = subscriptionService.CostSummary(ctx, model.SubscriptionFilter{}, "price")
+	assert.EqualError(t, err, "group_by must be one of category, tag, service_name")
+	// Handlers answer invalid filters with 400 rather than 500
+	var filterErr *service.FilterError
+	assert.ErrorAs(t, err, &filterErr)
+}
+
+func TestListFiltersByCategoryAndTags(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+	userID := uuid.New()
+	netflix := labeled(t, subscriptionService, userID, "Netflix", 500, "entertainment", "family")
+	aws := labeled(t, subscriptionService, userID, "AWS", 2000, "cloud", "infra", "family")
+	labeled(t, subscriptionService, userID, "Hulu", 300, "")
+
+	subs, err := subscriptionService.List(context.Background(), model.SubscriptionFilter{Tags: []string{"Family"}})
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	assert.Equal(t, []int{aws.ID, netflix.ID}, []int{subs[0].ID, subs[1].ID})
+
+	category := "Cloud"
+	subs, err = subscriptionService.List(context.Background(), model.SubscriptionFilter{Category: &category, Tags: []string{"infra"}})
+	require.NoError(t, err)
+	if assert.Len(t, subs, 1) {
+		assert.Equal(t, aws.ID, subs[0].ID)
+	}
+}
+
+func TestCostSummaryGroupsByLabels(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+	userID := uuid.New()
+	labeled(t, subscriptionService, userID, "Netflix", 500, "entertainment", "family")
+	labeled(t, subscriptionService, userID, "AWS", 2000, "cloud", "infra", "family")
+	labeled(t, subscriptionService, userID, "Kinopoisk", 300, "entertainment")
+	labeled(t, subscriptionService, userID, "Hulu", 300, "")
+	ctx := context.Background()
+
+	summary, err := subscriptionService.CostSummary(ctx, model.SubscriptionFilter{UserID: &userID}, model.GroupByCategory)
+	require.NoError(t, err)
+	assert.Equal(t, 3100, summary.TotalCost)
+	assert.Equal(t, model.GroupByCategory, summary.GroupBy)
+	// Most expensive first; subscriptions without a category share the empty key
+	assert.Equal(t, []model.CostGroup{
+		{Key: "cloud", TotalCost: 2000, SubscriptionCount: 1},
+		{Key: "entertainment", TotalCost: 800, SubscriptionCount: 2},
+		{Key: "", TotalCost: 300, SubscriptionCount: 1},
+	}, summary.Groups)
+
+	// A subscription counts once in each of its tags
+	summary, err = subscriptionService.CostSummary(ctx, model.SubscriptionFilter{UserID: &userID}, model.GroupByTag)
+	require.NoError(t, err)
+	assert.Equal(t, []model.CostGroup{
+		{Key: "family", TotalCost: 2500, SubscriptionCount: 2},
+		{Key: "infra", TotalCost: 2000, SubscriptionCount: 1},
+		{Key: "", TotalCost: 600, SubscriptionCount: 2},
+	}, summary.Groups)
+
+	category := "entertainment"
+	result, err := subscriptionService.CalculateTotalCost(ctx, model.SubscriptionFilter{Category: &category}, model.GroupByServiceName)
+	require.NoError(t, err)
+	assert.Equal(t, 800, result.TotalCost)
+	assert.Len(t, result.Items, 2)
+	if assert.NotNil(t, result.Category) {
+		assert.Equal(t, "entertainment", *result.Category)
+	}
+	assert.Equal(t, []model.CostGroup{
+		{Key: "Netflix", TotalCost: 500, SubscriptionCount: 1},
+		{Key: "Kinopoisk", TotalCost: 300, SubscriptionCount: 1},
+	}, result.Groups)
+}
@@ -0,0 +1,50 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"subscription-service/internal/logger"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerFiltersByLevel(t *testing.T) {
+	var out bytes.Buffer
+	log := logger.New("warn", "text", &out)
+
+	log.Debug("debug message")
+	log.Info("info message")
+	log.Warn("warn message", "attempt", 2)
+	log.Error("error message", "error", errors.New("boom"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], " WARN warn message attempt=2")
+	assert.Contains(t, lines[1], " ERROR error message error=boom")
+
+	out.Reset()
+	log.SetLevel("debug")
+	log.Debug("debug message")
+	assert.Contains(t, out.String(), "DEBUG debug message")
+}
+
+func TestLoggerJSONWithContextFields(t *testing.T) {
+	var out bytes.Buffer
+	log := logger.New("info", "json", &out)
+
+	ctx := logger.WithFields(context.Background(), "request_id", "req-1")
+	ctx = logger.WithFields(ctx, "subscription_id", 42)
+	log.WithContext(ctx).Info("subscription updated", "service_name", "Yandex Plus")
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "subscription updated", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, float64(42), entry["subscription_id"])
+	assert.Equal(t, "Yandex Plus", entry["service_name"])
+}
@@ -0,0 +1,20 @@
+package unit
+
+import (
+	"subscription-service/internal/repository"
+	"subscription-service/internal/repository/repotest"
+	"testing"
+)
+
+func TestMemoryRepositoryConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.SubscriptionRepository {
+		return repository.NewMemoryRepository()
+	})
+}
+
+func TestMemoryServiceRepositoryConformance(t *testing.T) {
+	repotest.RunCatalog(t, func(t *testing.T) (repository.ServiceRepository, repository.SubscriptionRepository) {
+		subscriptions := repository.NewMemoryRepository()
+		return repository.NewMemoryServiceRepository(subscriptions), subscriptions
+	})
+}
@@ -0,0 +1,182 @@
+package unit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowConnector is a database/sql connector whose queries take delay to answer,
+// or fail with the context's error if it ends first
+type slowConnector struct {
+	delay time.Duration
+	rows  int
+}
+
+func (c *slowConnector) Connect(context.Context) (driver.Conn, error) { return &slowConn{c}, nil }
+func (c *slowConnector) Driver() driver.Driver                        { return slowDriver{c} }
+
+type slowDriver struct{ c *slowConnector }
+
+func (d slowDriver) Open(string) (driver.Conn, error) { return &slowConn{d.c}, nil }
+
+type slowConn struct{ c *slowConnector }
+
+func (c *slowConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *slowConn) Close() error                        { return nil }
+func (c *slowConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	select {
+	case <-time.After(c.c.delay):
+		return &fakeRows{left: c.c.rows}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type fakeRows struct{ left int }
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "service_name", "price", "user_id", "start_date", "end_date", "created_at", "updated_at", "service_id", "category", "tags"}
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	now := time.Now()
+	copy(dest, []driver.Value{int64(r.left + 1), "Yandex Plus", int64(400), "60601fee-2bf1-4721-ae6f-7636e79a0cba", "07-2025", nil, now, now, nil, nil, "{}"})
+	return nil
+}
+
+func newSlowRepository(delay, timeout time.Duration, rows int) repository.SubscriptionRepository {
+	db := sql.OpenDB(&slowConnector{delay: delay, rows: rows})
+	return repository.NewPostgresRepository(db, logger.Nop(), timeout)
+}
+
+func TestPostgresRepositoryQueryTimeout(t *testing.T) {
+	repo := newSlowRepository(time.Second, 20*time.Millisecond, 1)
+
+	_, err := repo.GetAll(context.Background())
+	assert.ErrorIs(t, err, repository.ErrQueryTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPostgresRepositoryHonorsCallerCancellation(t *testing.T) {
+	repo := newSlowRepository(time.Second, time.Minute, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := repo.GetAll(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, repository.ErrQueryTimeout)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestPostgresRepositoryTimeoutExcludesConsumer(t *testing.T) {
+	repo := newSlowRepository(0, 30*time.Millisecond, 3)
+
+	// The consumer is slower than the query timeout, but the database answers immediately
+	rows := 0
+	err := repo.IterateByFilters(context.Background(), model.SubscriptionFilter{}, func(*model.Subscription) error {
+		rows++
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rows)
+}
+
+// fakeReplica is a repository.Replica whose usability is set by the test
+type fakeReplica struct {
+	db     *sql.DB
+	usable bool
+	failed error
+}
+
+func (r *fakeReplica) DB() *sql.DB  { return r.db }
+func (r *fakeReplica) Usable() bool { return r.usable }
+func (r *fakeReplica) Failed(err error) {
+	r.usable = false
+	r.failed = err
+}
+
+func TestPostgresRepositoryReadsReportsFromUsableReplica(t *testing.T) {
+	primary := sql.OpenDB(&slowConnector{rows: 1})
+	defer primary.Close()
+	replica := &fakeReplica{db: sql.OpenDB(&slowConnector{rows: 3}), usable: true}
+	defer replica.db.Close()
+	repo := repository.NewPostgresRepositoryWithReplica(primary, replica, logger.Nop(), time.Second)
+	ctx := context.Background()
+
+	all, err := repo.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+	filtered, err := repo.GetByFilters(ctx, model.SubscriptionFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 3)
+
+	// A lagging replica is skipped
+	replica.usable = false
+	all, err = repo.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+}
+
+func TestPostgresRepositoryFallsBackWhenReplicaFails(t *testing.T) {
+	primary := sql.OpenDB(&slowConnector{rows: 1})
+	defer primary.Close()
+	replica := &fakeReplica{db: sql.OpenDB(&slowConnector{rows: 3}), usable: true}
+	replica.db.Close()
+	repo := repository.NewPostgresRepositoryWithReplica(primary, replica, logger.Nop(), time.Second)
+
+	all, err := repo.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	assert.False(t, replica.usable)
+	assert.ErrorContains(t, replica.failed, "database is closed")
+}
+
+func TestPostgresRepositoryReplicaHonorsCallerCancellation(t *testing.T) {
+	primary := sql.OpenDB(&slowConnector{rows: 1})
+	defer primary.Close()
+	replica := &fakeReplica{db: sql.OpenDB(&slowConnector{delay: time.Second, rows: 3}), usable: true}
+	defer replica.db.Close()
+	repo := repository.NewPostgresRepositoryWithReplica(primary, replica, logger.Nop(), time.Minute)
+
+	// A canceled read is not retried on the primary and says nothing about the replica
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := repo.GetAll(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, replica.usable)
+}
+
+func TestPostgresRepositoryReadPrimarySkipsReplica(t *testing.T) {
+	primary := sql.OpenDB(&slowConnector{rows: 1})
+	defer primary.Close()
+	replica := &fakeReplica{db: sql.OpenDB(&slowConnector{rows: 3}), usable: true}
+	defer replica.db.Close()
+	repo := repository.NewPostgresRepositoryWithReplica(primary, replica, logger.Nop(), time.Second)
+
+	// Reports that are cached are read on the primary even while the replica is usable
+	all, err := repo.GetAll(repository.ReadPrimary(context.Background()))
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	filtered, err := repo.GetByFilters(repository.ReadPrimary(context.Background()), model.SubscriptionFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 1)
+	assert.True(t, replica.usable)
+}
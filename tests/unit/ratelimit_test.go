@@ -0,0 +1,92 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"subscription-service/internal/api/middleware"
+	"subscription-service/internal/config"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterBurstAndUpdate(t *testing.T) {
+	limiter := middleware.NewRateLimiter(config.RateLimitConfig{Enabled: true, RequestsPerSecond: 0.001, Burst: 2})
+
+	ok, _ := limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, wait := limiter.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Greater(t, wait.Seconds(), 0.0)
+
+	// Other clients have their own bucket
+	ok, _ = limiter.Allow("10.0.0.2")
+	assert.True(t, ok)
+
+	limiter.Update(config.RateLimitConfig{Enabled: false})
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+}
+
+func TestRateLimiterBoundsClients(t *testing.T) {
+	limiter := middleware.NewRateLimiter(config.RateLimitConfig{Enabled: true, RequestsPerSecond: 0.001, Burst: 1})
+
+	for i := 0; i <= middleware.MaxRateLimitClients; i++ {
+		limiter.Allow(fmt.Sprint(i))
+	}
+	assert.LessOrEqual(t, limiter.Clients(), middleware.MaxRateLimitClients)
+}
+
+// rateLimitedRouter serves /api and the exempt /readyz behind a limit of one request
+func rateLimitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies(trustedProxies))
+	limiter := middleware.NewRateLimiter(config.RateLimitConfig{Enabled: true, RequestsPerSecond: 0.001, Burst: 1})
+	router.Use(middleware.RateLimit(limiter, "/readyz"))
+	router.GET("/api", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/readyz", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func serve(router *gin.Engine, path, remoteAddr, forwardedFor string) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	router := rateLimitedRouter(t, nil)
+
+	assert.Equal(t, http.StatusOK, serve(router, "/api", "203.0.113.7:1234", "198.51.100.1"))
+	// A new X-Forwarded-For value does not make a new client
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, "/api", "203.0.113.7:1234", "198.51.100.2"))
+}
+
+func TestRateLimitUsesForwardedForFromTrustedProxies(t *testing.T) {
+	router := rateLimitedRouter(t, []string{"10.0.0.0/8"})
+
+	assert.Equal(t, http.StatusOK, serve(router, "/api", "10.0.0.5:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, serve(router, "/api", "10.0.0.5:1234", "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, "/api", "10.0.0.5:1234", "198.51.100.1"))
+}
+
+func TestRateLimitExemptsProbes(t *testing.T) {
+	router := rateLimitedRouter(t, nil)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(router, "/readyz", "203.0.113.7:1234", ""))
+	}
+	assert.Equal(t, http.StatusOK, serve(router, "/api", "203.0.113.7:1234", ""))
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, "/api", "203.0.113.7:1234", ""))
+}
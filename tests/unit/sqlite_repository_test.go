@@ -0,0 +1,147 @@
+package unit
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"subscription-service/db/migrations"
+	"subscription-service/internal/config"
+	"subscription-service/internal/database"
+	"subscription-service/internal/health"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/repository/repotest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	cfg := config.Default().Database
+	cfg.URL = "sqlite://" + filepath.Join(t.TempDir(), "subscriptions.db")
+	db, err := database.Open(context.Background(), cfg, logger.Nop())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	check := health.Migrations(db, migrations.SQLite)
+
+	assert.ErrorContains(t, check(ctx), "schema_migrations table not found")
+
+	require.NoError(t, database.Migrate(ctx, db, migrations.SQLite))
+	assert.NoError(t, check(ctx))
+
+	// Applying again is a no-op
+	assert.NoError(t, database.Migrate(ctx, db, migrations.SQLite))
+}
+
+func TestSQLiteRepositoryConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.SubscriptionRepository {
+		db := openSQLite(t)
+		require.NoError(t, database.Migrate(context.Background(), db, migrations.SQLite))
+		return repository.NewSQLiteRepository(db, logger.Nop(), time.Second)
+	})
+}
+
+func TestSQLiteServiceRepositoryConformance(t *testing.T) {
+	repotest.RunCatalog(t, func(t *testing.T) (repository.ServiceRepository, repository.SubscriptionRepository) {
+		db := openSQLite(t)
+		require.NoError(t, database.Migrate(context.Background(), db, migrations.SQLite))
+		return repository.NewSQLiteServiceRepository(db, logger.Nop(), time.Second),
+			repository.NewSQLiteRepository(db, logger.Nop(), time.Second)
+	})
+}
+
+func TestSQLiteMonthlySpendCatchesUpOnClosedMonths(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	require.NoError(t, database.Migrate(ctx, db, migrations.SQLite))
+	repo := repository.NewSQLiteRepository(db, logger.Nop(), time.Second)
+
+	now := time.Now()
+	userID := uuid.New()
+	start := now.AddDate(0, -3, 0).Format("01-2006")
+	sub := &model.Subscription{ServiceName: "Yandex Plus", Price: 400, UserID: userID, StartDate: start}
+	require.NoError(t, repo.Create(ctx, sub))
+
+	// The three months before the current one are materialized, the current one is not
+	var months, amount int
+	require.NoError(t, db.QueryRow("SELECT count(*), sum(amount) FROM monthly_spend").Scan(&months, &amount))
+	assert.Equal(t, 3, months)
+	assert.Equal(t, 1200, amount)
+
+	// Pretend the last two months ended since the previous write
+	var closedBefore int
+	require.NoError(t, db.QueryRow("SELECT closed_before FROM monthly_spend_state").Scan(&closedBefore))
+	_, err := db.Exec("UPDATE monthly_spend_state SET closed_before = ?", closedBefore-2)
+	require.NoError(t, err)
+	_, err = db.Exec("DELETE FROM monthly_spend WHERE month >= ?", closedBefore-2)
+	require.NoError(t, err)
+
+	// Reads compute months after the watermark from the subscriptions
+	summary, err := repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID}, "")
+	require.NoError(t, err)
+	if assert.Len(t, summary.Months, 4) {
+		for _, month := range summary.Months {
+			assert.Equal(t, 400, month.Cost, month.Month)
+		}
+	}
+
+	// The next write materializes them again
+	other := &model.Subscription{ServiceName: "Netflix", Price: 600, UserID: uuid.New(), StartDate: now.Format("01-2006")}
+	require.NoError(t, repo.Create(ctx, other))
+	require.NoError(t, db.QueryRow("SELECT count(*), sum(amount) FROM monthly_spend").Scan(&months, &amount))
+	assert.Equal(t, 3, months)
+	assert.Equal(t, 1200, amount)
+
+	summary2, err := repo.SummarizeCost(ctx, model.SubscriptionFilter{UserID: &userID}, "")
+	require.NoError(t, err)
+	assert.Equal(t, summary, summary2)
+}
+
+func TestSQLiteCatalogRewritesSpendOfLinkedUsersOnly(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	require.NoError(t, database.Migrate(ctx, db, migrations.SQLite))
+	repo := repository.NewSQLiteRepository(db, logger.Nop(), time.Second)
+	catalog := repository.NewSQLiteServiceRepository(db, logger.Nop(), time.Second)
+
+	start := time.Now().AddDate(0, -3, 0).Format("01-2006")
+	userID, otherID := uuid.New(), uuid.New()
+	require.NoError(t, repo.Create(ctx, &model.Subscription{ServiceName: "yandex plus", Price: 400, UserID: userID, StartDate: start}))
+	require.NoError(t, repo.Create(ctx, &model.Subscription{ServiceName: "Netflix", Price: 600, UserID: otherID, StartDate: start}))
+	var closedBefore int
+	require.NoError(t, db.QueryRow("SELECT closed_before FROM monthly_spend_state").Scan(&closedBefore))
+
+	// Linking renames the subscription, which moves only its user's months to the new name
+	users, err := catalog.Create(ctx, &model.Service{Name: "Yandex Plus"})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{userID}, users)
+
+	var watermark int
+	require.NoError(t, db.QueryRow("SELECT closed_before FROM monthly_spend_state").Scan(&watermark))
+	assert.Equal(t, closedBefore, watermark)
+	spend := func(user uuid.UUID, service string) (months, amount int) {
+		t.Helper()
+		require.NoError(t, db.QueryRow("SELECT count(*), COALESCE(sum(amount), 0) FROM monthly_spend WHERE user_id = ? AND service_name = ?",
+			user.String(), service).Scan(&months, &amount))
+		return months, amount
+	}
+	months, amount := spend(userID, "Yandex Plus")
+	assert.Equal(t, 3, months)
+	assert.Equal(t, 1200, amount)
+	months, _ = spend(userID, "yandex plus")
+	assert.Zero(t, months)
+	months, amount = spend(otherID, "Netflix")
+	assert.Equal(t, 3, months)
+	assert.Equal(t, 1800, amount)
+}
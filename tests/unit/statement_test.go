@@ -0,0 +1,166 @@
+package unit
+
+import (
+	"context"
+	"strings"
+	"subscription-service/internal/logger"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/internal/statement"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ofxStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>RUB
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20250705120000<TRNAMT>-399.00<NAME>YANDEX PLUS 1234</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20250805120000<TRNAMT>-399.00<NAME>YANDEX PLUS 5678</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20250710<TRNAMT>-799.00<NAME>POS Netflix.com</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20250810<TRNAMT>-799.00<NAME>POS Netflix.com</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20250712<TRNAMT>-1500.00<NAME>Grocery</STMTTRN>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20250801<TRNAMT>50000.00<NAME>Salary</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const camtStatement = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Ntry>
+        <Amt Ccy="EUR">9.99</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2025-01-28</Dt></BookgDt>
+        <NtryDtls><TxDtls><RltdPties><Cdtr><Nm>Spotify AB</Nm></Cdtr></RltdPties></TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">9.99</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2025-02-27</Dt></BookgDt>
+        <NtryDtls><TxDtls><RltdPties><Cdtr><Nm>Spotify AB</Nm></Cdtr></RltdPties></TxDtls></NtryDtls>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+func TestParseOFXAndDetectRecurring(t *testing.T) {
+	format, txs, err := statement.Parse(strings.NewReader(ofxStatement))
+	assert.NoError(t, err)
+	assert.Equal(t, statement.FormatOFX, format)
+	assert.Len(t, txs, 6)
+	assert.Equal(t, int64(-39900), txs[0].Amount)
+	assert.Equal(t, "RUB", txs[0].Currency)
+
+	charges := statement.DetectRecurring(txs)
+	assert.Len(t, charges, 2)
+	assert.Equal(t, "POS Netflix.com", charges[0].Merchant)
+	assert.Equal(t, int64(79900), charges[0].Amount)
+	assert.Equal(t, "YANDEX PLUS 5678", charges[1].Merchant)
+	assert.Equal(t, 2, charges[1].Occurrences)
+}
+
+func TestParseCAMT053(t *testing.T) {
+	format, txs, err := statement.Parse(strings.NewReader(camtStatement))
+	assert.NoError(t, err)
+	assert.Equal(t, statement.FormatCAMT053, format)
+	assert.Len(t, txs, 2)
+	assert.Equal(t, int64(-999), txs[0].Amount)
+	assert.Equal(t, "EUR", txs[0].Currency)
+	assert.Equal(t, "Spotify AB", txs[0].Merchant)
+}
+
+func TestAnalyzeStatementMatchesAndProposes(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	userID := uuid.New()
+	_, err := subscriptionService.Create(context.Background(), &model.CreateSubscriptionRequest{
+		ServiceName: "Yandex Plus",
+		Price:       400,
+		UserID:      userID,
+		StartDate:   "01-2025",
+	})
+	assert.NoError(t, err)
+
+	report, err := subscriptionService.AnalyzeStatement(context.Background(), userID, strings.NewReader(ofxStatement))
+	assert.NoError(t, err)
+	assert.Equal(t, "ofx", report.Format)
+
+	assert.Len(t, report.Matched, 1)
+	assert.Equal(t, 1, *report.Matched[0].SubscriptionID)
+	assert.False(t, report.Matched[0].PriceChanged)
+
+	assert.Len(t, report.Proposed, 1)
+	assert.Equal(t, &model.CreateSubscriptionRequest{
+		ServiceName: "POS Netflix.com",
+		Price:       799,
+		UserID:      userID,
+		StartDate:   "07-2025",
+	}, report.Proposed[0].Proposal)
+}
+
+func TestParseOFXKeepsOffsetsWithNonASCIIText(t *testing.T) {
+	// Upper-casing ı changes its length in bytes, which must not shift the tags found
+	ofx := `<OFX><CURDEF>EUR
+<STMTTRN><TRNAMT>-12.50<DTPOSTED>20250701<NAME>Dıyanet Kıbrıs</STMTTRN>
+<stmttrn><trnamt>-3.00<dtposted>20250801<name>Spotify</stmttrn></OFX>`
+	txs, err := statement.ParseOFX(strings.NewReader(ofx))
+	require.NoError(t, err)
+	if assert.Len(t, txs, 2) {
+		assert.Equal(t, "Dıyanet Kıbrıs", txs[0].Merchant)
+		assert.Equal(t, int64(-1250), txs[0].Amount)
+		assert.Equal(t, "Spotify", txs[1].Merchant)
+		assert.Equal(t, "EUR", txs[1].Currency)
+	}
+}
+
+func TestAnalyzeStatementListsForeignCurrencyCharges(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	userID := uuid.New()
+	_, err := subscriptionService.Create(context.Background(), &model.CreateSubscriptionRequest{
+		ServiceName: "Spotify",
+		Price:       10,
+		UserID:      userID,
+		StartDate:   "01-2025",
+	})
+	require.NoError(t, err)
+
+	report, err := subscriptionService.AnalyzeStatement(context.Background(), userID, strings.NewReader(camtStatement))
+	require.NoError(t, err)
+
+	// 9.99 EUR is neither 10 rubles nor a new 10-ruble subscription
+	assert.Empty(t, report.Matched)
+	assert.Empty(t, report.Proposed)
+	if assert.Len(t, report.Foreign, 1) {
+		assert.Equal(t, "Spotify AB", report.Foreign[0].Merchant)
+		assert.Equal(t, 10, report.Foreign[0].Amount)
+		assert.Equal(t, "EUR", report.Foreign[0].Currency)
+		assert.Nil(t, report.Foreign[0].Proposal)
+		assert.Nil(t, report.Foreign[0].SubscriptionID)
+	}
+}
+
+func TestDetectRecurringSeparatesCurrencies(t *testing.T) {
+	day := func(month time.Month) time.Time { return time.Date(2025, month, 5, 0, 0, 0, 0, time.UTC) }
+	txs := []statement.Transaction{
+		{Date: day(time.July), Amount: -999, Currency: "EUR", Merchant: "Spotify"},
+		{Date: day(time.August), Amount: -999, Currency: "USD", Merchant: "Spotify"},
+		{Date: day(time.September), Amount: -999, Currency: "EUR", Merchant: "Spotify"},
+	}
+
+	charges := statement.DetectRecurring(txs)
+	assert.Empty(t, charges, "one charge per currency is not a recurring payment")
+}
@@ -1,7 +1,12 @@
 package unit
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"subscription-service/internal/logger"
 	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
 	"subscription-service/internal/service"
 	"testing"
 
@@ -9,73 +14,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-// Mock repository for testing
-type MockRepository struct {
-	subscriptions []model.Subscription
-}
-
-func NewMockRepository() *MockRepository {
-	return &MockRepository{
-		subscriptions: make([]model.Subscription, 0),
-	}
-}
-
-func (m *MockRepository) Create(subscription *model.Subscription) error {
-	subscription.ID = len(m.subscriptions) + 1
-	m.subscriptions = append(m.subscriptions, *subscription)
-	return nil
-}
-
-func (m *MockRepository) GetByID(id int) (*model.Subscription, error) {
-	for _, sub := range m.subscriptions {
-		if sub.ID == id {
-			return &sub, nil
-		}
-	}
-	return nil, assert.AnError
-}
-
-func (m *MockRepository) GetAll() ([]model.Subscription, error) {
-	return m.subscriptions, nil
-}
-
-func (m *MockRepository) Update(subscription *model.Subscription) error {
-	for i, sub := range m.subscriptions {
-		if sub.ID == subscription.ID {
-			m.subscriptions[i] = *subscription
-			return nil
-		}
-	}
-	return assert.AnError
-}
-
-func (m *MockRepository) Delete(id int) error {
-	for i, sub := range m.subscriptions {
-		if sub.ID == id {
-			m.subscriptions = append(m.subscriptions[:i], m.subscriptions[i+1:]...)
-			return nil
-		}
-	}
-	return assert.AnError
-}
-
-func (m *MockRepository) GetByFilters(userID *uuid.UUID, serviceName *string, period *string) ([]model.Subscription, error) {
-	result := make([]model.Subscription, 0)
-	for _, sub := range m.subscriptions {
-		if userID != nil && sub.UserID != *userID {
-			continue
-		}
-		if serviceName != nil && sub.ServiceName != *serviceName {
-			continue
-		}
-		result = append(result, sub)
-	}
-	return result, nil
-}
-
 func TestCreateSubscription(t *testing.T) {
-	mockRepo := NewMockRepository()
-	subscriptionService := service.NewSubscriptionService(mockRepo)
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
 
 	userID := uuid.New()
 	req := &model.CreateSubscriptionRequest{
@@ -85,7 +25,7 @@ func TestCreateSubscription(t *testing.T) {
 		StartDate:   "07-2025",
 	}
 
-	subscription, err := subscriptionService.Create(req)
+	subscription, err := subscriptionService.Create(context.Background(), req)
 	assert.NoError(t, err)
 	assert.NotNil(t, subscription)
 	assert.Equal(t, "Test Service", subscription.ServiceName)
@@ -93,19 +33,25 @@ func TestCreateSubscription(t *testing.T) {
 	assert.Equal(t, userID, subscription.UserID)
 }
 
+func TestCreateRejectsNilRequest(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	subscription, err := subscriptionService.Create(context.Background(), nil)
+	assert.EqualError(t, err, "subscription request cannot be nil")
+	assert.Nil(t, subscription)
+}
+
 func TestGetAllSubscriptions(t *testing.T) {
-	mockRepo := NewMockRepository()
-	subscriptionService := service.NewSubscriptionService(mockRepo)
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
 
-	subscriptions, err := subscriptionService.GetAll()
+	subscriptions, err := subscriptionService.GetAll(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, subscriptions)
 	assert.Len(t, subscriptions, 0)
 }
 
 func TestCalculateTotalCost(t *testing.T) {
-	mockRepo := NewMockRepository()
-	subscriptionService := service.NewSubscriptionService(mockRepo)
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
 
 	userID := uuid.New()
 	
@@ -124,16 +70,172 @@ func TestCalculateTotalCost(t *testing.T) {
 		StartDate:   "07-2025",
 	}
 
-	_, err := subscriptionService.Create(req1)
+	_, err := subscriptionService.Create(context.Background(), req1)
 	assert.NoError(t, err)
 	
-	_, err = subscriptionService.Create(req2)
+	_, err = subscriptionService.Create(context.Background(), req2)
 	assert.NoError(t, err)
 
 	// Test cost calculation
-	result, err := subscriptionService.CalculateTotalCost(&userID, nil, nil)
+	result, err := subscriptionService.CalculateTotalCost(context.Background(), model.SubscriptionFilter{UserID: &userID}, "")
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, 1000, result.TotalCost)
 	assert.Len(t, result.Items, 2)
-}
\ No newline at end of file
+}
+
+func TestBatchAtomicRollsBackOnFailure(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	userID := uuid.New()
+	req := &model.BatchRequest{
+		Mode: model.BatchModeAtomic,
+		Operations: []model.BatchOperation{
+			{Op: model.BatchOpCreate, Subscription: &model.CreateSubscriptionRequest{
+				ServiceName: "Service 1",
+				Price:       400,
+				UserID:      userID,
+				StartDate:   "07-2025",
+			}},
+			{Op: model.BatchOpDelete, ID: 42},
+		},
+	}
+
+	result, err := subscriptionService.Batch(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Succeeded)
+	assert.Equal(t, 2, result.Failed)
+	assert.NotEmpty(t, result.Results[1].Error)
+
+	subscriptions, err := subscriptionService.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, 0)
+}
+
+func TestBatchBestEffortReportsPerItem(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	userID := uuid.New()
+	req := &model.BatchRequest{
+		Mode: model.BatchModeBestEffort,
+		Operations: []model.BatchOperation{
+			{Op: model.BatchOpCreate, Subscription: &model.CreateSubscriptionRequest{
+				ServiceName: "Service 1",
+				Price:       400,
+				UserID:      userID,
+				StartDate:   "07-2025",
+			}},
+			{Op: model.BatchOpCreate, Subscription: &model.CreateSubscriptionRequest{
+				ServiceName: "Service 2",
+				Price:       600,
+				UserID:      userID,
+				StartDate:   "2025-07",
+			}},
+		},
+	}
+
+	result, err := subscriptionService.Batch(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.True(t, result.Results[0].Success)
+	assert.Equal(t, "start_date must be in MM-YYYY format", result.Results[1].Error)
+
+	subscriptions, err := subscriptionService.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, 1)
+}
+
+func TestImportDryRunReportsRowErrors(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	csv := "service_name,price,user_id,start_date,end_date\n" +
+		"Yandex Plus,400,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025,\n" +
+		"Netflix,abc,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025,\n" +
+		"Spotify,300,60601fee-2bf1-4721-ae6f-7636e79a0cba,2025-07,12-2025\n"
+
+	report, err := subscriptionService.Import(context.Background(), strings.NewReader(csv), true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.TotalRows)
+	assert.Equal(t, 1, report.ValidRows)
+	assert.Equal(t, 0, report.Imported)
+	assert.Equal(t, []model.ImportRowError{
+		{Row: 3, Error: "price must be an integer"},
+		{Row: 4, Error: "start_date must be in MM-YYYY format"},
+	}, report.Errors)
+
+	subscriptions, err := subscriptionService.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, 0)
+}
+
+func TestImportCommitInsertsValidRows(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	csv := "user_id,service_name,start_date,price\n" +
+		"60601fee-2bf1-4721-ae6f-7636e79a0cba,Yandex Plus,07-2025,400\n" +
+		"60601fee-2bf1-4721-ae6f-7636e79a0cba,Netflix,08-2025,700\n"
+
+	report, err := subscriptionService.Import(context.Background(), strings.NewReader(csv), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Empty(t, report.Errors)
+
+	subscriptions, err := subscriptionService.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, 2)
+}
+
+func TestImportRejectsMissingColumns(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	_, err := subscriptionService.Import(context.Background(), strings.NewReader("service_name,price\n"), true)
+	assert.EqualError(t, err, `csv header is missing column "user_id"`)
+	var csvErr *service.CSVError
+	assert.ErrorAs(t, err, &csvErr)
+}
+
+func TestImportListsFirstRowErrors(t *testing.T) {
+	subscriptionService := service.NewSubscriptionService(repository.NewMemoryRepository(), logger.Nop())
+
+	csv := "service_name,price,user_id,start_date\n" +
+		strings.Repeat("Netflix,abc,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025\n", service.MaxImportErrors+50)
+
+	report, err := subscriptionService.Import(context.Background(), strings.NewReader(csv), true)
+	assert.NoError(t, err)
+	assert.Equal(t, service.MaxImportErrors+50, report.ErrorCount)
+	assert.Len(t, report.Errors, service.MaxImportErrors)
+	assert.Equal(t, model.ImportRowError{Row: 2, Error: "price must be an integer"}, report.Errors[0])
+}
+
+// failingBatchRepository fails every ApplyBatch after the first failAfter with a storage error
+type failingBatchRepository struct {
+	repository.SubscriptionRepository
+	failAfter int
+	calls     int
+}
+
+func (r *failingBatchRepository) ApplyBatch(ctx context.Context, ops []repository.BatchOp) error {
+	r.calls++
+	if r.calls > r.failAfter {
+		return errors.New("connection refused")
+	}
+	return r.SubscriptionRepository.ApplyBatch(ctx, ops)
+}
+
+func TestImportStopsWhenStorageFails(t *testing.T) {
+	repo := &failingBatchRepository{SubscriptionRepository: repository.NewMemoryRepository(), failAfter: 1}
+	subscriptionService := service.NewSubscriptionService(repo, logger.Nop())
+
+	csv := "service_name,price,user_id,start_date\n" +
+		strings.Repeat("Netflix,700,60601fee-2bf1-4721-ae6f-7636e79a0cba,07-2025\n", 3*service.ImportBatchSize)
+
+	report, err := subscriptionService.Import(context.Background(), strings.NewReader(csv), false)
+	assert.Nil(t, report)
+	assert.EqualError(t, err, "import stopped at row 102 after 100 rows were imported: connection refused")
+	assert.Equal(t, 2, repo.calls)
+
+	subscriptions, err := subscriptionService.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, service.ImportBatchSize)
+}